@@ -2,6 +2,8 @@ package analysis
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 	"tiny/ast"
 	"tiny/lexer"
 	"tiny/shared"
@@ -15,6 +17,9 @@ const (
 	CLASS_CLASS
 	CLASS_SUBCLASS
 	CLASS_STRUCT
+	CLASS_TRAIT
+	// Within the static members of a class, which have no instance
+	CLASS_STATIC
 )
 
 const (
@@ -24,22 +29,29 @@ const (
 	FUNCTION_METHOD
 	FUNCTION_CATCH
 	FUNCTION_TEST
+	FUNCTION_DEFER
 )
 
 type Analyser struct {
 	hadErr          bool
 	quiet           bool
 	inLoop          bool
+	inGenerator     bool
 	currentClass    ClassType
 	currentFunction FunctionType
-	table           []*SymbolTable
+	// Definition of the class or struct being checked, which can use its private members
+	currentDef ast.Node
+	table      []*SymbolTable
+	// Public members of each module, by resolved path
+	modules     map[string][]string
+	diagnostics []*shared.Diagnostic
 }
 
 func NewAnalyser(quiet bool) *Analyser {
 	table := make([]*SymbolTable, 0, 2)
 	table = append(table, NewTable(nil))
 
-	return &Analyser{hadErr: false, quiet: quiet, inLoop: false, currentClass: CLASS_NONE, currentFunction: FUNCTION_NONE, table: table}
+	return &Analyser{hadErr: false, quiet: quiet, inLoop: false, currentClass: CLASS_NONE, currentFunction: FUNCTION_NONE, table: table, modules: make(map[string][]string)}
 }
 
 func (an *Analyser) Run(root ast.Node) bool {
@@ -48,13 +60,37 @@ func (an *Analyser) Run(root ast.Node) bool {
 	return !an.hadErr
 }
 
-func (an *Analyser) DeclareNativeNs(identifier string) {
+// Check statements in the global scope, keeping their declarations for later
+// checks. Used by the REPL, where each input builds on the previous ones.
+func (an *Analyser) Check(block *ast.Block) bool {
+	an.hadErr = false
+	an.visitBlock(block, false)
+	return !an.hadErr
+}
+
+// Diagnostics returns everything reported so far, even when quiet
+func (an *Analyser) Diagnostics() []*shared.Diagnostic {
+	return an.diagnostics
+}
+
+func (an *Analyser) SetQuiet(quiet bool) {
+	an.quiet = quiet
+}
+
+// Declare a native namespace, with the parameters of its functions so calls to
+// them can be checked
+func (an *Analyser) DeclareNativeNs(identifier string, functions map[string][]string) {
 	if an.lookup(identifier, true) != nil {
 		an.report(fmt.Sprintf("Item with name '%s' already exists in the current scope.", identifier))
 		return
 	}
 
-	an.top().Insert(identifier, &NameSpaceSymbol{identifier})
+	an.top().Insert(identifier, &NameSpaceSymbol{identifier: identifier, natives: functions})
+}
+
+// Make the public members of a loaded module known, so imports of it can be checked
+func (an *Analyser) DeclareModule(path string, exports []string) {
+	an.modules[path] = exports
 }
 
 func (an *Analyser) DeclareNativeClass(identifier string, fields []string) {
@@ -77,21 +113,33 @@ func (an *Analyser) DeclareNativeFn(identifier string, params []string) {
 
 // --- Private ---
 func (an *Analyser) report(msg string, args ...any) {
-	an.hadErr = true
+	an.reportDiagnostic(shared.NewDiagnostic("Analysis", msg, args...))
+}
+
+func (an *Analyser) reportT(msg string, token *lexer.Token, args ...any) {
+	an.reportDiagnostic(an.diagnostic(msg, token, args...))
+}
+
+// Warnings are reported like errors, but do not stop the program from running
+func (an *Analyser) warnDiagnostic(diagnostic *shared.Diagnostic) {
+	diagnostic.Severity = shared.SEVERITY_WARNING
+	an.diagnostics = append(an.diagnostics, diagnostic)
 
 	if !an.quiet {
-		res := fmt.Sprintf(msg, args...)
-		shared.ReportErr(res)
+		shared.Emit(diagnostic)
 	}
 }
 
-func (an *Analyser) reportT(msg string, token *lexer.Token, args ...any) {
+func (an *Analyser) diagnostic(msg string, token *lexer.Token, args ...any) *shared.Diagnostic {
+	return shared.NewDiagnostic("Analysis", msg, args...).At(token.File, token.Line, token.Column, token.Length())
+}
+
+func (an *Analyser) reportDiagnostic(diagnostic *shared.Diagnostic) {
 	an.hadErr = true
+	an.diagnostics = append(an.diagnostics, diagnostic)
 
 	if !an.quiet {
-		res := fmt.Sprintf(msg, args...)
-		res2 := fmt.Sprintf("%s [%d:%d]", res, token.Line, token.Column)
-		shared.ReportErr(res2)
+		shared.Emit(diagnostic)
 	}
 }
 
@@ -109,7 +157,10 @@ func (an *Analyser) lookup(identifier string, local bool) Symbol {
 
 func (an *Analyser) resolve(identifier *lexer.Token) {
 	if an.lookup(identifier.Lexeme, false) == nil {
-		an.reportT("Item with name '%s' does not exist in any scope.", identifier, identifier.Lexeme)
+		an.reportDiagnostic(
+			an.diagnostic("Item with name '%s' does not exist in any scope.", identifier, identifier.Lexeme).
+				Hint("declare '%s' with 'var' or 'let' before using it", identifier.Lexeme),
+		)
 	}
 }
 
@@ -136,6 +187,10 @@ func (an *Analyser) visit(node ast.Node) {
 		an.visitClassDef(n)
 	case *ast.StructDef:
 		an.visitStructDef(n)
+	case *ast.EnumDef:
+		an.declare(n.Token, &EnumDefSymbol{identifier: n.Token.Lexeme, def: n})
+	case *ast.TraitDef:
+		an.visitTraitDef(n)
 	case *ast.VariableDecl:
 		an.visitVarDecl(n)
 	case *ast.Identifier:
@@ -149,6 +204,10 @@ func (an *Analyser) visit(node ast.Node) {
 	case *ast.LogicalOp:
 		an.visit(n.Left)
 		an.visit(n.Right)
+
+		if n.Token.Kind == lexer.QUESTION_QUESTION {
+			an.checkOptional(n.Left, "??")
+		}
 	case *ast.BinaryOp:
 		an.visit(n.Left)
 		an.visit(n.Right)
@@ -162,6 +221,8 @@ func (an *Analyser) visit(node ast.Node) {
 		an.visitReturn(n)
 	case *ast.Get:
 		an.visitGet(n)
+	case *ast.Import:
+		an.visitImport(n)
 	case *ast.Set:
 		an.visitSet(n)
 	case *ast.Index:
@@ -174,14 +235,24 @@ func (an *Analyser) visit(node ast.Node) {
 		an.visitIfStmt(n)
 	case *ast.While:
 		an.visitWhileStmt(n)
+	case *ast.For:
+		an.visitFor(n)
 	case *ast.Throw:
 		an.visitThrow(n)
+	case *ast.Yield:
+		an.visitYield(n)
+	case *ast.Defer:
+		an.visitDefer(n)
 	case *ast.Catch:
 		an.visitCatch(n)
+	case *ast.ImportExpr:
+		an.visit(n.Expr)
 	case *ast.NameSpace:
 		an.visitNamespace(n)
 	case *ast.ListLiteral:
 		an.visitList(n)
+	case *ast.Range:
+		an.visitRange(n)
 	case *ast.Test:
 		an.visitTest(n)
 	case *ast.Match:
@@ -195,7 +266,6 @@ func (an *Analyser) visit(node ast.Node) {
 	// Ignore
 	case *ast.Unit:
 	case *ast.Literal:
-	case *ast.Import:
 	case *ast.NoOp:
 
 	default:
@@ -207,41 +277,52 @@ func (an *Analyser) visitFunctionDef(def *ast.FunctionDef, fnType FunctionType)
 	enclosing := an.currentFunction
 	an.currentFunction = fnType
 
+	enclosingGenerator := an.inGenerator
+	an.inGenerator = def.Generator
+
+	if def.Generator && fnType == FUNCTION_CONSTRUCTOR {
+		an.reportT("Constructors cannot yield", def.GetToken())
+	}
+
 	an.declare(def.GetToken(), &FunctionSymbol{identifier: def.GetToken().Lexeme, def: def})
+	an.visitFunctionBody(def)
+
+	an.currentFunction = enclosing
+	an.inGenerator = enclosingGenerator
+}
 
+func (an *Analyser) visitFunctionBody(def *ast.FunctionDef) {
 	// Must implement a block ourselves, so we don't mess up the current scope's symbols with params
 	an.table = append(an.table, NewTable(an.top()))
 
-	for _, param := range def.Params {
-		an.define(param.GetToken(), &VarSymbol{identifier: param.GetToken().Lexeme})
-	}
-
+	an.visitParams(def.Params)
 	an.visitBlock(def.Body, false)
 
 	an.pop()
-	an.currentFunction = enclosing
 }
 
 func (an *Analyser) visitAnonymousFn(anon *ast.AnonymousFunction) {
 	enclosing := an.currentFunction
 	an.currentFunction = FUNCTION_FUNCTION
 
+	enclosingGenerator := an.inGenerator
+	an.inGenerator = anon.Generator
+
 	an.table = append(an.table, NewTable(an.top()))
 
-	for _, param := range anon.Params {
-		an.define(param.GetToken(), &VarSymbol{identifier: param.GetToken().Lexeme})
-	}
+	an.visitParams(anon.Params)
 
 	an.visitBlock(anon.Body, false)
 
 	an.pop()
 
 	an.currentFunction = enclosing
+	an.inGenerator = enclosingGenerator
 }
 
 func (an *Analyser) visitClassDef(def *ast.ClassDef) {
-	enclosing := an.currentClass
-	an.currentClass = CLASS_CLASS
+	enclosing, enclosingDef := an.currentClass, an.currentDef
+	an.currentClass, an.currentDef = CLASS_CLASS, def
 
 	an.declare(def.Token, &ClassDefSymbol{def: def})
 
@@ -256,47 +337,252 @@ func (an *Analyser) visitClassDef(def *ast.ClassDef) {
 		an.visit(def.Base)
 	}
 
+	an.checkTraits("Class", def.Token, def.Traits, def.Methods)
+	an.checkSpecialMethods(def.Methods)
+
 	an.table = append(an.table, NewTable(an.top()))
-	an.top().Insert("self", &VarSymbol{identifier: "self", mutable: false})
+	an.top().Insert("self", &VarSymbol{identifier: "self", mutable: false, class: def})
+
+	// Assign constructor to remove resolution at run-time. This is done before
+	// visiting methods, so calls to the class within them can be checked.
+	def.Constructor = def.Methods[def.Token.Lexeme]
 
 	for id, fn := range def.Methods {
 		declaration := FUNCTION_METHOD
 
 		if id == def.Token.Lexeme {
 			declaration = FUNCTION_CONSTRUCTOR
-			// Assign constructor to remove resolution at run-time
-			def.Constructor = fn
 		}
 
 		an.visitFunctionDef(fn, declaration)
 	}
 
+	an.visitAccessors(def.Getters, "Getter", 0)
+	an.visitAccessors(def.Setters, "Setter", 1)
+
 	an.pop()
 
-	an.currentClass = enclosing
+	an.visitStatics(def)
+
+	an.currentClass, an.currentDef = enclosing, enclosingDef
+}
+
+// Accessors are methods with a fixed number of parameters. A getter and setter
+// share a name, so they are not declared like methods.
+func (an *Analyser) visitAccessors(accessors map[string]*ast.FunctionDef, kind string, arity int) {
+	enclosing := an.currentFunction
+	an.currentFunction = FUNCTION_METHOD
+
+	for _, fn := range accessors {
+		if len(fn.Params) != arity {
+			an.reportT("%s '%s' must take %d parameter(s), but takes %d.", fn.GetToken(), kind, fn.GetToken().Lexeme, arity, len(fn.Params))
+		}
+
+		an.visitFunctionBody(fn)
+	}
+
+	an.currentFunction = enclosing
+}
+
+// Static members belong to the class, so they have no 'self'
+func (an *Analyser) visitStatics(def *ast.ClassDef) {
+	an.currentClass = CLASS_STATIC
+
+	an.table = append(an.table, NewTable(an.top()))
+	defer an.pop()
+
+	for _, field := range def.StaticFields {
+		if field.Expr != nil {
+			an.visit(field.Expr)
+		}
+	}
+
+	for _, fn := range def.StaticMethods {
+		an.visitFunctionDef(fn, FUNCTION_FUNCTION)
+	}
 }
 
 func (an *Analyser) visitStructDef(def *ast.StructDef) {
-	enclosing := an.currentClass
-	an.currentClass = CLASS_STRUCT
+	enclosing, enclosingDef := an.currentClass, an.currentDef
+	an.currentClass, an.currentDef = CLASS_STRUCT, def
 
 	an.declare(def.Token, &StructDefSymbol{def: def})
 
-	if def.Constructor != nil {
-		an.table = append(an.table, NewTable(an.top()))
-		an.top().Insert("self", &VarSymbol{identifier: "self", mutable: false})
+	an.checkTraits("Struct", def.Token, def.Traits, def.Methods)
+	an.checkSpecialMethods(def.Methods)
+
+	an.table = append(an.table, NewTable(an.top()))
+	an.top().Insert("self", &VarSymbol{identifier: "self", mutable: false})
 
+	if def.Constructor != nil {
 		an.visitFunctionDef(def.Constructor, FUNCTION_CONSTRUCTOR)
+	}
 
-		an.pop()
+	for _, fn := range def.Methods {
+		an.visitFunctionDef(fn, FUNCTION_METHOD)
+	}
+
+	an.pop()
+
+	an.currentClass, an.currentDef = enclosing, enclosingDef
+}
+
+func (an *Analyser) visitTraitDef(def *ast.TraitDef) {
+	enclosing := an.currentClass
+	an.currentClass = CLASS_TRAIT
+
+	an.declare(def.Token, &TraitSymbol{identifier: def.Token.Lexeme, def: def})
+
+	an.table = append(an.table, NewTable(an.top()))
+	an.top().Insert("self", &VarSymbol{identifier: "self", mutable: false})
+
+	for _, fn := range def.Methods {
+		// Required methods only have a signature
+		if fn.Body == nil {
+			an.table = append(an.table, NewTable(an.top()))
+			an.visitParams(fn.Params)
+			an.pop()
+			continue
+		}
+
+		an.visitFunctionDef(fn, FUNCTION_METHOD)
 	}
 
+	an.pop()
+
 	an.currentClass = enclosing
 }
 
+// Special methods are called by operators and builtins, so must take what they are given
+func (an *Analyser) checkSpecialMethods(methods map[string]*ast.FunctionDef) {
+	// Go through them in the order they were written, so diagnostics are stable
+	names := make([]string, 0, len(methods))
+	for name := range methods {
+		names = append(names, name)
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		a, b := methods[names[i]].GetToken(), methods[names[j]].GetToken()
+		return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+	})
+
+	for _, name := range names {
+		method := methods[name]
+		count, ok := shared.SpecialMethods[name]
+		if !ok {
+			if strings.HasPrefix(name, "__") && strings.HasSuffix(name, "__") {
+				an.warnDiagnostic(
+					an.diagnostic("Method '%s' looks like a special method, but is not one.", method.GetToken(), name).
+						Hint("special methods are %s", specialMethodNames()),
+				)
+			}
+			continue
+		}
+
+		if len(method.Params) != count || (count > 0 && method.Params[0].Variadic) {
+			an.reportT("Special method '%s' must take %d parameter(s).", method.GetToken(), name, count)
+		}
+	}
+}
+
+// Check a class or struct provides what each of its traits require. Traits
+// reached through a namespace or module are only checked when it runs.
+func (an *Analyser) checkTraits(kind string, token *lexer.Token, traits []ast.Node, methods map[string]*ast.FunctionDef) {
+	for _, node := range traits {
+		an.visit(node)
+
+		id, ok := node.(*ast.Identifier)
+		if !ok {
+			continue
+		}
+
+		symbol := an.lookup(id.Token.Lexeme, false)
+		if symbol == nil {
+			continue
+		}
+
+		trait, ok := symbol.(*TraitSymbol)
+		if !ok {
+			an.reportT("'%s' is not a trait.", id.Token, id.Token.Lexeme)
+			continue
+		}
+
+		for _, required := range trait.def.Methods {
+			name := required.GetToken().Lexeme
+			method, ok := methods[name]
+
+			if !ok {
+				if required.Body == nil {
+					an.reportDiagnostic(
+						an.diagnostic("%s '%s' does not implement '%s' required by trait '%s'.", token, kind, token.Lexeme, name, trait.identifier).
+							Hint("add 'function %s(%s)'", name, describeParams(scriptParams(required.Params))),
+					)
+				}
+				continue
+			}
+
+			if len(method.Params) != len(required.Params) {
+				an.reportDiagnostic(
+					an.diagnostic("Method '%s' takes %d parameter(s), but trait '%s' expects %d.", method.GetToken(), name, len(method.Params), trait.identifier, len(required.Params)).
+						Hint("trait '%s' declares '%s(%s)'", trait.identifier, name, describeParams(scriptParams(required.Params))),
+				)
+			}
+		}
+	}
+}
+
 func (an *Analyser) visitVarDecl(decl *ast.VariableDecl) {
 	an.visit(decl.Expr)
-	an.declare(decl.GetToken(), &VarSymbol{identifier: decl.GetToken().Lexeme, mutable: decl.Mutable})
+
+	if decl.Constant {
+		sym := &VarSymbol{identifier: decl.GetToken().Lexeme}
+
+		if literal := an.foldConstant(decl); literal != nil {
+			decl.Expr = literal
+			sym.constant = literal
+		}
+
+		an.declare(decl.GetToken(), sym)
+		return
+	}
+
+	if decl.Pattern == nil {
+		sym := &VarSymbol{identifier: decl.GetToken().Lexeme, mutable: decl.Mutable}
+
+		// Only 'let' keeps the instance it was given
+		if !decl.Mutable {
+			sym.class = an.instanceOf(decl.Expr)
+		}
+
+		an.declare(decl.GetToken(), sym)
+		return
+	}
+
+	an.visitPattern(decl.Pattern, decl.Expr)
+
+	for _, identifier := range decl.Pattern.Identifiers() {
+		an.declare(identifier, &VarSymbol{identifier: identifier.Lexeme, mutable: decl.Mutable})
+	}
+}
+
+// Check what can be known about a pattern before running it
+func (an *Analyser) visitPattern(pattern *ast.Pattern, expr ast.Node) {
+	list, ok := expr.(*ast.ListLiteral)
+	if !ok {
+		return
+	}
+
+	if pattern.Kind == ast.PATTERN_FIELDS {
+		an.reportT("Cannot take fields from a list.", pattern.Token)
+		return
+	}
+
+	if len(list.Exprs) < len(pattern.Names) || (pattern.Rest == nil && len(list.Exprs) > len(pattern.Names)) {
+		an.reportDiagnostic(
+			an.diagnostic("Cannot destructure %d value(s) into %d name(s).", pattern.Token, len(list.Exprs), len(pattern.Names)).
+				Hint("use '...rest' to capture the values left over"),
+		)
+	}
 }
 
 func (an *Analyser) visitIdentifier(id *ast.Identifier) {
@@ -324,26 +610,187 @@ func (an *Analyser) visitArgument(arg *ast.Argument) {
 	an.visit(arg.Expr)
 }
 
+// Defaults are visited before their parameter is defined, so they can only
+// refer to the parameters before them
+func (an *Analyser) visitParams(params []*ast.Parameter) {
+	for _, param := range params {
+		if param.Default != nil {
+			an.visit(param.Default)
+		}
+
+		an.define(param.GetToken(), &VarSymbol{identifier: param.GetToken().Lexeme})
+	}
+}
+
 func (an *Analyser) visitCall(call *ast.Call) {
 	an.visit(call.Callee)
 
+	if call.Optional {
+		an.checkOptional(call.Callee, "?.()")
+	}
+
 	for _, expr := range call.Arguments {
 		an.visit(expr)
 	}
+
+	if enum, variant := an.variant(call.Callee); variant != nil && variant.Fields == nil {
+		an.reportT("Variant '%s.%s' has no payload, so it cannot be called.", call.Token, enum.identifier, variant.Token.Lexeme)
+		return
+	}
+
+	if params, ok := an.signature(call.Callee); ok {
+		an.checkArguments(call, params)
+	}
+}
+
+// Find the enum variant a node refers to, when it is known statically
+func (an *Analyser) variant(node ast.Node) (*EnumDefSymbol, *ast.Variant) {
+	get, ok := node.(*ast.Get)
+	if !ok {
+		return nil, nil
+	}
+
+	id, ok := get.Expr.(*ast.Identifier)
+	if !ok {
+		return nil, nil
+	}
+
+	enum, ok := an.lookup(id.Token.Lexeme, false).(*EnumDefSymbol)
+	if !ok {
+		return nil, nil
+	}
+
+	return enum, enum.variant(get.Token.Lexeme)
+}
+
+// Find the parameters of what is being called, when it is known statically
+func (an *Analyser) signature(callee ast.Node) ([]param, bool) {
+	switch n := callee.(type) {
+	case *ast.Identifier:
+		switch symbol := an.lookup(n.Token.Lexeme, false).(type) {
+		case *FunctionSymbol:
+			return scriptParams(symbol.def.Params), true
+		case *ClassDefSymbol:
+			return constructorParams(symbol.def.Constructor), true
+		case *StructDefSymbol:
+			return constructorParams(symbol.def.Constructor), true
+		case *NativeFunctionSymbol:
+			return nativeParams(symbol.params), true
+		}
+
+	case *ast.Get:
+		if _, variant := an.variant(n); variant != nil {
+			return variantParams(variant), true
+		}
+
+		id, ok := n.Expr.(*ast.Identifier)
+		if !ok {
+			return nil, false
+		}
+
+		switch symbol := an.lookup(id.Token.Lexeme, false).(type) {
+		case *NameSpaceSymbol:
+			if specs, ok := symbol.natives[n.Token.Lexeme]; ok {
+				return nativeParams(specs), true
+			}
+		case *ClassDefSymbol:
+			if fn, ok := symbol.def.StaticMethods[n.Token.Lexeme]; ok {
+				return scriptParams(fn.Params), true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+func (an *Analyser) checkArguments(call *ast.Call, params []param) {
+	positional := 0
+	given := make(map[string]bool)
+
+	for _, arg := range call.Arguments {
+		argument, ok := arg.(*ast.Argument)
+		if !ok {
+			positional++
+			continue
+		}
+
+		name := argument.Token.Lexeme
+		position := -1
+
+		for idx, param := range params {
+			if param.name == name {
+				position = idx
+				break
+			}
+		}
+
+		switch {
+		case position < 0:
+			an.reportDiagnostic(
+				an.diagnostic("Function '%s' has no parameter named '%s'.", argument.Token, call.Token.Lexeme, name).
+					Hint("it takes (%s)", describeParams(params)),
+			)
+		case params[position].variadic:
+			an.reportT("Variadic parameter '%s' cannot be given by name.", argument.Token, name)
+		case position < positional || given[name]:
+			an.reportT("Argument '%s' is given more than once.", argument.Token, name)
+		}
+
+		given[name] = true
+	}
+
+	fixed := len(params)
+	if fixed > 0 && params[fixed-1].variadic {
+		fixed--
+	} else if positional > fixed {
+		an.reportT("Function '%s' takes at most %d arguments but received %d.", call.Token, call.Token.Lexeme, fixed, positional)
+		return
+	}
+
+	for idx, param := range params[:fixed] {
+		if !param.optional && idx >= positional && !given[param.name] {
+			an.reportT("Function '%s' is missing an argument for '%s'.", call.Token, call.Token.Lexeme, param.name)
+		}
+	}
 }
 
 func (an *Analyser) visitAssign(assign *ast.Assign) {
-	an.resolve(assign.GetToken())
+	if assign.Pattern == nil {
+		an.assignable(assign.GetToken())
+		an.visit(assign.Expr)
+		return
+	}
+
+	assigned := make(map[string]bool)
 
-	if sym, ok := an.lookup(assign.GetToken().Lexeme, false).(*VarSymbol); ok {
-		if !sym.mutable {
-			an.reportT("Cannot assign to immutable value '%s'.", assign.GetToken(), assign.GetToken().Lexeme)
+	for _, identifier := range assign.Pattern.Identifiers() {
+		if assigned[identifier.Lexeme] {
+			an.reportT("'%s' is assigned more than once.", identifier, identifier.Lexeme)
 		}
-	} else {
-		an.reportT("'%s' is not a variable, you cannot assign to it.", assign.GetToken(), assign.GetToken().Lexeme)
+
+		assigned[identifier.Lexeme] = true
+		an.assignable(identifier)
 	}
 
 	an.visit(assign.Expr)
+	an.visitPattern(assign.Pattern, assign.Expr)
+}
+
+func (an *Analyser) assignable(identifier *lexer.Token) {
+	an.resolve(identifier)
+
+	if sym, ok := an.lookup(identifier.Lexeme, false).(*VarSymbol); ok {
+		if sym.constant != nil {
+			an.reportT("Cannot assign to constant '%s'.", identifier, identifier.Lexeme)
+		} else if !sym.mutable {
+			an.reportDiagnostic(
+				an.diagnostic("Cannot assign to immutable value '%s'.", identifier, identifier.Lexeme).
+					Hint("declare '%s' with 'var' to allow reassignment", identifier.Lexeme),
+			)
+		}
+	} else {
+		an.reportT("'%s' is not a variable, you cannot assign to it.", identifier, identifier.Lexeme)
+	}
 }
 
 func (an *Analyser) visitReturn(ret *ast.Return) {
@@ -352,33 +799,284 @@ func (an *Analyser) visitReturn(ret *ast.Return) {
 		return
 	}
 
+	if an.currentFunction == FUNCTION_DEFER {
+		an.reportT("Cannot return from a deferred statement", ret.Token)
+	}
+
 	if ret.Expr != nil {
+		if an.inGenerator && an.currentFunction != FUNCTION_CATCH {
+			an.reportDiagnostic(an.diagnostic("Generators cannot return a value", ret.Token).
+				Hint("use 'yield' to produce a value, or 'return;' to finish"))
+		}
+
 		an.visit(ret.Expr)
 	}
 }
 
 func (an *Analyser) visitGet(get *ast.Get) {
 	an.visit(get.Expr)
+
+	if get.Optional {
+		an.checkOptional(get.Expr, "?.")
+	}
+
+	an.checkVisible(get.Expr, get.Token)
+	an.checkInstanceStatic(get.Expr, get.Token)
+
+	id, ok := get.Expr.(*ast.Identifier)
+	if !ok {
+		return
+	}
+
+	if enum, ok := an.lookup(id.Token.Lexeme, false).(*EnumDefSymbol); ok {
+		if enum.variant(get.Token.Lexeme) == nil {
+			an.reportDiagnostic(
+				an.diagnostic("Enum '%s' has no variant '%s'", get.Token, enum.identifier, get.Token.Lexeme).
+					Hint("its variants are: %s", variantNames(enum.def.Variants)),
+			)
+		}
+		return
+	}
+
+	if class, ok := an.lookup(id.Token.Lexeme, false).(*ClassDefSymbol); ok {
+		an.checkStatic(class.def, get.Token)
+		return
+	}
+
+	ns, ok := an.lookup(id.Token.Lexeme, false).(*NameSpaceSymbol)
+	if !ok || ns.members == nil {
+		return
+	}
+
+	for _, member := range ns.members {
+		if member == get.Token.Lexeme {
+			return
+		}
+	}
+
+	an.reportDiagnostic(
+		an.diagnostic("Module '%s' has no public member '%s'", get.Token, ns.identifier, get.Token.Lexeme).
+			Hint("mark it with 'pub' in the imported file to use it here"),
+	)
+}
+
+// Private members can only be used from within their class or struct, and
+// never through a namespace. Instances are only known here when they are
+// constructed in place, the rest are checked while running.
+func (an *Analyser) checkVisible(target ast.Node, member *lexer.Token) {
+	var kind, owner string
+	var private map[string]bool
+	var def ast.Node
+
+	switch n := target.(type) {
+	case *ast.Identifier:
+		switch symbol := an.lookup(n.Token.Lexeme, false).(type) {
+		case *ClassDefSymbol:
+			// Members which are not static are reported as missing instead
+			if !symbol.def.IsStatic(member.Lexeme) {
+				return
+			}
+
+			kind, owner, private, def = "class", symbol.def.Token.Lexeme, symbol.def.Private, symbol.def
+		case *NameSpaceSymbol:
+			kind, owner, private = "namespace", symbol.identifier, symbol.private
+		}
+
+	case *ast.Call:
+		callee, ok := n.Callee.(*ast.Identifier)
+		if !ok {
+			return
+		}
+
+		switch symbol := an.lookup(callee.Token.Lexeme, false).(type) {
+		case *ClassDefSymbol:
+			kind, owner, private, def = "class", symbol.def.Token.Lexeme, symbol.def.Private, symbol.def
+		case *StructDefSymbol:
+			kind, owner, private, def = "struct", symbol.def.Token.Lexeme, symbol.def.Private, symbol.def
+		}
+	}
+
+	if !private[member.Lexeme] || (def != nil && an.currentDef == def) {
+		return
+	}
+
+	diagnostic := an.diagnostic("'%s' is private to %s '%s'.", member, member.Lexeme, kind, owner)
+
+	if kind == "namespace" {
+		diagnostic.Hint("use '%s' by name from within the namespace, or remove 'priv' to share it", member.Lexeme)
+	} else {
+		diagnostic.Hint("only the functions of '%s' can use it, or remove 'priv' to share it", owner)
+	}
+
+	an.reportDiagnostic(diagnostic)
+}
+
+// Only static members can be reached through the class itself
+func (an *Analyser) checkStatic(def *ast.ClassDef, member *lexer.Token) {
+	if def.IsStatic(member.Lexeme) {
+		return
+	}
+
+	diagnostic := an.diagnostic("Class '%s' has no static member '%s'.", member, def.Token.Lexeme, member.Lexeme)
+
+	if base := an.staticBase(def, member.Lexeme); base != nil {
+		diagnostic.Hint("static members are not inherited, so reach it through '%s.%s'", base.Token.Lexeme, member.Lexeme)
+	} else {
+		diagnostic.Hint("mark it with 'static' to reach it through the class")
+	}
+
+	an.reportDiagnostic(diagnostic)
+}
+
+// The class of an instance, when it is known before running. That is when
+// it is constructed in place, is 'self' within a class, or was given to a
+// 'let' from a constructor call.
+func (an *Analyser) instanceOf(node ast.Node) *ast.ClassDef {
+	switch n := node.(type) {
+	case *ast.Call:
+		if callee, ok := n.Callee.(*ast.Identifier); ok {
+			if symbol, ok := an.lookup(callee.Token.Lexeme, false).(*ClassDefSymbol); ok {
+				return symbol.def
+			}
+		}
+	case *ast.Identifier:
+		if symbol, ok := an.lookup(n.Token.Lexeme, false).(*VarSymbol); ok {
+			return symbol.class
+		}
+	}
+
+	return nil
+}
+
+// Static members are only reached through the class declaring them, never
+// through an instance
+func (an *Analyser) checkInstanceStatic(target ast.Node, member *lexer.Token) {
+	def := an.instanceOf(target)
+	if def == nil {
+		return
+	}
+
+	owner := def
+	if !def.IsStatic(member.Lexeme) {
+		// An instance member of its own hides one a base made static
+		if def.HasMember(member.Lexeme) {
+			return
+		}
+
+		if owner = an.staticBase(def, member.Lexeme); owner == nil {
+			return
+		}
+	}
+
+	an.reportDiagnostic(
+		an.diagnostic("Static member '%s' must be accessed through the class '%s'", member, member.Lexeme, owner.Token.Lexeme).
+			Hint("write '%s.%s' instead", owner.Token.Lexeme, member.Lexeme),
+	)
+}
+
+// The base class a static member was declared in, as statics are not
+// inherited and must be reached through the class declaring them
+func (an *Analyser) staticBase(def *ast.ClassDef, name string) *ast.ClassDef {
+	seen := map[*ast.ClassDef]bool{def: true}
+
+	for def.Base != nil {
+		id, ok := def.Base.(*ast.Identifier)
+		if !ok {
+			return nil
+		}
+
+		symbol, ok := an.lookup(id.Token.Lexeme, false).(*ClassDefSymbol)
+		if !ok || seen[symbol.def] {
+			return nil
+		}
+
+		if symbol.def.IsStatic(name) {
+			return symbol.def
+		}
+
+		def = symbol.def
+		seen[def] = true
+	}
+
+	return nil
+}
+
+func (an *Analyser) visitImport(imp *ast.Import) {
+	an.declare(imp.Alias, &NameSpaceSymbol{identifier: imp.Alias.Lexeme, members: an.modules[imp.Path]})
 }
 
 func (an *Analyser) visitSet(set *ast.Set) {
+	if set.Optional {
+		an.reportOptionalAssign(set.Token, "?.")
+	}
+
 	an.visit(set.Caller)
 	an.visit(set.Expr)
+
+	an.checkVisible(set.Caller, set.Token)
+	an.checkInstanceStatic(set.Caller, set.Token)
+
+	id, ok := set.Caller.(*ast.Identifier)
+	if !ok {
+		return
+	}
+
+	if class, ok := an.lookup(id.Token.Lexeme, false).(*ClassDefSymbol); ok {
+		if _, ok := class.def.StaticFields[set.Token.Lexeme]; !ok {
+			diagnostic := an.diagnostic("Class '%s' has no static field '%s'.", set.Token, class.def.Token.Lexeme, set.Token.Lexeme)
+
+			if base := an.staticBase(class.def, set.Token.Lexeme); base != nil {
+				diagnostic.Hint("static members are not inherited, so assign it through '%s.%s'", base.Token.Lexeme, set.Token.Lexeme)
+			} else {
+				diagnostic.Hint("declare it with 'static var' to assign it through the class")
+			}
+
+			an.reportDiagnostic(diagnostic)
+		}
+	}
 }
 
 func (an *Analyser) visitIndex(index *ast.Index) {
 	an.visit(index.Caller)
 	an.visit(index.Expr)
+
+	if index.Optional {
+		an.checkOptional(index.Caller, "?[")
+	}
 }
 
 func (an *Analyser) visitIndexSet(iset *ast.IndexSet) {
+	if iset.Idx.Optional {
+		an.reportOptionalAssign(iset.Idx.GetToken(), "?[")
+	}
+
 	an.visit(iset.Idx)
 	an.visit(iset.Expr)
 }
 
+// Optional operators only do something when a value can be unit
+func (an *Analyser) checkOptional(node ast.Node, operator string) {
+	switch node.(type) {
+	case *ast.Literal, *ast.ListLiteral, *ast.Range, *ast.AnonymousFunction:
+		an.warnDiagnostic(an.diagnostic("Value is never unit, so '%s' has no effect.", node.GetToken(), operator))
+	}
+}
+
+func (an *Analyser) reportOptionalAssign(token *lexer.Token, operator string) {
+	an.reportDiagnostic(
+		an.diagnostic("Cannot assign through '%s', as there may be nothing to assign to.", token, operator).
+			Hint("check the value with 'builtin.is_unit' first"))
+}
+
 func (an *Analyser) visitSelf(self *ast.Self) {
-	if an.currentClass == CLASS_NONE {
+	switch an.currentClass {
+	case CLASS_NONE:
 		an.report("Cannot use 'self' outside of a class.")
+	case CLASS_STATIC:
+		an.reportDiagnostic(
+			an.diagnostic("Cannot use 'self' in a static member.", self.Token).
+				Hint("static members belong to the class, so there is no instance to refer to"),
+		)
 	}
 }
 
@@ -420,6 +1118,26 @@ func (an *Analyser) visitWhileStmt(stmt *ast.While) {
 	an.inLoop = enclosing
 }
 
+func (an *Analyser) visitFor(stmt *ast.For) {
+	enclosing := an.inLoop
+	an.inLoop = true
+
+	// The names are only bound inside the loop, so cannot be used by the iterable
+	an.visit(stmt.Iterable)
+
+	an.table = append(an.table, NewTable(an.top()))
+	defer an.pop()
+
+	if stmt.Index != nil {
+		an.declare(stmt.Index, &VarSymbol{identifier: stmt.Index.Lexeme, mutable: false})
+	}
+	an.declare(stmt.Item, &VarSymbol{identifier: stmt.Item.Lexeme, mutable: false})
+
+	an.visit(stmt.Body)
+
+	an.inLoop = enclosing
+}
+
 func (an *Analyser) visitThrow(throw *ast.Throw) {
 	if an.currentFunction == FUNCTION_NONE {
 		an.report("Cannot use 'throw' outside of a function.")
@@ -428,6 +1146,39 @@ func (an *Analyser) visitThrow(throw *ast.Throw) {
 	an.visit(throw.Expr)
 }
 
+func (an *Analyser) visitYield(yield *ast.Yield) {
+	if !an.inGenerator {
+		an.reportT("Cannot use 'yield' outside of a function.", yield.Token)
+	}
+
+	an.visit(yield.Expr)
+}
+
+// Deferred statements run as the function exits, so cannot leave it or the
+// loop they were written in
+func (an *Analyser) visitDefer(stmt *ast.Defer) {
+	switch an.currentFunction {
+	case FUNCTION_NONE:
+		an.reportT("Cannot use 'defer' outside of a function.", stmt.Token)
+	case FUNCTION_DEFER:
+		an.reportT("Cannot use 'defer' within a deferred statement.", stmt.Token)
+	}
+
+	enclosing := an.currentFunction
+	enclosingLoop := an.inLoop
+	enclosingGenerator := an.inGenerator
+
+	an.currentFunction = FUNCTION_DEFER
+	an.inLoop = false
+	an.inGenerator = false
+
+	an.visit(stmt.Body)
+
+	an.currentFunction = enclosing
+	an.inLoop = enclosingLoop
+	an.inGenerator = enclosingGenerator
+}
+
 func (an *Analyser) visitCatch(catch *ast.Catch) {
 	an.table = append(an.table, NewTable(an.top()))
 	enclosing := an.currentFunction
@@ -443,11 +1194,16 @@ func (an *Analyser) visitCatch(catch *ast.Catch) {
 	an.visitBlock(catch.Body, false)
 
 	an.pop()
+
+	if catch.Finally != nil {
+		an.visitBlock(catch.Finally, true)
+	}
+
 	an.currentFunction = enclosing
 }
 
 func (an *Analyser) visitNamespace(ns *ast.NameSpace) {
-	an.declare(ns.Token, &NameSpaceSymbol{identifier: ns.Token.Lexeme})
+	an.declare(ns.Token, &NameSpaceSymbol{identifier: ns.Token.Lexeme, private: ns.Private})
 	an.visitBlock(ns.Body, true)
 }
 
@@ -457,6 +1213,18 @@ func (an *Analyser) visitList(list *ast.ListLiteral) {
 	}
 }
 
+func (an *Analyser) visitRange(expr *ast.Range) {
+	for _, node := range []ast.Node{expr.Start, expr.End, expr.Step} {
+		if node != nil {
+			an.visit(node)
+		}
+	}
+
+	if step, ok := expr.Step.(*ast.Literal); ok && step.Token.Lexeme == "0" {
+		an.reportT("Range step cannot be 0.", step.Token)
+	}
+}
+
 func (an *Analyser) visitTest(test *ast.Test) {
 	enclosing := an.currentFunction
 	an.currentFunction = FUNCTION_TEST
@@ -472,13 +1240,66 @@ func (an *Analyser) visitMatchCase(match *ast.Match) {
 	an.table = append(an.table, NewTable(an.top()))
 	defer an.pop()
 
+	// Matches on the variants of a single enum can be checked for ones left out
+	var matched *EnumDefSymbol
+	covered := make(map[string]bool)
+	exhaustible := true
+
 	for _, expr := range match.Cases {
 		an.visit(expr.Expr)
+
+		enum, variant := an.variant(expr.Expr)
+
+		if variant == nil || (matched != nil && matched != enum) {
+			exhaustible = false
+		} else {
+			matched = enum
+			covered[variant.Token.Lexeme] = true
+		}
+
+		if expr.Bindings == nil {
+			an.visit(expr.Body)
+			continue
+		}
+
+		if variant != nil && variant.Fields == nil {
+			an.reportT("Variant '%s.%s' has no payload to destructure.", expr.Token, enum.identifier, variant.Token.Lexeme)
+		} else if variant != nil && len(variant.Fields) != len(expr.Bindings) {
+			an.reportT("Variant '%s.%s' has %d field(s) but %d name(s) were given.", expr.Token, enum.identifier, variant.Token.Lexeme, len(variant.Fields), len(expr.Bindings))
+		}
+
+		an.table = append(an.table, NewTable(an.top()))
+
+		for _, binding := range expr.Bindings {
+			an.define(binding, &VarSymbol{identifier: binding.Lexeme})
+		}
+
 		an.visit(expr.Body)
+		an.pop()
 	}
 
 	if match.CatchAll != nil {
 		an.visit(match.CatchAll)
+		return
+	}
+
+	if matched == nil || !exhaustible {
+		return
+	}
+
+	missing := make([]*ast.Variant, 0)
+
+	for _, variant := range matched.def.Variants {
+		if !covered[variant.Token.Lexeme] {
+			missing = append(missing, variant)
+		}
+	}
+
+	if len(missing) > 0 {
+		an.warnDiagnostic(
+			an.diagnostic("Match on enum '%s' does not handle: %s", match.Token, matched.identifier, variantNames(missing)).
+				Hint("add arms for the missing variants, or a 'catch' arm for the rest"),
+		)
 	}
 }
 
@@ -1,6 +1,7 @@
 package analysis
 
 import (
+	"strings"
 	"testing"
 	"tiny/parser"
 	"tiny/shared"
@@ -12,10 +13,37 @@ func eq(t *testing.T, value bool, expected bool, msg string) {
 	}
 }
 
+type expected struct {
+	line, column int
+	severity     shared.Severity
+	message      string
+}
+
+// Each diagnostic must match in order, so a wrong message or position is
+// caught as well as a missing one
+func expectDiagnostics(t *testing.T, diagnostics []*shared.Diagnostic, expected []expected) {
+	t.Helper()
+
+	if len(diagnostics) != len(expected) {
+		for _, diagnostic := range diagnostics {
+			t.Log(diagnostic.String())
+		}
+		t.Fatalf("Expected %d diagnostics but received %d", len(expected), len(diagnostics))
+	}
+
+	for idx, diagnostic := range diagnostics {
+		want := expected[idx]
+
+		if diagnostic.Line != want.line || diagnostic.Column != want.column || diagnostic.Severity != want.severity || diagnostic.Message != want.message {
+			t.Errorf("Unexpected %s '%s' expected %s '%s' [%d:%d]", diagnostic.Severity, diagnostic.String(), want.severity, want.message, want.line, want.column)
+		}
+	}
+}
+
 func TestIdentifierLookup(t *testing.T) {
 	path := "../tests/valid/analyser/identifier_lookup_assign.tiny"
 	source := shared.ReadFile(path)
-	program := parser.New(source, path, false).Parse()
+	program, _ := parser.New(source, path, false).Parse()
 	analyser := NewAnalyser(true)
 
 	eq(t, analyser.Run(program.Body), true, "ID lookup failed")
@@ -24,18 +52,250 @@ func TestIdentifierLookup(t *testing.T) {
 func TestFunctionScope(t *testing.T) {
 	path := "../tests/valid/analyser/function_scope.tiny"
 	source := shared.ReadFile(path)
-	program := parser.New(source, path, false).Parse()
+	program, _ := parser.New(source, path, false).Parse()
 	analyser := NewAnalyser(true)
 
 	eq(t, analyser.Run(program.Body), true, "Could not resolve ID from function scope")
 }
 
+func TestNonExhaustiveMatch(t *testing.T) {
+	path := "../tests/valid/enums/non_exhaustive.tiny"
+	source := shared.ReadFile(path)
+	program, _ := parser.New(source, path, false).Parse()
+	analyser := NewAnalyser(true)
+
+	eq(t, analyser.Run(program.Body), true, "Non-exhaustive match should only warn")
+
+	diagnostics := analyser.Diagnostics()
+	if len(diagnostics) != 1 || diagnostics[0].Severity != shared.SEVERITY_WARNING {
+		t.Fatalf("Expected a single warning but received %v", diagnostics)
+	}
+}
+
 // --- Invalid ---
 func TestInvalidIdentifierLookup(t *testing.T) {
 	path := "../tests/invalid/analyser/identifier_lookup_assign.tiny"
 	source := shared.ReadFile(path)
-	program := parser.New(source, path, false).Parse()
+	program, _ := parser.New(source, path, false).Parse()
 	analyser := NewAnalyser(false)
 
 	eq(t, analyser.Run(program.Body), false, "ID lookup failed")
 }
+
+func TestInvalidPatterns(t *testing.T) {
+	path := "../tests/invalid/destructuring/analysis.tiny"
+	source := shared.ReadFile(path)
+	program, _ := parser.New(source, path, false).Parse()
+	analyser := NewAnalyser(true)
+
+	eq(t, analyser.Run(program.Body), false, "Invalid patterns were accepted")
+
+	expectDiagnostics(t, analyser.Diagnostics(), []expected{
+		{1, 5, shared.SEVERITY_ERROR, "Cannot destructure 3 value(s) into 2 name(s)."},
+		{2, 5, shared.SEVERITY_ERROR, "Cannot take fields from a list."},
+		{6, 1, shared.SEVERITY_ERROR, "Cannot assign to immutable value 'c'."},
+		{7, 4, shared.SEVERITY_ERROR, "'d' is assigned more than once."},
+	})
+}
+
+func TestInvalidArguments(t *testing.T) {
+	path := "../tests/invalid/params/analysis.tiny"
+	source := shared.ReadFile(path)
+	program, _ := parser.New(source, path, false).Parse()
+	analyser := NewAnalyser(true)
+
+	eq(t, analyser.Run(program.Body), false, "Invalid arguments were accepted")
+
+	expectDiagnostics(t, analyser.Diagnostics(), []expected{
+		{17, 1, shared.SEVERITY_ERROR, "Function 'greet' is missing an argument for 'name'."},
+		{18, 1, shared.SEVERITY_ERROR, "Function 'greet' takes at most 2 arguments but received 3."},
+		{19, 12, shared.SEVERITY_ERROR, "Function 'greet' has no parameter named 'title'."},
+		{20, 12, shared.SEVERITY_ERROR, "Argument 'name' is given more than once."},
+		{21, 5, shared.SEVERITY_ERROR, "Variadic parameter 'values' cannot be given by name."},
+		{22, 1, shared.SEVERITY_ERROR, "Function 'Point' is missing an argument for 'x'."},
+	})
+}
+
+func TestInvalidEnums(t *testing.T) {
+	path := "../tests/invalid/enums/analysis.tiny"
+	source := shared.ReadFile(path)
+	program, _ := parser.New(source, path, false).Parse()
+	analyser := NewAnalyser(true)
+
+	eq(t, analyser.Run(program.Body), false, "Invalid enum uses were accepted")
+
+	expectDiagnostics(t, analyser.Diagnostics(), []expected{
+		{3, 15, shared.SEVERITY_ERROR, "Enum 'Shape' has no variant 'Square'"},
+		{4, 15, shared.SEVERITY_ERROR, "Variant 'Shape.Empty' has no payload, so it cannot be called."},
+		{5, 15, shared.SEVERITY_ERROR, "Function 'Rect' is missing an argument for 'h'."},
+		{9, 3, shared.SEVERITY_ERROR, "Variant 'Shape.Rect' has 2 field(s) but 1 name(s) were given."},
+		{10, 3, shared.SEVERITY_ERROR, "Variant 'Shape.Empty' has no payload to destructure."},
+	})
+}
+
+func TestInvalidTraits(t *testing.T) {
+	path := "../tests/invalid/traits/analysis.tiny"
+	source := shared.ReadFile(path)
+	program, _ := parser.New(source, path, false).Parse()
+	analyser := NewAnalyser(true)
+
+	eq(t, analyser.Run(program.Body), false, "Missing trait methods were accepted")
+
+	expectDiagnostics(t, analyser.Diagnostics(), []expected{
+		{6, 7, shared.SEVERITY_ERROR, "Class 'Square' does not implement 'scale' required by trait 'Shape'."},
+		{12, 11, shared.SEVERITY_ERROR, "Method 'scale' takes 0 parameter(s), but trait 'Shape' expects 1."},
+		{17, 19, shared.SEVERITY_ERROR, "'value' is not a trait."},
+	})
+}
+
+func TestInvalidSpecialMethods(t *testing.T) {
+	path := "../tests/invalid/operators/analysis.tiny"
+	source := shared.ReadFile(path)
+	program, _ := parser.New(source, path, false).Parse()
+	analyser := NewAnalyser(true)
+
+	eq(t, analyser.Run(program.Body), false, "Special methods with the wrong arity were accepted")
+
+	expectDiagnostics(t, analyser.Diagnostics(), []expected{
+		{2, 11, shared.SEVERITY_ERROR, "Special method '__add__' must take 1 parameter(s)."},
+		{3, 11, shared.SEVERITY_ERROR, "Special method '__str__' must take 0 parameter(s)."},
+		{7, 11, shared.SEVERITY_ERROR, "Special method '__eq__' must take 1 parameter(s)."},
+	})
+}
+
+func TestInvalidLoops(t *testing.T) {
+	path := "../tests/invalid/loops/analysis.tiny"
+	source := shared.ReadFile(path)
+	program, _ := parser.New(source, path, false).Parse()
+	analyser := NewAnalyser(true)
+
+	eq(t, analyser.Run(program.Body), false, "Loop names were usable outside of the loop")
+
+	expectDiagnostics(t, analyser.Diagnostics(), []expected{
+		{2, 2, shared.SEVERITY_ERROR, "Cannot assign to immutable value 'x'."},
+		{5, 7, shared.SEVERITY_ERROR, "Item with name 'x' does not exist in any scope."},
+	})
+}
+
+func TestInvalidRanges(t *testing.T) {
+	path := "../tests/invalid/ranges/analysis.tiny"
+	source := shared.ReadFile(path)
+	program, _ := parser.New(source, path, false).Parse()
+	analyser := NewAnalyser(true)
+
+	eq(t, analyser.Run(program.Body), false, "Range with a step of 0 was accepted")
+
+	expectDiagnostics(t, analyser.Diagnostics(), []expected{
+		{1, 24, shared.SEVERITY_ERROR, "Range step cannot be 0."},
+	})
+}
+
+func TestInvalidGenerators(t *testing.T) {
+	path := "../tests/invalid/generators/analysis.tiny"
+	source := shared.ReadFile(path)
+	program, _ := parser.New(source, path, false).Parse()
+	analyser := NewAnalyser(true)
+
+	eq(t, analyser.Run(program.Body), false, "Yield outside of a generator was accepted")
+
+	expectDiagnostics(t, analyser.Diagnostics(), []expected{
+		{1, 1, shared.SEVERITY_ERROR, "Cannot use 'yield' outside of a function."},
+		{5, 2, shared.SEVERITY_ERROR, "Generators cannot return a value"},
+		{9, 11, shared.SEVERITY_ERROR, "Constructors cannot yield"},
+	})
+}
+
+func TestInvalidDefer(t *testing.T) {
+	path := "../tests/invalid/defer/analysis.tiny"
+	source := shared.ReadFile(path)
+	program, _ := parser.New(source, path, false).Parse()
+	analyser := NewAnalyser(true)
+
+	eq(t, analyser.Run(program.Body), false, "Deferred statements leaving their function were accepted")
+
+	expectDiagnostics(t, analyser.Diagnostics(), []expected{
+		{1, 1, shared.SEVERITY_ERROR, "Cannot use 'defer' outside of a function."},
+		{5, 3, shared.SEVERITY_ERROR, "Cannot return from a deferred statement"},
+		{11, 9, shared.SEVERITY_ERROR, "Cannot use break or continue outside of a loop"},
+	})
+}
+
+func TestInvalidOptional(t *testing.T) {
+	path := "../tests/invalid/optional/analysis.tiny"
+	source := shared.ReadFile(path)
+	program, _ := parser.New(source, path, false).Parse()
+	analyser := NewAnalyser(true)
+
+	eq(t, analyser.Run(program.Body), false, "Assigning through an optional chain was accepted")
+
+	expectDiagnostics(t, analyser.Diagnostics(), []expected{
+		{4, 10, shared.SEVERITY_ERROR, "Cannot assign through '?.', as there may be nothing to assign to."},
+		{5, 1, shared.SEVERITY_ERROR, "Cannot assign through '?[', as there may be nothing to assign to."},
+		{7, 12, shared.SEVERITY_WARNING, "Value is never unit, so '??' has no effect."},
+		{8, 13, shared.SEVERITY_WARNING, "Value is never unit, so '?[' has no effect."},
+	})
+}
+
+func TestInvalidConst(t *testing.T) {
+	path := "../tests/invalid/const/analysis.tiny"
+	source := shared.ReadFile(path)
+	program, _ := parser.New(source, path, false).Parse()
+	analyser := NewAnalyser(true)
+
+	eq(t, analyser.Run(program.Body), false, "Constants which cannot be folded were accepted")
+
+	expectDiagnostics(t, analyser.Diagnostics(), []expected{
+		{7, 15, shared.SEVERITY_ERROR, "Constant 'WIDTH' must be known before running, but 'width' is not."},
+		{8, 16, shared.SEVERITY_ERROR, "Constant 'HEIGHT' must be known before running, but 'height' is not."},
+		{9, 15, shared.SEVERITY_ERROR, "Constant 'ITEMS' must be known before running, but '[' is not."},
+		{10, 17, shared.SEVERITY_ERROR, "Invalid operation '+' in constant 'MIXED'."},
+		{11, 18, shared.SEVERITY_ERROR, "Division by zero in constant 'BROKEN'."},
+		{14, 1, shared.SEVERITY_ERROR, "Cannot assign to constant 'SIZE'."},
+	})
+}
+
+func TestInvalidStatic(t *testing.T) {
+	path := "../tests/invalid/static/analysis.tiny"
+	source := shared.ReadFile(path)
+	program, _ := parser.New(source, path, false).Parse()
+	analyser := NewAnalyser(true)
+
+	eq(t, analyser.Run(program.Body), false, "Invalid static members and accessors were accepted")
+
+	expectDiagnostics(t, analyser.Diagnostics(), []expected{
+		{10, 6, shared.SEVERITY_ERROR, "Getter 'value' must take 0 parameter(s), but takes 1."},
+		{14, 6, shared.SEVERITY_ERROR, "Setter 'value' must take 1 parameter(s), but takes 0."},
+		{7, 3, shared.SEVERITY_ERROR, "Cannot use 'self' in a static member."},
+		{21, 9, shared.SEVERITY_ERROR, "Class 'Counter' has no static member 'missing'."},
+		{22, 9, shared.SEVERITY_ERROR, "Class 'Counter' has no static field 'count'."},
+		{23, 9, shared.SEVERITY_ERROR, "Function 'reset' takes at most 0 arguments but received 1."},
+		{31, 5, shared.SEVERITY_ERROR, "Class 'Sub' has no static member 'count'."},
+		{32, 5, shared.SEVERITY_ERROR, "Class 'Sub' has no static field 'count'."},
+		{35, 9, shared.SEVERITY_ERROR, "Static member 'total' must be accessed through the class 'Counter'"},
+		{36, 9, shared.SEVERITY_ERROR, "Static member 'total' must be accessed through the class 'Counter'"},
+	})
+
+	// Statics are not inherited, so the hint points at the base class
+	for _, diagnostic := range analyser.Diagnostics()[6:8] {
+		if len(diagnostic.Hints) != 1 || !strings.Contains(diagnostic.Hints[0], "'Base.count'") {
+			t.Errorf("Expected a hint pointing at 'Base.count' but received %v", diagnostic.Hints)
+		}
+	}
+}
+
+func TestInvalidVisibility(t *testing.T) {
+	path := "../tests/invalid/visibility/analysis.tiny"
+	source := shared.ReadFile(path)
+	program, _ := parser.New(source, path, false).Parse()
+	analyser := NewAnalyser(true)
+
+	eq(t, analyser.Run(program.Body), false, "Private members were used from outside")
+
+	expectDiagnostics(t, analyser.Diagnostics(), []expected{
+		{20, 9, shared.SEVERITY_ERROR, "'opened' is private to class 'Account'."},
+		{21, 17, shared.SEVERITY_ERROR, "'balance' is private to class 'Account'."},
+		{22, 11, shared.SEVERITY_ERROR, "'check' is private to class 'Account'."},
+		{23, 15, shared.SEVERITY_ERROR, "'secret' is private to struct 'Token'."},
+		{24, 12, shared.SEVERITY_ERROR, "'rate' is private to namespace 'bank'."},
+	})
+}
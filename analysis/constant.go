@@ -0,0 +1,205 @@
+package analysis
+
+import (
+	"cmp"
+	"strconv"
+	"tiny/ast"
+	"tiny/lexer"
+)
+
+// Works out the value of a constant's expression, so the declaration can
+// hold a literal instead. Only literals, other constants and the operators
+// between them are known before running.
+func (an *Analyser) foldConstant(decl *ast.VariableDecl) *ast.Literal {
+	value, ok := an.fold(decl, decl.Expr)
+	if !ok {
+		return nil
+	}
+
+	token := *decl.Expr.GetToken()
+	token.Doc = ""
+
+	switch value := value.(type) {
+	case int:
+		token.Kind, token.Lexeme = lexer.INT, strconv.Itoa(value)
+	case float32:
+		token.Kind, token.Lexeme = lexer.FLOAT, strconv.FormatFloat(float64(value), 'g', -1, 32)
+	case bool:
+		token.Kind, token.Lexeme = lexer.BOOL, strconv.FormatBool(value)
+	case string:
+		token.Kind, token.Lexeme = lexer.STRING, value
+	}
+
+	return &ast.Literal{Token: &token}
+}
+
+func (an *Analyser) fold(decl *ast.VariableDecl, node ast.Node) (any, bool) {
+	switch node := node.(type) {
+	case *ast.Literal:
+		if value, ok := literalValue(node.Token); ok {
+			return value, true
+		}
+
+	case *ast.Identifier:
+		if sym, ok := an.lookup(node.Token.Lexeme, false).(*VarSymbol); ok && sym.constant != nil {
+			return literalValue(sym.constant.Token)
+		}
+
+	case *ast.UnaryOp:
+		right, ok := an.fold(decl, node.Right)
+		if !ok {
+			return nil, false
+		}
+
+		switch value := right.(type) {
+		case int:
+			if node.Token.Kind == lexer.MINUS {
+				return -value, true
+			}
+		case float32:
+			if node.Token.Kind == lexer.MINUS {
+				return -value, true
+			}
+		case bool:
+			if node.Token.Kind == lexer.BANG {
+				return !value, true
+			}
+		}
+
+		an.reportT("Invalid operation '%s' in constant '%s'.", node.Token, node.Token.Lexeme, decl.GetToken().Lexeme)
+		return nil, false
+
+	case *ast.BinaryOp:
+		return an.foldBinary(decl, node.Token, node.Left, node.Right)
+
+	case *ast.LogicalOp:
+		// Constants are never unit, so the default is not needed
+		if node.Token.Kind == lexer.QUESTION_QUESTION {
+			return an.fold(decl, node.Left)
+		}
+
+		return an.foldBinary(decl, node.Token, node.Left, node.Right)
+	}
+
+	diagnostic := an.diagnostic("Constant '%s' must be known before running, but '%s' is not.", node.GetToken(), decl.GetToken().Lexeme, node.GetToken().Lexeme)
+
+	switch node.(type) {
+	case *ast.ListLiteral, *ast.Call:
+		diagnostic.Hint("declare '%s' with 'let' and pass it to builtin.freeze to stop it changing", decl.GetToken().Lexeme)
+	default:
+		diagnostic.Hint("declare '%s' with 'let' to work it out while running", decl.GetToken().Lexeme)
+	}
+
+	an.reportDiagnostic(diagnostic)
+	return nil, false
+}
+
+func (an *Analyser) foldBinary(decl *ast.VariableDecl, operator *lexer.Token, leftNode, rightNode ast.Node) (any, bool) {
+	left, lok := an.fold(decl, leftNode)
+	right, rok := an.fold(decl, rightNode)
+
+	if !lok || !rok {
+		return nil, false
+	}
+
+	switch a := left.(type) {
+	case int:
+		if b, ok := right.(int); ok {
+			if operator.Kind == lexer.SLASH && b == 0 {
+				an.reportT("Division by zero in constant '%s'.", operator, decl.GetToken().Lexeme)
+				return nil, false
+			}
+
+			if value, ok := foldArithmetic(operator.Kind, a, b); ok {
+				return value, true
+			}
+		}
+
+	case float32:
+		if b, ok := right.(float32); ok {
+			if value, ok := foldArithmetic(operator.Kind, a, b); ok {
+				return value, true
+			}
+		}
+
+	case string:
+		if b, ok := right.(string); ok {
+			if operator.Kind == lexer.PLUS {
+				return a + b, true
+			}
+
+			if value, ok := foldCompare(operator.Kind, a, b); ok {
+				return value, true
+			}
+		}
+
+	case bool:
+		if b, ok := right.(bool); ok {
+			switch operator.Kind {
+			case lexer.AND:
+				return a && b, true
+			case lexer.OR:
+				return a || b, true
+			case lexer.EQUAL_EQUAL:
+				return a == b, true
+			case lexer.NOT_EQUAL:
+				return a != b, true
+			}
+		}
+	}
+
+	an.reportT("Invalid operation '%s' in constant '%s'.", operator, operator.Lexeme, decl.GetToken().Lexeme)
+	return nil, false
+}
+
+func foldCompare[T cmp.Ordered](operator lexer.TokenKind, a, b T) (any, bool) {
+	switch operator {
+	case lexer.EQUAL_EQUAL:
+		return a == b, true
+	case lexer.NOT_EQUAL:
+		return a != b, true
+	case lexer.GREATER:
+		return a > b, true
+	case lexer.GREATER_EQUAL:
+		return a >= b, true
+	case lexer.LESS:
+		return a < b, true
+	case lexer.LESS_EQUAL:
+		return a <= b, true
+	}
+
+	return nil, false
+}
+
+func foldArithmetic[T int | float32](operator lexer.TokenKind, a, b T) (any, bool) {
+	switch operator {
+	case lexer.PLUS:
+		return a + b, true
+	case lexer.MINUS:
+		return a - b, true
+	case lexer.STAR:
+		return a * b, true
+	case lexer.SLASH:
+		return a / b, true
+	}
+
+	return foldCompare(operator, a, b)
+}
+
+func literalValue(token *lexer.Token) (any, bool) {
+	switch token.Kind {
+	case lexer.INT:
+		value, _ := strconv.ParseInt(token.Lexeme, 10, 32)
+		return int(value), true
+	case lexer.FLOAT:
+		value, _ := strconv.ParseFloat(token.Lexeme, 32)
+		return float32(value), true
+	case lexer.BOOL:
+		value, _ := strconv.ParseBool(token.Lexeme)
+		return value, true
+	case lexer.STRING:
+		return token.Lexeme, true
+	}
+
+	return nil, false
+}
@@ -1,6 +1,11 @@
 package analysis
 
-import "tiny/ast"
+import (
+	"sort"
+	"strings"
+	"tiny/ast"
+	"tiny/shared"
+)
 
 type Symbol interface {
 	GetName() string
@@ -9,6 +14,10 @@ type Symbol interface {
 type VarSymbol struct {
 	identifier string
 	mutable    bool
+	// Value known before running, when declared with 'const'
+	constant *ast.Literal
+	// Class of the instance it holds, when that cannot change
+	class *ast.ClassDef
 }
 
 type FunctionSymbol struct {
@@ -36,8 +45,24 @@ type StructDefSymbol struct {
 	def        *ast.StructDef
 }
 
+type EnumDefSymbol struct {
+	identifier string
+	def        *ast.EnumDef
+}
+
+type TraitSymbol struct {
+	identifier string
+	def        *ast.TraitDef
+}
+
 type NameSpaceSymbol struct {
 	identifier string
+	// Members which can be accessed, or nil when they are not known
+	members []string
+	// Parameters of the native functions it holds, by name
+	natives map[string][]string
+	// Members marked 'priv', which cannot be reached through it
+	private map[string]bool
 }
 
 func (s *VarSymbol) GetName() string {
@@ -64,6 +89,111 @@ func (s *StructDefSymbol) GetName() string {
 	return s.identifier
 }
 
+func (s *EnumDefSymbol) GetName() string {
+	return s.identifier
+}
+
+// Find a variant of the enum by name
+func (s *EnumDefSymbol) variant(identifier string) *ast.Variant {
+	for _, variant := range s.def.Variants {
+		if variant.Token.Lexeme == identifier {
+			return variant
+		}
+	}
+
+	return nil
+}
+
+func (s *TraitSymbol) GetName() string {
+	return s.identifier
+}
+
 func (s *NameSpaceSymbol) GetName() string {
 	return s.identifier
 }
+
+// What a call is checked against, from a definition or a native's params
+type param struct {
+	name     string
+	optional bool
+	variadic bool
+}
+
+func scriptParams(params []*ast.Parameter) []param {
+	converted := make([]param, 0, len(params))
+
+	for _, p := range params {
+		converted = append(converted, param{name: p.Token.Lexeme, optional: p.Default != nil, variadic: p.Variadic})
+	}
+
+	return converted
+}
+
+func nativeParams(specs []string) []param {
+	converted := make([]param, 0, len(specs))
+
+	for _, spec := range specs {
+		name, optional, variadic := shared.ParseParam(spec)
+		converted = append(converted, param{name: name, optional: optional, variadic: variadic})
+	}
+
+	return converted
+}
+
+// Classes and structs without a constructor take no arguments
+func constructorParams(constructor *ast.FunctionDef) []param {
+	if constructor == nil {
+		return []param{}
+	}
+
+	return scriptParams(constructor.Params)
+}
+
+func describeParams(params []param) string {
+	names := make([]string, 0, len(params))
+
+	for _, p := range params {
+		switch {
+		case p.variadic:
+			names = append(names, "..."+p.name)
+		case p.optional:
+			names = append(names, p.name+"?")
+		default:
+			names = append(names, p.name)
+		}
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// Variants with a payload are called with their fields
+func variantParams(variant *ast.Variant) []param {
+	converted := make([]param, 0, len(variant.Fields))
+
+	for _, field := range variant.Fields {
+		converted = append(converted, param{name: field.Lexeme})
+	}
+
+	return converted
+}
+
+func specialMethodNames() string {
+	names := make([]string, 0, len(shared.SpecialMethods))
+
+	for name := range shared.SpecialMethods {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func variantNames(variants []*ast.Variant) string {
+	names := make([]string, 0, len(variants))
+
+	for _, variant := range variants {
+		names = append(names, variant.Token.Lexeme)
+	}
+
+	return strings.Join(names, ", ")
+}
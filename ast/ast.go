@@ -1,6 +1,11 @@
 package ast
 
-import "tiny/lexer"
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"tiny/lexer"
+)
 
 // It's a bit difficult to determine what every node shall have
 // This not too generic, but should work in this case
@@ -14,5 +19,80 @@ type Program struct {
 }
 
 func New() *Program {
-	return &Program{&Block{make([]Node, 0, 8), nil}}
+	return &Program{&Block{Statements: make([]Node, 0, 8)}}
+}
+
+// Doc comments are only written when present, so undocumented output is unchanged
+func writeDoc(sb *strings.Builder, doc string) {
+	if len(doc) == 0 {
+		return
+	}
+
+	sb.WriteString(" (doc ")
+	sb.WriteString(strconv.Quote(doc))
+	sb.WriteByte(')')
+}
+
+func writeTraits(sb *strings.Builder, traits []Node) {
+	if len(traits) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(traits))
+
+	for _, trait := range traits {
+		names = append(names, trait.AsSExp())
+	}
+
+	sb.WriteString(" (impl ")
+	sb.WriteString(strings.Join(names, ", "))
+	sb.WriteString(") ")
+}
+
+func joinNames(names []*lexer.Token) string {
+	lexemes := make([]string, 0, len(names))
+
+	for _, name := range names {
+		lexemes = append(lexemes, name.Lexeme)
+	}
+
+	return strings.Join(lexemes, ", ")
+}
+
+// Writes a group of members under a label, leaving out empty groups
+func writeMembers(sb *strings.Builder, label string, fields map[string]*VariableDecl, methods map[string]*FunctionDef) {
+	if len(fields) == 0 && len(methods) == 0 {
+		return
+	}
+
+	sb.WriteString("(" + label)
+
+	for _, value := range fields {
+		sb.WriteString(" " + value.AsSExp())
+	}
+
+	for _, value := range methods {
+		sb.WriteString(" " + value.AsSExp())
+	}
+
+	sb.WriteByte(')')
+}
+
+// Lists the private members in order, leaving them out when there are none
+func writePrivate(sb *strings.Builder, private map[string]bool) {
+	if len(private) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(private))
+
+	for name := range private {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	sb.WriteString("(priv ")
+	sb.WriteString(strings.Join(names, " "))
+	sb.WriteByte(')')
 }
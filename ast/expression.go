@@ -27,6 +27,10 @@ type Identifier struct {
 type Parameter struct {
 	Token   *lexer.Token
 	Mutable bool
+	// Evaluated when the argument is left out, or nil when it is required
+	Default Node
+	// Collects the remaining arguments into a list
+	Variadic bool
 }
 
 type Argument struct {
@@ -47,33 +51,53 @@ type ListLiteral struct {
 	Exprs []Node
 }
 
+// Either end can be left out, like '..5' or '2..', which slices use.
+// Step is nil unless given, like '0..10 step 2'.
+type Range struct {
+	Token     *lexer.Token
+	Start     Node
+	End       Node
+	Step      Node
+	Inclusive bool
+}
+
 type Call struct {
 	Token     *lexer.Token
 	Callee    Node
 	Arguments []Node
+	// Written '?.()', giving back unit without calling when Callee is unit
+	Optional bool
 }
 
 type Assign struct {
 	Token    *lexer.Token
 	Operator *lexer.Token
 	Expr     Node
+	// Assigns several variables at once, when given
+	Pattern *Pattern
 }
 
 type Get struct {
 	Token *lexer.Token
 	Expr  Node
+	// Written '?.', giving back unit instead of failing when Expr is unit
+	Optional bool
 }
 
 type Set struct {
 	Token  *lexer.Token
 	Caller Node
 	Expr   Node
+	// Assigned through '?.', which cannot be done
+	Optional bool
 }
 
 type Index struct {
 	Token  *lexer.Token
 	Caller Node
 	Expr   Node
+	// Written '?[', giving back unit instead of failing when Caller is unit
+	Optional bool
 }
 
 type IndexSet struct {
@@ -87,9 +111,10 @@ type Self struct {
 }
 
 type AnonymousFunction struct {
-	token  *lexer.Token
-	Params []*Parameter
-	Body   *Block
+	token     *lexer.Token
+	Params    []*Parameter
+	Body      *Block
+	Generator bool
 }
 
 type Catch struct {
@@ -97,6 +122,14 @@ type Catch struct {
 	Expr  Node
 	Var   *lexer.Token
 	Body  *Block
+	// Runs after the expression and body, whether or not a value was thrown
+	Finally *Block
+}
+
+// An import used as a value, which loads the file when it is evaluated
+type ImportExpr struct {
+	Token *lexer.Token
+	Expr  Node
 }
 
 type Block struct {
@@ -181,6 +214,14 @@ func (param *Parameter) GetToken() *lexer.Token {
 }
 
 func (param *Parameter) AsSExp() string {
+	if param.Variadic {
+		return "..." + param.Token.Lexeme
+	}
+
+	if param.Default != nil {
+		return param.Token.Lexeme + "=" + param.Default.AsSExp()
+	}
+
 	return param.Token.Lexeme
 }
 
@@ -234,6 +275,35 @@ func (list *ListLiteral) AsSExp() string {
 	return sb.String()
 }
 
+func (expr *Range) GetToken() *lexer.Token {
+	return expr.Token
+}
+
+func (expr *Range) AsSExp() string {
+	var sb strings.Builder
+
+	sb.WriteByte('(')
+
+	if expr.Start != nil {
+		sb.WriteString(expr.Start.AsSExp())
+	}
+
+	sb.WriteString(expr.Token.Lexeme)
+
+	if expr.End != nil {
+		sb.WriteString(expr.End.AsSExp())
+	}
+
+	if expr.Step != nil {
+		sb.WriteString(" step ")
+		sb.WriteString(expr.Step.AsSExp())
+	}
+
+	sb.WriteByte(')')
+
+	return sb.String()
+}
+
 func (call *Call) GetToken() *lexer.Token {
 	return call.Token
 }
@@ -242,6 +312,9 @@ func (call *Call) AsSExp() string {
 	var sb strings.Builder
 
 	sb.WriteString(call.Token.Lexeme)
+	if call.Optional {
+		sb.WriteString("?.")
+	}
 	sb.WriteByte('(')
 
 	for idx, arg := range call.Arguments {
@@ -265,7 +338,11 @@ func (assign *Assign) AsSExp() string {
 	var sb strings.Builder
 
 	sb.WriteByte('(')
-	sb.WriteString(assign.Token.Lexeme + " " + assign.Operator.Lexeme + " ")
+	if assign.Pattern != nil {
+		sb.WriteString(assign.Pattern.AsSExp() + " " + assign.Operator.Lexeme + " ")
+	} else {
+		sb.WriteString(assign.Token.Lexeme + " " + assign.Operator.Lexeme + " ")
+	}
 	sb.WriteString(assign.Expr.AsSExp())
 	sb.WriteByte(')')
 
@@ -280,7 +357,11 @@ func (expr *Get) AsSExp() string {
 	var sb strings.Builder
 
 	sb.WriteString(expr.Token.Lexeme)
-	sb.WriteByte('.')
+	if expr.Optional {
+		sb.WriteString("?.")
+	} else {
+		sb.WriteByte('.')
+	}
 	sb.WriteString(expr.Expr.AsSExp())
 
 	return sb.String()
@@ -308,7 +389,11 @@ func (expr *Index) AsSExp() string {
 	var sb strings.Builder
 
 	sb.WriteString(expr.Caller.AsSExp())
-	sb.WriteByte('[')
+	if expr.Optional {
+		sb.WriteString("?[")
+	} else {
+		sb.WriteByte('[')
+	}
 	sb.WriteString(expr.Expr.AsSExp())
 	sb.WriteByte(']')
 
@@ -379,6 +464,26 @@ func (expr *Catch) AsSExp() string {
 	sb.WriteByte(':')
 	sb.WriteString(expr.Var.Lexeme)
 	sb.WriteString(expr.Body.AsSExp())
+
+	if expr.Finally != nil {
+		sb.WriteString(" finally")
+		sb.WriteString(expr.Finally.AsSExp())
+	}
+
+	sb.WriteByte(')')
+
+	return sb.String()
+}
+
+func (expr *ImportExpr) GetToken() *lexer.Token {
+	return expr.Token
+}
+
+func (expr *ImportExpr) AsSExp() string {
+	var sb strings.Builder
+
+	sb.WriteString("(import ")
+	sb.WriteString(expr.Expr.AsSExp())
 	sb.WriteByte(')')
 
 	return sb.String()
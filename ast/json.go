@@ -0,0 +1,82 @@
+package ast
+
+import (
+	"reflect"
+	"strings"
+	"tiny/lexer"
+)
+
+var tokenType = reflect.TypeOf(&lexer.Token{})
+
+// AsJSON converts a node into plain maps, slices and values that can be passed
+// to encoding/json. Every node records its kind and position, followed by its
+// exported fields, so new nodes are covered without extra work.
+func AsJSON(node Node) any {
+	if node == nil || reflect.ValueOf(node).IsNil() {
+		return nil
+	}
+
+	value := reflect.ValueOf(node).Elem()
+	kind := value.Type()
+
+	out := map[string]any{"node": kind.Name()}
+
+	if token := node.GetToken(); token != nil {
+		out["token"] = token.Lexeme
+		out["line"] = token.Line
+		out["column"] = token.Column
+	}
+
+	for idx := 0; idx < kind.NumField(); idx++ {
+		field := kind.Field(idx)
+
+		// The node's own token has already been written above
+		if !field.IsExported() || field.Name == "Token" {
+			continue
+		}
+
+		out[strings.ToLower(field.Name[:1])+field.Name[1:]] = jsonValue(value.Field(idx))
+	}
+
+	return out
+}
+
+func jsonValue(value reflect.Value) any {
+	switch value.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice:
+		if value.IsNil() {
+			return nil
+		}
+	}
+
+	if value.Type() == tokenType {
+		return value.Interface().(*lexer.Token).Lexeme
+	}
+
+	if node, ok := value.Interface().(Node); ok {
+		return AsJSON(node)
+	}
+
+	switch value.Kind() {
+	case reflect.Slice:
+		items := make([]any, 0, value.Len())
+
+		for idx := 0; idx < value.Len(); idx++ {
+			items = append(items, jsonValue(value.Index(idx)))
+		}
+
+		return items
+
+	case reflect.Map:
+		items := make(map[string]any, value.Len())
+
+		iter := value.MapRange()
+		for iter.Next() {
+			items[iter.Key().String()] = jsonValue(iter.Value())
+		}
+
+		return items
+	}
+
+	return value.Interface()
+}
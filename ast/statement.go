@@ -1,6 +1,7 @@
 package ast
 
 import (
+	"strconv"
 	"strings"
 	"tiny/lexer"
 )
@@ -9,12 +10,37 @@ type VariableDecl struct {
 	token   *lexer.Token
 	Mutable bool
 	Expr    Node
+	Public  bool
+	// Declares several variables at once, when given
+	Pattern *Pattern
+	// Declared with 'const', the analyser folds Expr into a literal
+	Constant bool
+}
+
+type PatternKind byte
+
+const (
+	PATTERN_LIST   PatternKind = iota // [a, b, ...rest]
+	PATTERN_FIELDS                    // {x, y}
+)
+
+// Takes a list or instance apart, binding each item or field to a name
+type Pattern struct {
+	Token *lexer.Token
+	Kind  PatternKind
+	Names []*lexer.Token
+	// Captures the items left over, when given
+	Rest *lexer.Token
 }
 
 type FunctionDef struct {
 	token  *lexer.Token
 	Params []*Parameter
 	Body   *Block
+	Doc    string
+	Public bool
+	// Set by the parser when the body yields, calls then produce an iterator
+	Generator bool
 }
 
 type Print struct {
@@ -28,12 +54,52 @@ type ClassDef struct {
 	Constructor *FunctionDef
 	Fields      map[string]*VariableDecl
 	Methods     map[string]*FunctionDef
+	// Members marked 'static', reached through the class instead of an instance
+	StaticFields  map[string]*VariableDecl
+	StaticMethods map[string]*FunctionDef
+	// Accessors run when a property with their name is read or assigned
+	Getters map[string]*FunctionDef
+	Setters map[string]*FunctionDef
+	// Names of members marked 'priv', only usable from within the class
+	Private map[string]bool
+	// Traits listed after 'impl', which the class must conform to
+	Traits []Node
+	Doc    string
+	Public bool
 }
 
 type StructDef struct {
 	Token       *lexer.Token
 	Constructor *FunctionDef
 	Fields      map[string]*VariableDecl
+	Methods     map[string]*FunctionDef
+	// Names of members marked 'priv', only usable from within the struct
+	Private map[string]bool
+	Traits  []Node
+	Doc     string
+	Public  bool
+}
+
+// TraitDef lists methods shared by classes and structs. Methods without a
+// body must be written by each implementer, the others are used by default.
+type TraitDef struct {
+	Token   *lexer.Token
+	Methods []*FunctionDef
+	Doc     string
+	Public  bool
+}
+
+type EnumDef struct {
+	Token    *lexer.Token
+	Variants []*Variant
+	Doc      string
+	Public   bool
+}
+
+// Variant of an enum, which carries a payload when it has fields
+type Variant struct {
+	Token  *lexer.Token
+	Fields []*lexer.Token
 }
 
 type Return struct {
@@ -57,18 +123,47 @@ type While struct {
 	Body      *Block
 }
 
+// Runs the body for each value of an iterable. Index counts from 0 when
+// the loop enumerates, like 'for i, x in xs'.
+type For struct {
+	Token    *lexer.Token
+	Index    *lexer.Token
+	Item     *lexer.Token
+	Iterable Node
+	Body     *Block
+}
+
 type Throw struct {
 	Token *lexer.Token
 	Expr  Node
 }
 
+type Yield struct {
+	Token *lexer.Token
+	Expr  Node
+}
+
+// Runs a statement or block when the enclosing function exits
+type Defer struct {
+	Token *lexer.Token
+	Body  Node
+}
+
+// Binds the public members of another file to a name. The path is resolved
+// by the module loader before the file is analysed.
 type Import struct {
 	Token *lexer.Token
+	Alias *lexer.Token
+	Path  string
 }
 
 type NameSpace struct {
 	Token *lexer.Token
 	Body  *Block
+	// Names of members marked 'priv', which cannot be reached through the namespace
+	Private map[string]bool
+	Doc     string
+	Public  bool
 }
 
 type Test struct {
@@ -94,15 +189,61 @@ type Match struct {
 type Case struct {
 	Token *lexer.Token
 	Expr  Node
-	Body  Node
+	// Names for the payload of an enum variant, like 'Shape.Circle(r)', or nil
+	Bindings []*lexer.Token
+	Body     Node
 }
 
 func NewVarDecl(token *lexer.Token, mutable bool, expr Node) *VariableDecl {
 	return &VariableDecl{token: token, Mutable: mutable, Expr: expr}
 }
 
+func NewPatternDecl(pattern *Pattern, mutable bool, expr Node) *VariableDecl {
+	return &VariableDecl{token: pattern.Token, Mutable: mutable, Expr: expr, Pattern: pattern}
+}
+
+// Every name the pattern binds, including the rest
+func (pattern *Pattern) Identifiers() []*lexer.Token {
+	if pattern.Rest == nil {
+		return pattern.Names
+	}
+
+	return append(append(make([]*lexer.Token, 0, len(pattern.Names)+1), pattern.Names...), pattern.Rest)
+}
+
+func (pattern *Pattern) GetToken() *lexer.Token {
+	return pattern.Token
+}
+
+func (pattern *Pattern) AsSExp() string {
+	var sb strings.Builder
+
+	open, close := byte('['), byte(']')
+	if pattern.Kind == PATTERN_FIELDS {
+		open, close = '{', '}'
+	}
+
+	sb.WriteByte(open)
+	for idx, name := range pattern.Names {
+		if idx > 0 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(name.Lexeme)
+	}
+
+	if pattern.Rest != nil {
+		if len(pattern.Names) > 0 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString("..." + pattern.Rest.Lexeme)
+	}
+	sb.WriteByte(close)
+
+	return sb.String()
+}
+
 func NewNamespace(token *lexer.Token) *NameSpace {
-	return &NameSpace{token, NewBlock(token)}
+	return &NameSpace{Token: token, Body: NewBlock(token)}
 }
 
 func (decl *VariableDecl) GetToken() *lexer.Token {
@@ -116,8 +257,19 @@ func (decl *VariableDecl) AsSExp() string {
 	if decl.Mutable {
 		sb.WriteString("mut ")
 	}
-	sb.WriteString(decl.token.Lexeme + " ")
-	sb.WriteString(decl.Expr.AsSExp())
+	if decl.Constant {
+		sb.WriteString("const ")
+	}
+	if decl.Pattern != nil {
+		sb.WriteString(decl.Pattern.AsSExp() + " ")
+	} else {
+		sb.WriteString(decl.token.Lexeme + " ")
+	}
+
+	// Fields are declared without a value
+	if decl.Expr != nil {
+		sb.WriteString(decl.Expr.AsSExp())
+	}
 	sb.WriteByte(')')
 
 	return sb.String()
@@ -137,6 +289,7 @@ func (fndef *FunctionDef) AsSExp() string {
 	sb.WriteByte('(')
 	sb.WriteString("function ")
 	sb.WriteString(fndef.token.Lexeme)
+	writeDoc(&sb, fndef.Doc)
 	sb.WriteByte(' ')
 	sb.WriteByte('(')
 
@@ -184,6 +337,24 @@ func (p *Print) AsSExp() string {
 	return sb.String()
 }
 
+// Whether a static field or method has the name
+func (klass *ClassDef) IsStatic(name string) bool {
+	_, field := klass.StaticFields[name]
+	_, method := klass.StaticMethods[name]
+
+	return field || method
+}
+
+// Whether a field, method or accessor of an instance has the name
+func (klass *ClassDef) HasMember(name string) bool {
+	_, field := klass.Fields[name]
+	_, method := klass.Methods[name]
+	_, getter := klass.Getters[name]
+	_, setter := klass.Setters[name]
+
+	return field || method || getter || setter
+}
+
 func (klass *ClassDef) GetToken() *lexer.Token {
 	return klass.Token
 }
@@ -193,12 +364,14 @@ func (klass *ClassDef) AsSExp() string {
 
 	sb.WriteByte('(')
 	sb.WriteString(klass.Token.Lexeme)
+	writeDoc(&sb, klass.Doc)
 
 	if klass.Base != nil {
 		sb.WriteString(" : ")
 		sb.WriteString(klass.Base.AsSExp())
 		sb.WriteByte(' ')
 	}
+	writeTraits(&sb, klass.Traits)
 	sb.WriteByte('(')
 
 	idx := 0
@@ -220,6 +393,12 @@ func (klass *ClassDef) AsSExp() string {
 	}
 
 	sb.WriteByte(')')
+
+	writeMembers(&sb, "static", klass.StaticFields, klass.StaticMethods)
+	writeMembers(&sb, "get", nil, klass.Getters)
+	writeMembers(&sb, "set", nil, klass.Setters)
+	writePrivate(&sb, klass.Private)
+
 	sb.WriteByte(')')
 
 	return sb.String()
@@ -234,6 +413,8 @@ func (stmt *StructDef) AsSExp() string {
 
 	sb.WriteByte('(')
 	sb.WriteString(stmt.Token.Lexeme)
+	writeDoc(&sb, stmt.Doc)
+	writeTraits(&sb, stmt.Traits)
 	sb.WriteByte('(')
 
 	idx := 0
@@ -248,11 +429,93 @@ func (stmt *StructDef) AsSExp() string {
 	}
 
 	sb.WriteByte(')')
+	writePrivate(&sb, stmt.Private)
 	sb.WriteByte(')')
 
 	return sb.String()
 }
 
+func (stmt *TraitDef) GetToken() *lexer.Token {
+	return stmt.Token
+}
+
+func (stmt *TraitDef) AsSExp() string {
+	var sb strings.Builder
+
+	sb.WriteByte('(')
+	sb.WriteString("trait ")
+	sb.WriteString(stmt.Token.Lexeme)
+	writeDoc(&sb, stmt.Doc)
+
+	for _, method := range stmt.Methods {
+		sb.WriteByte(' ')
+
+		if method.Body != nil {
+			sb.WriteString(method.AsSExp())
+			continue
+		}
+
+		params := make([]string, 0, len(method.Params))
+
+		for _, param := range method.Params {
+			params = append(params, param.AsSExp())
+		}
+
+		sb.WriteString(method.GetToken().Lexeme + "(" + strings.Join(params, ", ") + ")")
+	}
+
+	sb.WriteByte(')')
+
+	return sb.String()
+}
+
+// Methods a trait requires, which have no default
+func (stmt *TraitDef) Required() []*FunctionDef {
+	required := make([]*FunctionDef, 0, len(stmt.Methods))
+
+	for _, method := range stmt.Methods {
+		if method.Body == nil {
+			required = append(required, method)
+		}
+	}
+
+	return required
+}
+
+func (stmt *EnumDef) GetToken() *lexer.Token {
+	return stmt.Token
+}
+
+func (stmt *EnumDef) AsSExp() string {
+	var sb strings.Builder
+
+	sb.WriteByte('(')
+	sb.WriteString("enum ")
+	sb.WriteString(stmt.Token.Lexeme)
+	writeDoc(&sb, stmt.Doc)
+
+	for _, variant := range stmt.Variants {
+		sb.WriteByte(' ')
+		sb.WriteString(variant.AsSExp())
+	}
+
+	sb.WriteByte(')')
+
+	return sb.String()
+}
+
+func (variant *Variant) GetToken() *lexer.Token {
+	return variant.Token
+}
+
+func (variant *Variant) AsSExp() string {
+	if variant.Fields == nil {
+		return variant.Token.Lexeme
+	}
+
+	return variant.Token.Lexeme + "(" + joinNames(variant.Fields) + ")"
+}
+
 func (ret *Return) GetToken() *lexer.Token {
 	return ret.Token
 }
@@ -322,6 +585,59 @@ func (stmt *While) AsSExp() string {
 	return sb.String()
 }
 
+func (stmt *For) GetToken() *lexer.Token {
+	return stmt.Token
+}
+
+func (stmt *For) AsSExp() string {
+	var sb strings.Builder
+
+	sb.WriteString("(for ")
+
+	if stmt.Index != nil {
+		sb.WriteString(stmt.Index.Lexeme)
+		sb.WriteString(", ")
+	}
+
+	sb.WriteString(stmt.Item.Lexeme)
+	sb.WriteString(" in ")
+	sb.WriteString(stmt.Iterable.AsSExp())
+	sb.WriteString(stmt.Body.AsSExp())
+	sb.WriteByte(')')
+
+	return sb.String()
+}
+
+func (stmt *Yield) GetToken() *lexer.Token {
+	return stmt.Token
+}
+
+func (stmt *Yield) AsSExp() string {
+	var sb strings.Builder
+
+	sb.WriteByte('(')
+	sb.WriteString("yield ")
+	sb.WriteString(stmt.Expr.AsSExp())
+	sb.WriteByte(')')
+
+	return sb.String()
+}
+
+func (stmt *Defer) GetToken() *lexer.Token {
+	return stmt.Token
+}
+
+func (stmt *Defer) AsSExp() string {
+	var sb strings.Builder
+
+	sb.WriteByte('(')
+	sb.WriteString("defer ")
+	sb.WriteString(stmt.Body.AsSExp())
+	sb.WriteByte(')')
+
+	return sb.String()
+}
+
 func (stmt *Throw) GetToken() *lexer.Token {
 	return stmt.Token
 }
@@ -346,7 +662,9 @@ func (stmt *Import) AsSExp() string {
 
 	sb.WriteByte('(')
 	sb.WriteString("import ")
-	sb.WriteString(stmt.Token.Lexeme)
+	sb.WriteString(strconv.Quote(stmt.Token.Lexeme))
+	sb.WriteString(" into ")
+	sb.WriteString(stmt.Alias.Lexeme)
 	sb.WriteByte(')')
 
 	return sb.String()
@@ -362,6 +680,8 @@ func (stmt *NameSpace) AsSExp() string {
 	sb.WriteByte('(')
 	sb.WriteString("namespace ")
 	sb.WriteString(stmt.Token.Lexeme)
+	writeDoc(&sb, stmt.Doc)
+	writePrivate(&sb, stmt.Private)
 	sb.WriteString(stmt.Body.AsSExp())
 	sb.WriteByte(')')
 
@@ -429,6 +749,11 @@ func (stmt *Case) AsSExp() string {
 
 	sb.WriteByte('(')
 	sb.WriteString(stmt.Expr.AsSExp())
+
+	if stmt.Bindings != nil {
+		sb.WriteString("(" + joinNames(stmt.Bindings) + ")")
+	}
+
 	sb.WriteString("=> ")
 	sb.WriteString(stmt.Body.AsSExp())
 	sb.WriteByte(')')
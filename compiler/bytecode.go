@@ -0,0 +1,148 @@
+package compiler
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"tiny/runtime"
+)
+
+// Header written at the start of every compiled file, followed by a version
+// byte which is bumped whenever the layout or opcodes change
+const (
+	bytecodeMagic   = "TBC"
+	bytecodeVersion = 2
+)
+
+// Tags for each kind of constant stored in a chunk
+const (
+	constInt byte = iota
+	constFloat
+	constBool
+	constString
+)
+
+// Encode writes the chunk in a compact binary form that Decode can read back
+func (c *Chunk) Encode(w io.Writer) error {
+	out := bufio.NewWriter(w)
+
+	out.WriteString(bytecodeMagic)
+	out.WriteByte(bytecodeVersion)
+
+	binary.Write(out, binary.LittleEndian, uint32(len(c.Constants)))
+
+	for _, constant := range c.Constants {
+		switch value := constant.(type) {
+		case *runtime.IntVal:
+			out.WriteByte(constInt)
+			binary.Write(out, binary.LittleEndian, int64(value.Value))
+
+		case *runtime.FloatVal:
+			out.WriteByte(constFloat)
+			binary.Write(out, binary.LittleEndian, math.Float32bits(value.Value))
+
+		case *runtime.BoolVal:
+			out.WriteByte(constBool)
+
+			if value.Value {
+				out.WriteByte(1)
+			} else {
+				out.WriteByte(0)
+			}
+
+		case *runtime.StringVal:
+			out.WriteByte(constString)
+			binary.Write(out, binary.LittleEndian, uint32(len(value.Value)))
+			out.WriteString(value.Value)
+
+		default:
+			return fmt.Errorf("cannot encode constant of type '%s'", constant.GetType().GetName())
+		}
+	}
+
+	binary.Write(out, binary.LittleEndian, uint32(len(c.Instructions)))
+	out.Write(c.Instructions)
+
+	return out.Flush()
+}
+
+// Decode reads a chunk previously written with Encode
+func Decode(r io.Reader) (*Chunk, error) {
+	in := bufio.NewReader(r)
+
+	header := make([]byte, len(bytecodeMagic)+1)
+	if _, err := io.ReadFull(in, header); err != nil || string(header[:len(bytecodeMagic)]) != bytecodeMagic {
+		return nil, errors.New("not a tiny bytecode file")
+	}
+
+	if version := header[len(bytecodeMagic)]; version != bytecodeVersion {
+		return nil, fmt.Errorf("unsupported bytecode version %d, expected %d", version, bytecodeVersion)
+	}
+
+	var count uint32
+	if err := binary.Read(in, binary.LittleEndian, &count); err != nil {
+		return nil, err
+	}
+
+	chunk := &Chunk{Constants: make([]runtime.Value, 0, count)}
+
+	for idx := uint32(0); idx < count; idx++ {
+		tag, err := in.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		switch tag {
+		case constInt:
+			var value int64
+			if err := binary.Read(in, binary.LittleEndian, &value); err != nil {
+				return nil, err
+			}
+			chunk.Constants = append(chunk.Constants, &runtime.IntVal{Value: int(value)})
+
+		case constFloat:
+			var bits uint32
+			if err := binary.Read(in, binary.LittleEndian, &bits); err != nil {
+				return nil, err
+			}
+			chunk.Constants = append(chunk.Constants, &runtime.FloatVal{Value: math.Float32frombits(bits)})
+
+		case constBool:
+			value, err := in.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			chunk.Constants = append(chunk.Constants, &runtime.BoolVal{Value: value != 0})
+
+		case constString:
+			var length uint32
+			if err := binary.Read(in, binary.LittleEndian, &length); err != nil {
+				return nil, err
+			}
+
+			value := make([]byte, length)
+			if _, err := io.ReadFull(in, value); err != nil {
+				return nil, err
+			}
+			chunk.Constants = append(chunk.Constants, &runtime.StringVal{Value: string(value)})
+
+		default:
+			return nil, fmt.Errorf("unknown constant tag %d", tag)
+		}
+	}
+
+	var length uint32
+	if err := binary.Read(in, binary.LittleEndian, &length); err != nil {
+		return nil, err
+	}
+
+	chunk.Instructions = make([]byte, length)
+	if _, err := io.ReadFull(in, chunk.Instructions); err != nil {
+		return nil, err
+	}
+
+	return chunk, nil
+}
@@ -1,11 +1,11 @@
 package compiler
 
 import (
-	"fmt"
 	"reflect"
 	"tiny/ast"
 	"tiny/lexer"
 	"tiny/runtime"
+	"tiny/shared"
 )
 
 type local struct {
@@ -46,6 +46,8 @@ type Compiler struct {
 	chunk *Chunk
 	ids   []*scope
 	depth int
+	// Programs the VM cannot run the same way as the interpreter
+	diagnostics []*shared.Diagnostic
 }
 
 func NewCompiler() *Compiler {
@@ -64,6 +66,16 @@ func (c *Compiler) Compile(program *ast.Program) *Chunk {
 	return c.chunk
 }
 
+func (c *Compiler) Diagnostics() []*shared.Diagnostic {
+	return c.diagnostics
+}
+
+func (c *Compiler) report(msg string, token *lexer.Token, args ...any) *shared.Diagnostic {
+	diagnostic := shared.NewDiagnostic("Compile", msg, args...).At(token.File, token.Line, token.Column, token.Length())
+	c.diagnostics = append(c.diagnostics, diagnostic)
+	return diagnostic
+}
+
 func (c *Compiler) begin() {
 	c.depth++
 	c.ids = append(c.ids, &scope{make([]local, 0, 8), 0})
@@ -80,7 +92,14 @@ func (c *Compiler) open() {
 
 func (c *Compiler) close() {
 	c.destroyLocals()
-	c.ids[len(c.ids)-1].local_depth--
+
+	// Forget the block's locals, so the slots are free for the next one
+	scope := c.ids[len(c.ids)-1]
+	for len(scope.locals) > 0 && scope.locals[len(scope.locals)-1].depth == scope.local_depth {
+		scope.locals = scope.locals[:len(scope.locals)-1]
+	}
+
+	scope.local_depth--
 }
 
 func (c *Compiler) destroyLocals() {
@@ -94,23 +113,32 @@ func (c *Compiler) destroyLocals() {
 }
 
 func (c *Compiler) addVariable(identifier string) (byte, byte) {
-	index := -1
+	index := c.addIdentifier(identifier)
+
+	// Globals live outside of the stack, so do not take a slot
+	if !c.isLocal() {
+		return 0, index
+	}
 
+	scope := c.ids[c.depth]
+	scope.locals = append(scope.locals, local{identifier, scope.local_depth})
+	return byte(len(scope.locals) - 1), index
+}
+
+// Find the constant holding a name, adding it when there is none
+func (c *Compiler) addIdentifier(identifier string) byte {
 	for idx, constant := range c.chunk.Constants {
 		if constant.Inspect() == identifier {
-			index = idx
-			break
+			return byte(idx)
 		}
 	}
 
-	if index == -1 {
-		c.chunk.Constants = append(c.chunk.Constants, &runtime.StringVal{identifier})
-		index = len(c.chunk.Constants) - 1
-	}
+	c.chunk.Constants = append(c.chunk.Constants, &runtime.StringVal{Value: identifier})
+	return byte(len(c.chunk.Constants) - 1)
+}
 
-	scope := c.ids[c.depth]
-	scope.locals = append(scope.locals, local{identifier, scope.local_depth})
-	return byte(len(scope.locals) - 1), byte(index)
+func (c *Compiler) isLocal() bool {
+	return c.depth > 0 || c.ids[len(c.ids)-1].local_depth > 0
 }
 
 func (c *Compiler) addVariableWithSlot(identifier string, slot byte) {
@@ -124,11 +152,15 @@ func (c *Compiler) addVariableWithSlot(identifier string, slot byte) {
 	}
 
 	if !found {
-		c.chunk.Constants = append(c.chunk.Constants, &runtime.StringVal{identifier})
+		c.chunk.Constants = append(c.chunk.Constants, &runtime.StringVal{Value: identifier})
 	}
 
+	// Parameters are added in any order, so leave room for the slots before
 	scope := c.ids[len(c.ids)-1]
-	scope.locals = append(c.ids[len(c.ids)-1].locals, local{identifier, c.depth})
+	for len(scope.locals) <= int(slot) {
+		scope.locals = append(scope.locals, local{})
+	}
+	scope.locals[slot] = local{identifier, scope.local_depth}
 }
 
 func (c *Compiler) getVariable(identifier string) byte {
@@ -145,14 +177,19 @@ func (c *Compiler) getVariable(identifier string) byte {
 }
 
 func (c *Compiler) findVariableSlot(identifier string) byte {
+	slot, _ := c.findLocal(identifier)
+	return slot
+}
+
+// The slot of a local, or false when the name is a global
+func (c *Compiler) findLocal(identifier string) (byte, bool) {
 	for idx := len(c.ids) - 1; idx >= 0; idx-- {
 		if index := c.ids[idx].findLocal(identifier); index > -1 {
-			return byte(index)
+			return byte(index), true
 		}
 	}
 
-	// TODO: Report error or unreachable?
-	return 0
+	return 0, false
 }
 
 func (c *Compiler) compileProgram(chunk *Chunk, program *ast.Program) {
@@ -194,21 +231,38 @@ func (c *Compiler) visit(chunk *Chunk, node ast.Node) {
 		}
 		c.chunk.addOp(Return)
 
+	case *ast.Yield:
+		c.visit(chunk, n.Expr)
+		c.chunk.addOp(Yield)
+
+	case *ast.Defer:
+		c.deferStmt(chunk, n)
+
 	case *ast.VariableDecl:
 		c.variableDecl(chunk, n)
 	case *ast.Assign:
 		c.variableAssign(chunk, n)
 	case *ast.Literal:
 		chunk.addOps(Push, chunk.addConstant(n))
+	case *ast.ListLiteral:
+		for _, value := range n.Exprs {
+			c.visit(chunk, value)
+		}
+		chunk.addOps(List, byte(len(n.Exprs)))
 	case *ast.If:
 		c.ifStmt(chunk, n)
 	case *ast.While:
 		c.whileStmt(chunk, n)
+	case *ast.For:
+		c.forStmt(chunk, n)
+	case *ast.Range:
+		c.rangeExpr(chunk, n)
 	case *ast.Identifier:
 		c.getIdentifier(chunk, n)
 
 	default:
-		fmt.Printf("Compiler: Unimplemented node '%s'", reflect.TypeOf(node))
+		c.report("Cannot compile '%s', as the VM does not support it yet.", node.GetToken(), reflect.TypeOf(node).Elem().Name()).
+			Hint("run it without '--vm'")
 	}
 }
 
@@ -222,6 +276,8 @@ func (c *Compiler) functionDef(chunk *Chunk, def *ast.FunctionDef) {
 	_, name_id := c.addVariable(def.GetToken().Lexeme)
 	defStart := c.chunk.addOps(Jump, 0)
 
+	c.checkParams(def.Params)
+
 	c.begin()
 	for idx := len(def.Params) - 1; idx >= 0; idx-- {
 		c.addVariableWithSlot(def.Params[idx].Token.Lexeme, byte(idx))
@@ -231,12 +287,20 @@ func (c *Compiler) functionDef(chunk *Chunk, def *ast.FunctionDef) {
 
 	c.chunk.addOp(Return)
 	c.chunk.upateOpPosNext(defStart)
-	c.chunk.addOps(NewFn, byte(len(def.Params)), byte(defStart+1), name_id)
+
+	// Generators are only told apart when called, where they start a coroutine
+	op := NewFn
+	if def.Generator {
+		op = NewGen
+	}
+	c.chunk.addOps(op, byte(len(def.Params)), byte(defStart+1), name_id)
 }
 
 func (c *Compiler) anonFunction(chunk *Chunk, anon *ast.AnonymousFunction) {
 	defStart := c.chunk.addOps(Jump, 0)
 
+	c.checkParams(anon.Params)
+
 	c.begin()
 	for idx := len(anon.Params) - 1; idx >= 0; idx-- {
 		c.addVariableWithSlot(anon.Params[idx].Token.Lexeme, byte(idx))
@@ -250,8 +314,47 @@ func (c *Compiler) anonFunction(chunk *Chunk, anon *ast.AnonymousFunction) {
 	c.chunk.addOps(NewAnonFn, byte(len(anon.Params)), byte(defStart+1))
 }
 
+// Calls push each argument in order, so there is nowhere to fill in a
+// default or collect the rest of the arguments
+func (c *Compiler) checkParams(params []*ast.Parameter) {
+	for _, param := range params {
+		if param.Default != nil {
+			c.report("Default value for '%s' is not supported when compiling.", param.Token, param.Token.Lexeme).
+				Hint("make '%s' required and pass it in every call", param.Token.Lexeme)
+		} else if param.Variadic {
+			c.report("Variadic parameter '%s' is not supported when compiling.", param.Token, param.Token.Lexeme).
+				Hint("take a list instead")
+		}
+	}
+}
+
+// The body is skipped where it is written, the Defer operation only marks it
+// to be run by the function's Return. Locals are read by slot when it runs,
+// so it cannot be inside a block whose locals are gone by then.
+func (c *Compiler) deferStmt(chunk *Chunk, stmt *ast.Defer) {
+	if c.ids[len(c.ids)-1].local_depth > 0 {
+		c.report("Cannot defer inside a nested block when compiling.", stmt.Token).
+			Hint("move the 'defer' to the top of the function body")
+		return
+	}
+
+	skip := c.chunk.addOps(Defer, 0)
+
+	c.visit(chunk, stmt.Body)
+	c.chunk.addOp(EndDefer)
+
+	c.chunk.upateOpPosNext(skip)
+}
+
 func (c *Compiler) call(chunk *Chunk, call *ast.Call) {
 	for _, value := range call.Arguments {
+		// Arguments are taken by position, so a name cannot move one
+		if arg, ok := value.(*ast.Argument); ok {
+			c.report("Named argument '%s' is not supported when compiling.", arg.Token, arg.Token.Lexeme).
+				Hint("pass the arguments in the order of the parameters")
+			continue
+		}
+
 		c.visit(chunk, value)
 	}
 	c.chunk.addOps(Call, c.getVariable(call.Token.Lexeme))
@@ -294,30 +397,87 @@ func (c *Compiler) unaryOp(chunk *Chunk, unary *ast.UnaryOp) {
 func (c *Compiler) variableDecl(chunk *Chunk, decl *ast.VariableDecl) {
 	// Analyser should pickup clashes, so we don't need to check names
 	c.visit(chunk, decl.Expr)
+
+	if decl.Pattern != nil {
+		c.patternDecl(chunk, decl.Pattern)
+		return
+	}
+
 	slot, id := c.addVariable(decl.GetToken().Lexeme)
 
-	if c.depth > 0 || c.ids[len(c.ids)-1].local_depth > 0 {
+	if c.isLocal() {
 		c.chunk.addOps(SetLocal, slot)
 	} else {
 		c.chunk.addOps(Set, id)
 	}
 }
 
+func (c *Compiler) patternDecl(chunk *Chunk, pattern *ast.Pattern) {
+	c.destructure(chunk, pattern)
+
+	identifiers := pattern.Identifiers()
+	ids := make([]byte, 0, len(identifiers))
+
+	// Locals are already in their slots, as the values are left in order
+	for _, identifier := range identifiers {
+		_, id := c.addVariable(identifier.Lexeme)
+		ids = append(ids, id)
+	}
+
+	if c.isLocal() {
+		return
+	}
+
+	for idx := len(ids) - 1; idx >= 0; idx-- {
+		c.chunk.addOps(Set, ids[idx])
+	}
+}
+
+// Leave each value the pattern binds on the stack, in order
+func (c *Compiler) destructure(chunk *Chunk, pattern *ast.Pattern) {
+	switch pattern.Kind {
+	case ast.PATTERN_LIST:
+		rest := byte(0)
+		if pattern.Rest != nil {
+			rest = 1
+		}
+
+		c.chunk.addOps(Unpack, byte(len(pattern.Names)), rest)
+
+	case ast.PATTERN_FIELDS:
+		c.chunk.addOps(Fields, byte(len(pattern.Names)))
+
+		for _, name := range pattern.Names {
+			c.chunk.addOps(c.addIdentifier(name.Lexeme))
+		}
+	}
+}
+
 func (c *Compiler) variableAssign(chunk *Chunk, assign *ast.Assign) {
 	c.visit(chunk, assign.Expr)
 
-	if c.depth > 0 || c.ids[len(c.ids)-1].local_depth > 0 {
-		c.chunk.addOps(SetLocal, c.findVariableSlot(assign.Token.Lexeme))
-	} else {
-		c.chunk.addOps(Set, c.getVariable(assign.Token.Lexeme))
+	identifiers := []*lexer.Token{assign.Token}
+
+	if assign.Pattern != nil {
+		c.destructure(chunk, assign.Pattern)
+		identifiers = assign.Pattern.Identifiers()
 	}
 
-	c.chunk.addOp(Pop)
+	// The last value is on top of the stack, so assign in reverse
+	for idx := len(identifiers) - 1; idx >= 0; idx-- {
+		if slot, ok := c.findLocal(identifiers[idx].Lexeme); ok && c.isLocal() {
+			c.chunk.addOps(SetLocal, slot)
+			c.chunk.addOp(Pop)
+		} else {
+			// Set takes the value off the stack itself
+			c.chunk.addOps(Set, c.getVariable(identifiers[idx].Lexeme))
+		}
+	}
 }
 
 func (c *Compiler) getIdentifier(chunk *Chunk, identifier *ast.Identifier) {
-	if c.depth > 0 || c.ids[len(c.ids)-1].local_depth > 0 {
-		c.chunk.addOps(GetLocal, c.findVariableSlot(identifier.Token.Lexeme))
+	if slot, ok := c.findLocal(identifier.Token.Lexeme); ok && c.isLocal() {
+		c.chunk.addOps(GetLocal, slot)
 	} else {
 		c.chunk.addOps(Get, c.getVariable(identifier.Token.Lexeme))
 	}
@@ -375,3 +535,52 @@ func (c *Compiler) whileStmt(chunk *Chunk, stmt *ast.While) {
 	c.close()
 	c.chunk.upateOpPosNext(false_expr)
 }
+
+func (c *Compiler) forStmt(chunk *Chunk, stmt *ast.For) {
+	c.open()
+
+	// The iterator stays on the stack for the whole loop, under the body's locals
+	c.visit(chunk, stmt.Iterable)
+	c.chunk.addOp(Iter)
+	c.addVariable("<iterator>")
+
+	enumerate := byte(0)
+	if stmt.Index != nil {
+		enumerate = 1
+	}
+
+	next := len(c.chunk.Instructions)
+	exit := c.chunk.addOps(IterNext, 0, enumerate) - 1
+
+	// The values IterNext leaves are already in the slots of the loop's names
+	c.open()
+
+	if stmt.Index != nil {
+		c.addVariable(stmt.Index.Lexeme)
+	}
+	c.addVariable(stmt.Item.Lexeme)
+
+	c.body(chunk, stmt.Body)
+	c.close()
+
+	c.chunk.addOps(Jump, byte(next))
+	c.chunk.upateOpPosNext(exit)
+	c.close()
+}
+
+func (c *Compiler) rangeExpr(chunk *Chunk, expr *ast.Range) {
+	flags := byte(0)
+
+	if expr.Inclusive {
+		flags |= RANGE_INCLUSIVE
+	}
+
+	for idx, node := range []ast.Node{expr.Start, expr.End, expr.Step} {
+		if node != nil {
+			c.visit(chunk, node)
+			flags |= RANGE_START << idx
+		}
+	}
+
+	c.chunk.addOps(Range, flags)
+}
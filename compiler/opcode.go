@@ -43,6 +43,28 @@ const (
 
 	Return // Return scope_depth
 	Print
+
+	List   // List count
+	Unpack // Unpack count has_rest
+	Fields // Fields count name_index...
+
+	Iter     // Iter
+	IterNext // IterNext exit_ip enumerate
+	Range    // Range flags
+
+	NewGen // NewGen arity start name_index
+	Yield  // Yield
+
+	Defer    // Defer end_ip
+	EndDefer // EndDefer
+)
+
+// Flags of a Range operation, saying which parts are on the stack
+const (
+	RANGE_INCLUSIVE byte = 1 << iota
+	RANGE_START
+	RANGE_END
+	RANGE_STEP
 )
 
 type Chunk struct {
@@ -147,6 +169,10 @@ func (c *Chunk) PrintInstruction(sb *strings.Builder, index int, instructions []
 		sb.WriteString(fmt.Sprintf("NewFn<Params %d | Start %d | ID '%s'>", c.Instructions[idx+1], c.Instructions[idx+2], c.Constants[c.Instructions[idx+3]].Inspect()))
 		idx += 4
 
+	case NewGen:
+		sb.WriteString(fmt.Sprintf("NewGen<Params %d | Start %d | ID '%s'>", c.Instructions[idx+1], c.Instructions[idx+2], c.Constants[c.Instructions[idx+3]].Inspect()))
+		idx += 4
+
 	case NewAnonFn:
 		sb.WriteString(fmt.Sprintf("NewAnonFn<Params %d | Start %d>", c.Instructions[idx+1], c.Instructions[idx+2]))
 		idx += 3
@@ -171,6 +197,49 @@ func (c *Chunk) PrintInstruction(sb *strings.Builder, index int, instructions []
 		sb.WriteString("Return")
 		idx += 1
 
+	case Yield:
+		sb.WriteString("Yield")
+		idx += 1
+
+	case Defer:
+		sb.WriteString(fmt.Sprintf("Defer<End %d>", c.Instructions[idx+1]))
+		idx += 2
+
+	case EndDefer:
+		sb.WriteString("End Defer")
+		idx += 1
+
+	case List:
+		sb.WriteString(fmt.Sprintf("List<Count %d>", c.Instructions[idx+1]))
+		idx += 2
+
+	case Unpack:
+		sb.WriteString(fmt.Sprintf("Unpack<Count %d | Rest %t>", c.Instructions[idx+1], c.Instructions[idx+2] == 1))
+		idx += 3
+
+	case Fields:
+		count := int(c.Instructions[idx+1])
+		names := make([]string, 0, count)
+
+		for _, name := range c.Instructions[idx+2 : idx+2+count] {
+			names = append(names, fmt.Sprintf("'%s'", c.Constants[name].Inspect()))
+		}
+
+		sb.WriteString(fmt.Sprintf("Fields<IDs %s>", strings.Join(names, ", ")))
+		idx += 2 + count
+
+	case Iter:
+		sb.WriteString("Iter")
+		idx++
+
+	case IterNext:
+		sb.WriteString(fmt.Sprintf("IterNext<Exit %d | Enumerate %t>", c.Instructions[idx+1], c.Instructions[idx+2] == 1))
+		idx += 3
+
+	case Range:
+		sb.WriteString(fmt.Sprintf("Range<Flags %04b>", c.Instructions[idx+1]))
+		idx += 2
+
 	default:
 		sb.WriteString(fmt.Sprintf("Unknown<%d>", c.Instructions[idx]))
 		idx++
@@ -1,18 +1,26 @@
 package lexer
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 type Lexer struct {
 	source            string
+	path              string
 	line, column, pos int
+	// Doc comments waiting to be attached to the next token
+	doc []string
 }
 
-func New(source string) *Lexer {
-	return &Lexer{source, 1, 1, 0}
+func New(source string, path string) *Lexer {
+	return &Lexer{source: source, path: path, line: 1, column: 1, pos: 0}
 }
 
 func (lexer *Lexer) Next() *Token {
-	lexer.skipWhitespace()
+	if err := lexer.skipWhitespace(); err != nil {
+		return err
+	}
 
 	if lexer.isAtEnd() {
 		return lexer.makeEof()
@@ -37,15 +45,23 @@ func (lexer *Lexer) Next() *Token {
 
 // --- Private ---
 func (lexer *Lexer) makeEof() *Token {
-	return &Token{EOF, "EndOfFile", lexer.line, lexer.column}
+	return &Token{Kind: EOF, Lexeme: "EndOfFile", Line: lexer.line, Column: lexer.column, File: lexer.path}
 }
 
 func (lexer *Lexer) makeError(msg string, arg ...any) *Token {
-	return &Token{ERROR, fmt.Sprintf(msg, arg...), lexer.line, lexer.column}
+	return &Token{Kind: ERROR, Lexeme: fmt.Sprintf(msg, arg...), Line: lexer.line, Column: lexer.column, File: lexer.path}
 }
 
 func (lexer *Lexer) makeToken(kind TokenKind, lexeme string, column int) *Token {
-	return &Token{kind, lexeme, lexer.line, column}
+	token := &Token{Kind: kind, Lexeme: lexeme, Line: lexer.line, Column: column, File: lexer.path}
+
+	// Doc comments belong to whatever comes after them
+	if len(lexer.doc) > 0 {
+		token.Doc = strings.Join(lexer.doc, "\n")
+		lexer.doc = nil
+	}
+
+	return token
 }
 
 func (lexer *Lexer) peek() byte {
@@ -55,6 +71,13 @@ func (lexer *Lexer) peek() byte {
 	return lexer.source[lexer.pos]
 }
 
+func (lexer *Lexer) peekNext() byte {
+	if lexer.pos+1 >= len(lexer.source) {
+		return 0
+	}
+	return lexer.source[lexer.pos+1]
+}
+
 func (lexer *Lexer) advance() {
 	lexer.column++
 	lexer.pos++
@@ -98,14 +121,19 @@ func (lexer *Lexer) match(expected byte) bool {
 	return true
 }
 
-func (lexer *Lexer) skipWhitespace() {
+func (lexer *Lexer) skipWhitespace() *Token {
 	for !lexer.isAtEnd() {
 		switch lexer.peek() {
 		case '#':
-			{
-				for !lexer.isAtEnd() && lexer.peek() != '\n' {
-					lexer.advance()
-				}
+			lexer.lineComment()
+
+		case '/':
+			if lexer.peekNext() != '*' {
+				return nil
+			}
+
+			if err := lexer.blockComment(); err != nil {
+				return err
 			}
 
 		case '\n':
@@ -117,9 +145,60 @@ func (lexer *Lexer) skipWhitespace() {
 			lexer.advance()
 
 		default:
-			return
+			return nil
 		}
 	}
+
+	return nil
+}
+
+// Line comments starting with '##' are kept as documentation
+func (lexer *Lexer) lineComment() {
+	start := lexer.pos
+
+	for !lexer.isAtEnd() && lexer.peek() != '\n' {
+		lexer.advance()
+	}
+
+	comment := lexer.source[start:lexer.pos]
+
+	if strings.HasPrefix(comment, "##") {
+		lexer.doc = append(lexer.doc, strings.TrimSpace(comment[2:]))
+	}
+}
+
+// Block comments can be nested, so commenting out code containing them is safe
+func (lexer *Lexer) blockComment() *Token {
+	line, column := lexer.line, lexer.column
+	depth := 0
+
+	for !lexer.isAtEnd() {
+		switch {
+		case lexer.peek() == '/' && lexer.peekNext() == '*':
+			depth++
+			lexer.advance()
+			lexer.advance()
+
+		case lexer.peek() == '*' && lexer.peekNext() == '/':
+			depth--
+			lexer.advance()
+			lexer.advance()
+
+			if depth == 0 {
+				return nil
+			}
+
+		case lexer.peek() == '\n':
+			lexer.line++
+			lexer.column = 1
+			lexer.pos++
+
+		default:
+			lexer.advance()
+		}
+	}
+
+	return &Token{Kind: ERROR, Lexeme: "Unterminated block comment", Line: line, Column: column, File: lexer.path}
 }
 
 func (lexer *Lexer) readChars() *Token {
@@ -155,6 +234,24 @@ func (lexer *Lexer) readChars() *Token {
 	case ';':
 		kind = SEMICOLON
 	case '.':
+		if lexer.peek() == '.' && lexer.peekNext() == '.' {
+			lexer.advance()
+			lexer.advance()
+			kind = ELLIPSIS
+			size = 3
+			break
+		}
+
+		if lexer.match('.') {
+			kind = DOT_DOT
+			size = 2
+
+			if lexer.match('=') {
+				kind = DOT_DOT_EQUAL
+				size = 3
+			}
+			break
+		}
 		kind = DOT
 	case ',':
 		kind = COMMA
@@ -172,6 +269,10 @@ func (lexer *Lexer) readChars() *Token {
 			kind = OR
 			size = 2
 			break
+		} else if lexer.match('>') {
+			kind = PIPELINE
+			size = 2
+			break
 		}
 		kind = PIPE
 
@@ -211,6 +312,18 @@ func (lexer *Lexer) readChars() *Token {
 		}
 		kind = LESS
 
+	case '?':
+		if lexer.match('.') {
+			kind = QUESTION_DOT
+		} else if lexer.match('[') {
+			kind = QUESTION_SQUARE
+		} else if lexer.match('?') {
+			kind = QUESTION_QUESTION
+		} else {
+			return lexer.makeError("Unknown character found '%q'", string(current))
+		}
+		size = 2
+
 	default:
 		return lexer.makeError("Unknown character found '%q'", string(current))
 	}
@@ -227,7 +340,8 @@ func (lexer *Lexer) readDigit() *Token {
 	for !lexer.isAtEnd() && isDigit(lexer.peek()) {
 		lexer.advance()
 
-		if lexer.peek() == '.' {
+		// Two dots start a range, like '0..10'
+		if lexer.peek() == '.' && lexer.peekNext() != '.' {
 			if kind == FLOAT {
 				return lexer.makeError("Floating point number cannot have multiple decimals %d:%d", lexer.line, lexer.column)
 			}
@@ -240,18 +354,35 @@ func (lexer *Lexer) readDigit() *Token {
 	return lexer.makeToken(kind, lexer.source[start:lexer.pos], start_col)
 }
 
+// String tokens start at their opening quote, but the lexeme leaves the
+// quotes out
 func (lexer *Lexer) readString() *Token {
+	line, start_col := lexer.line, lexer.column
 	lexer.advance()
 
 	start := lexer.pos
-	start_col := lexer.column
 
 	for !lexer.isAtEnd() && lexer.peek() != '"' {
+		// Strings can span lines, which must still be counted
+		if lexer.peek() == '\n' {
+			lexer.line++
+			lexer.column = 1
+			lexer.pos++
+			continue
+		}
+
 		lexer.advance()
 	}
 
+	if lexer.isAtEnd() {
+		return &Token{Kind: ERROR, Lexeme: "Unterminated string", Line: line, Column: start_col, File: lexer.path}
+	}
+
 	lexer.advance()
-	return lexer.makeToken(STRING, lexer.source[start:lexer.pos-1], start_col)
+
+	token := lexer.makeToken(STRING, lexer.source[start:lexer.pos-1], start_col)
+	token.Line = line
+	return token
 }
 
 func (lexer *Lexer) readIdentifier() *Token {
@@ -1,13 +1,14 @@
 package lexer
 
 import (
+	"strings"
 	"testing"
 	"tiny/shared"
 )
 
 func TestValidTokens(t *testing.T) {
 	source := shared.ReadFile("../tests/valid/lexer/tokens.tiny")
-	lexer := New(source)
+	lexer := New(source, "")
 
 	for {
 		token := lexer.Next()
@@ -21,3 +22,104 @@ func TestValidTokens(t *testing.T) {
 		}
 	}
 }
+
+func TestComments(t *testing.T) {
+	source := shared.ReadFile("../tests/valid/lexer/comments.tiny")
+	lexer := New(source, "")
+	documented := false
+
+	for {
+		token := lexer.Next()
+
+		if token.Kind == EOF {
+			break
+		}
+
+		if token.Kind == ERROR {
+			t.Fatal(token.Lexeme)
+		}
+
+		if token.Kind == IDENTIFIER && token.Lexeme == "c" {
+			t.Fatalf("Identifier inside block comment was lexed [%d:%d]", token.Line, token.Column)
+		}
+
+		if token.Kind == FUNCTION {
+			documented = token.Doc == "Documentation comment"
+		}
+	}
+
+	if !documented {
+		t.Fatal("Doc comment was not attached to function")
+	}
+}
+
+func TestUnterminatedComment(t *testing.T) {
+	source := shared.ReadFile("../tests/invalid/lexer/unterminated_comment.tiny")
+	lexer := New(source, "")
+
+	for {
+		token := lexer.Next()
+
+		if token.Kind == EOF {
+			t.Fatal("Expected unterminated block comment error")
+		}
+
+		if token.Kind == ERROR {
+			break
+		}
+	}
+}
+
+func TestUnterminatedString(t *testing.T) {
+	source := shared.ReadFile("../tests/invalid/lexer/unterminated_string.tiny")
+	lexer := New(source, "")
+
+	for {
+		token := lexer.Next()
+
+		if token.Kind == EOF {
+			t.Fatal("Expected unterminated string error")
+		}
+
+		if token.Kind == ERROR {
+			if token.Line != 1 || token.Column != 9 {
+				t.Fatalf("Expected the error at the opening quote 1:9, but received %d:%d", token.Line, token.Column)
+			}
+			break
+		}
+	}
+}
+
+// Lines inside a string are counted, so what follows it is placed right
+func TestStringLines(t *testing.T) {
+	lexer := New("\"a\nb\" c", "")
+
+	if token := lexer.Next(); token.Kind != STRING || token.Line != 1 {
+		t.Fatalf("Expected the string on line 1, but received '%s' on %d", token.Lexeme, token.Line)
+	}
+
+	if token := lexer.Next(); token.Lexeme != "c" || token.Line != 2 || token.Column != 4 {
+		t.Fatalf("Expected 'c' at 2:4, but received '%s' at %d:%d", token.Lexeme, token.Line, token.Column)
+	}
+}
+
+// Diagnostics on strings underline the quotes as well as what is between them
+func TestStringSpan(t *testing.T) {
+	source := "print(\"héllo\");\n"
+	lexer := New(source, "span.tiny")
+
+	lexer.Next()
+	lexer.Next()
+	token := lexer.Next()
+
+	if token.Kind != STRING || token.Lexeme != "héllo" || token.Column != 7 || token.Length() != 7 {
+		t.Fatalf("Expected string 'héllo' at column 7 with length 7, but received '%s' at %d with length %d", token.Lexeme, token.Column, token.Length())
+	}
+
+	shared.RegisterSource("span.tiny", source)
+	rendered := shared.NewDiagnostic("Analysis", "Bad string").At(token.File, token.Line, token.Column, token.Length()).Render(false)
+
+	if expected := "  |       ^^^^^^^\n"; !strings.HasSuffix(rendered, expected) {
+		t.Fatalf("Expected underline '%s' but received:\n%s", expected, rendered)
+	}
+}
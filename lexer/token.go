@@ -1,5 +1,7 @@
 package lexer
 
+import "unicode/utf8"
+
 type TokenKind uint8
 
 const (
@@ -22,8 +24,15 @@ const (
 	COLON
 	SEMICOLON
 	DOT
+	DOT_DOT
+	DOT_DOT_EQUAL
+	QUESTION_DOT
+	QUESTION_SQUARE
+	QUESTION_QUESTION
+	ELLIPSIS
 	COMMA
 	FAT_ARROW
+	PIPELINE
 
 	OPENCURLY
 	CLOSECURLY
@@ -46,11 +55,15 @@ const (
 
 	THROW
 	CATCH
+	FINALLY
+	YIELD
+	DEFER
 
 	IDENTIFIER
 	PRINT
 	VAR
 	LET
+	CONST
 	FUNCTION
 	SELF
 	CLASS
@@ -65,6 +78,12 @@ const (
 	FOR
 	IN
 	INTO
+	PUB
+	PRIV
+	ENUM
+	TRAIT
+	IMPL
+	STATIC
 
 	EOF
 	ERROR
@@ -74,11 +93,27 @@ type Token struct {
 	Kind         TokenKind
 	Lexeme       string
 	Line, Column int
+	// Doc comment ('##') lines directly preceding this token
+	Doc  string
+	File string
+}
+
+// Number of characters the token spans in its source
+func (token *Token) Length() int {
+	switch token.Kind {
+	case EOF, ERROR:
+		return 1
+	case STRING:
+		return utf8.RuneCountInString(token.Lexeme) + 2
+	}
+
+	return utf8.RuneCountInString(token.Lexeme)
 }
 
 var KeyWords = map[string]TokenKind{
 	"var":       VAR,
 	"let":       LET,
+	"const":     CONST,
 	"print":     PRINT,
 	"function":  FUNCTION,
 	"self":      SELF,
@@ -90,6 +125,9 @@ var KeyWords = map[string]TokenKind{
 	"else":      ELSE,
 	"throw":     THROW,
 	"catch":     CATCH,
+	"finally":   FINALLY,
+	"yield":     YIELD,
+	"defer":     DEFER,
 	"import":    IMPORT,
 	"namespace": NAMESPACE,
 	"test":      TEST,
@@ -99,6 +137,12 @@ var KeyWords = map[string]TokenKind{
 	"for":       FOR,
 	"in":        IN,
 	"into":      INTO,
+	"pub":       PUB,
+	"priv":      PRIV,
+	"enum":      ENUM,
+	"trait":     TRAIT,
+	"impl":      IMPL,
+	"static":    STATIC,
 	// These will be temporary, they will become a value later?
 	"true":  BOOL,
 	"false": BOOL,
@@ -119,20 +163,40 @@ func (kind TokenKind) Name() string {
 		return "string"
 	case VAR:
 		return "var"
+	case CONST:
+		return "const"
 	case FUNCTION:
 		return "function"
 	case CLASS:
 		return "class"
 	case STRUCT:
 		return "struct"
+	case ENUM:
+		return "enum"
+	case TRAIT:
+		return "trait"
+	case IMPL:
+		return "impl"
+	case STATIC:
+		return "static"
 	case IDENTIFIER:
 		return "identifier"
 	case THROW:
 		return "throw"
 	case CATCH:
 		return "catch"
+	case FINALLY:
+		return "finally"
+	case YIELD:
+		return "yield"
+	case DEFER:
+		return "defer"
 	case IMPORT:
 		return "import"
+	case PUB:
+		return "pub"
+	case PRIV:
+		return "priv"
 	case IF:
 		return "if"
 	case ELSE:
@@ -161,6 +225,18 @@ func (kind TokenKind) Name() string {
 		return "="
 	case DOT:
 		return "."
+	case DOT_DOT:
+		return ".."
+	case DOT_DOT_EQUAL:
+		return "..="
+	case QUESTION_DOT:
+		return "?."
+	case QUESTION_SQUARE:
+		return "?["
+	case QUESTION_QUESTION:
+		return "??"
+	case ELLIPSIS:
+		return "..."
 	case COLON:
 		return ":"
 	case SEMICOLON:
@@ -169,10 +245,14 @@ func (kind TokenKind) Name() string {
 		return "AMPERSAND"
 	case PIPE:
 		return "PIPE"
+	case PIPELINE:
+		return "|>"
 	case AND:
 		return "AND"
 	case OR:
 		return "OR"
+	case EOF:
+		return "EOF"
 	default:
 		return "Unknown"
 	}
@@ -1,7 +1,10 @@
 package main
 
-import "tiny/tiny"
+import (
+	"os"
+	"tiny/tiny"
+)
 
 func main() {
-	tiny.New().Run()
+	os.Exit(tiny.New().Run(os.Args[1:]))
 }
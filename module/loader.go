@@ -0,0 +1,407 @@
+package module
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"tiny/analysis"
+	"tiny/ast"
+	"tiny/lexer"
+	"tiny/parser"
+	"tiny/runtime"
+	"tiny/shared"
+)
+
+const (
+	// Environment variable listing extra directories to search for imports
+	SEARCH_PATH_ENV = "TINYPATH"
+	// Name given to source run through builtin.eval
+	EVAL_PATH = "<eval>"
+)
+
+type Module struct {
+	Path    string
+	Program *ast.Program
+	// Names of the declarations marked 'pub'
+	Exports []string
+	value   *runtime.NameSpaceValue
+	running bool
+}
+
+// Loader finds, parses and analyses imported files, each only once, and
+// creates their namespace the first time they are imported while running
+type Loader struct {
+	SearchPath     []string
+	NewAnalyser    func() *analysis.Analyser
+	NewInterpreter func() *runtime.Interpreter
+	modules        map[string]*Module
+}
+
+func NewLoader(searchPath []string, newAnalyser func() *analysis.Analyser, newInterpreter func() *runtime.Interpreter) *Loader {
+	if env := os.Getenv(SEARCH_PATH_ENV); len(env) > 0 {
+		searchPath = append(searchPath, filepath.SplitList(env)...)
+	}
+
+	return &Loader{SearchPath: searchPath, NewAnalyser: newAnalyser, NewInterpreter: newInterpreter, modules: make(map[string]*Module)}
+}
+
+// Resolve loads every file the program imports, recording where each import
+// points so the analyser and interpreter can find the module again
+func (loader *Loader) Resolve(program *ast.Program, path string) int {
+	if err := loader.resolve(program, importDir(path), chain(path)); err != nil {
+		for _, diagnostic := range err.diagnostics {
+			shared.Emit(diagnostic)
+		}
+		return err.code
+	}
+
+	return shared.EXIT_OK
+}
+
+// Declare makes the public members of every loaded module known to an analyser
+func (loader *Loader) Declare(analyser *analysis.Analyser) {
+	for path, module := range loader.modules {
+		analyser.DeclareModule(path, module.Exports)
+	}
+}
+
+// Load runs a module the first time it is imported, creating a namespace of
+// its public members which is shared with every later import
+func (loader *Loader) Load(interpreter *runtime.Interpreter, imp *ast.Import) runtime.Value {
+	module, ok := loader.modules[imp.Path]
+	if !ok {
+		interpreter.ReportT("Module '%s' has not been loaded", imp.Token, imp.Token.Lexeme)
+		return nil
+	}
+
+	value, err := loader.run(module)
+	if err != nil {
+		// Keep the location inside the module, as that is where it went wrong
+		panic(err)
+	}
+
+	if thrown, ok := value.(*runtime.ThrowValue); ok {
+		interpreter.ReportT("Uncaught value thrown '%s' while loading module '%s'", imp.Token, thrown.GetInner().Inspect(), imp.Token.Lexeme)
+		return nil
+	}
+
+	return value
+}
+
+// Import loads a module while running. Anything stopping it from loading is
+// thrown, so scripts can catch it.
+func (loader *Loader) Import(interpreter *runtime.Interpreter, name string, token *lexer.Token) runtime.Value {
+	path, ok := loader.find(name, importDir(token.File))
+	if !ok {
+		return thrown(diagnosticAt("Could not find module '%s'", token, name))
+	}
+
+	if err := loader.load(path, token, chain(token.File)); err != nil {
+		return thrown(err.diagnostics...)
+	}
+
+	value, err := loader.run(loader.modules[path])
+	if err != nil {
+		return thrown(err.Diagnostic)
+	}
+
+	return value
+}
+
+// Eval runs source on its own, returning a namespace of everything it declares
+func (loader *Loader) Eval(source string) runtime.Value {
+	program, diagnostics := parser.New(source, EVAL_PATH, false).Parse()
+	if len(diagnostics) > 0 {
+		return thrown(diagnostics...)
+	}
+
+	if err := loader.resolve(program, importDir(EVAL_PATH), chain(EVAL_PATH)); err != nil {
+		return thrown(err.diagnostics...)
+	}
+
+	if err := loader.analyse(program); err != nil {
+		return thrown(err.diagnostics...)
+	}
+
+	interpreter := loader.NewInterpreter()
+
+	result, err := interpreter.Execute(program)
+	if err != nil {
+		return thrown(err.Diagnostic)
+	}
+
+	if _, ok := result.(*runtime.ThrowValue); ok {
+		return result
+	}
+
+	return namespace(interpreter, "eval", declarations(program, false))
+}
+
+// --- Private ---
+
+// A module which could not be loaded, with the status to exit with
+type loadError struct {
+	code        int
+	diagnostics []*shared.Diagnostic
+}
+
+func failed(code int, diagnostics ...*shared.Diagnostic) *loadError {
+	return &loadError{code: code, diagnostics: diagnostics}
+}
+
+func (loader *Loader) resolve(program *ast.Program, dir string, chain []string) *loadError {
+	for _, stmt := range program.Body.Statements {
+		imp, ok := stmt.(*ast.Import)
+		if !ok {
+			continue
+		}
+
+		path, ok := loader.find(imp.Token.Lexeme, dir)
+		if !ok {
+			return failed(shared.EXIT_ANALYSIS, diagnosticAt("Could not find module '%s'", imp.Token, imp.Token.Lexeme).
+				Note("searched next to the importing file and in: %s", loader.searched()))
+		}
+
+		imp.Path = path
+
+		if err := loader.load(path, imp.Token, chain); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (loader *Loader) load(path string, token *lexer.Token, chain []string) *loadError {
+	for idx, link := range chain {
+		if link == path {
+			cycle := append(append([]string{}, chain[idx:]...), path)
+
+			for idx, file := range cycle {
+				cycle[idx] = displayPath(file)
+			}
+
+			return failed(shared.EXIT_ANALYSIS, diagnosticAt("Import cycle found: %s", token, strings.Join(cycle, " -> ")).
+				Hint("move the code both files need into a separate file"))
+		}
+	}
+
+	if _, ok := loader.modules[path]; ok {
+		return nil
+	}
+
+	source, ok := shared.ReadFileErr(path)
+	if !ok {
+		return failed(shared.EXIT_FAILURE, diagnosticAt("Could not read module '%s'", token, token.Lexeme))
+	}
+
+	program, diagnostics := parser.New(source, displayPath(path), false).Parse()
+	if len(diagnostics) > 0 {
+		return failed(shared.EXIT_SYNTAX, diagnostics...)
+	}
+
+	if err := loader.resolve(program, filepath.Dir(path), append(chain, path)); err != nil {
+		return err
+	}
+
+	if err := loader.analyse(program); err != nil {
+		return err
+	}
+
+	loader.modules[path] = &Module{Path: path, Program: program, Exports: declarations(program, true)}
+	return nil
+}
+
+func (loader *Loader) analyse(program *ast.Program) *loadError {
+	analyser := loader.NewAnalyser()
+	analyser.SetQuiet(true)
+
+	if !analyser.Run(program.Body) {
+		return failed(shared.EXIT_ANALYSIS, analyser.Diagnostics()...)
+	}
+
+	// Only warnings are left, which should still be seen
+	for _, diagnostic := range analyser.Diagnostics() {
+		shared.Emit(diagnostic)
+	}
+
+	return nil
+}
+
+// Reset forgets the namespaces of modules which have run, so the next import
+// runs them again. Files stay parsed and analysed.
+func (loader *Loader) Reset() {
+	for _, module := range loader.modules {
+		module.value = nil
+	}
+}
+
+// Run a module the first time it is needed, keeping its namespace for later
+func (loader *Loader) run(module *Module) (runtime.Value, *runtime.RuntimeError) {
+	if module.value != nil {
+		return module.value, nil
+	}
+
+	// Only dynamic imports can reach a module which is still running
+	if module.running {
+		return nil, &runtime.RuntimeError{Diagnostic: shared.NewDiagnostic("Import", "Module '%s' was imported while it is still loading", displayPath(module.Path))}
+	}
+
+	module.running = true
+	defer func() { module.running = false }()
+
+	interpreter := loader.NewInterpreter()
+
+	result, err := interpreter.Execute(module.Program)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := result.(*runtime.ThrowValue); ok {
+		return result, nil
+	}
+
+	module.value = namespace(interpreter, moduleName(module.Path), module.Exports)
+	return module.value, nil
+}
+
+// Find an import next to the importing file first, then on the search path
+func (loader *Loader) find(name string, dir string) (string, bool) {
+	if filepath.Ext(name) != ".tiny" {
+		name += ".tiny"
+	}
+
+	if filepath.IsAbs(name) {
+		return name, fileExists(name)
+	}
+
+	for _, base := range append([]string{dir}, loader.SearchPath...) {
+		if path, err := filepath.Abs(filepath.Join(base, name)); err == nil && fileExists(path) {
+			return path, true
+		}
+	}
+
+	return "", false
+}
+
+func (loader *Loader) searched() string {
+	if len(loader.SearchPath) == 0 {
+		return "(no search path, set " + SEARCH_PATH_ENV + " or use --path)"
+	}
+
+	return strings.Join(loader.SearchPath, string(filepath.ListSeparator))
+}
+
+// Names declared at the top level of a program, or only those marked 'pub'
+func declarations(program *ast.Program, public bool) []string {
+	names := make([]string, 0)
+
+	for _, stmt := range program.Body.Statements {
+		declared, exported := false, false
+
+		switch n := stmt.(type) {
+		case *ast.FunctionDef:
+			declared, exported = true, n.Public
+		case *ast.ClassDef:
+			declared, exported = true, n.Public
+		case *ast.StructDef:
+			declared, exported = true, n.Public
+		case *ast.EnumDef:
+			declared, exported = true, n.Public
+		case *ast.TraitDef:
+			declared, exported = true, n.Public
+		case *ast.NameSpace:
+			declared, exported = true, n.Public
+		case *ast.VariableDecl:
+			declared, exported = true, n.Public
+		}
+
+		if !declared || (public && !exported) {
+			continue
+		}
+
+		if decl, ok := stmt.(*ast.VariableDecl); ok && decl.Pattern != nil {
+			for _, identifier := range decl.Pattern.Identifiers() {
+				names = append(names, identifier.Lexeme)
+			}
+			continue
+		}
+
+		names = append(names, stmt.GetToken().Lexeme)
+	}
+
+	return names
+}
+
+func namespace(interpreter *runtime.Interpreter, identifier string, names []string) *runtime.NameSpaceValue {
+	value := &runtime.NameSpaceValue{Identifier: identifier, Members: make(map[string]runtime.Value, len(names))}
+
+	for _, name := range names {
+		if member, ok := interpreter.Global(name); ok {
+			value.Members[name] = member
+		}
+	}
+
+	return value
+}
+
+// Errors found while loading are thrown as a message describing each of them
+func thrown(diagnostics ...*shared.Diagnostic) runtime.Value {
+	messages := make([]string, 0, len(diagnostics))
+
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Line == 0 {
+			messages = append(messages, fmt.Sprintf("%s error: %s", diagnostic.Kind, diagnostic.Message))
+		} else {
+			messages = append(messages, fmt.Sprintf("%s error: %s", diagnostic.Kind, diagnostic.String()))
+		}
+	}
+
+	return runtime.NewThrow(&runtime.StringVal{Value: strings.Join(messages, "\n")})
+}
+
+func diagnosticAt(msg string, token *lexer.Token, args ...any) *shared.Diagnostic {
+	return shared.NewDiagnostic("Import", msg, args...).At(token.File, token.Line, token.Column, token.Length())
+}
+
+// The files being loaded, starting with the one importing
+func chain(path string) []string {
+	chain := make([]string, 0, 1)
+
+	// Sources without a file, such as stdin, cannot be imported back
+	if abs, err := filepath.Abs(path); err == nil && fileExists(abs) {
+		chain = append(chain, abs)
+	}
+
+	return chain
+}
+
+// Imports in sources without a file are relative to the working directory
+func importDir(path string) string {
+	if fileExists(path) {
+		return filepath.Dir(path)
+	}
+
+	return "."
+}
+
+func moduleName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
+
+// Show paths relative to the working directory where possible, as they are shorter
+func displayPath(path string) string {
+	if cwd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(cwd, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return rel
+		}
+	}
+
+	return path
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
@@ -3,85 +3,148 @@ package parser
 import (
 	"fmt"
 	"path/filepath"
+	"strings"
 	"tiny/ast"
 	"tiny/lexer"
 	"tiny/shared"
+	"unicode"
 )
 
-type ParserState struct {
-	lexer   *lexer.Lexer
-	current *lexer.Token
-}
-
 type Parser struct {
-	lexer   *lexer.Lexer
-	current *lexer.Token
-	stack   []ParserState
-	files   []string
-	test    bool
+	lexer       *lexer.Lexer
+	current     *lexer.Token
+	path        string
+	test        bool
+	diagnostics []*shared.Diagnostic
+	// Whether the function body being parsed has yielded
+	yielded bool
+	// Brackets passed but not yet closed, so recovering can skip to the end
+	// of those a failed statement opened
+	depth int
 }
 
-func New(source string, path string, test bool) *Parser {
-	lexer := lexer.New(source)
-	files := make([]string, 1)
+// Raised by reportFatal to unwind to the closest point the parser can recover from
+type parseError struct{}
 
-	initPath, _ := filepath.Abs(path)
-	files[0] = initPath
+func New(source string, path string, test bool) *Parser {
+	shared.RegisterSource(path, source)
+	lexer := lexer.New(source, path)
 
-	return &Parser{lexer, lexer.Next(), make([]ParserState, 0), files, test}
+	return &Parser{lexer: lexer, current: lexer.Next(), path: path, test: test}
 }
 
-func (parser *Parser) Parse() *ast.Program {
+// Parse the whole source, returning every syntax error found along the way.
+// The program is incomplete when any diagnostics are returned.
+func (parser *Parser) Parse() (*ast.Program, []*shared.Diagnostic) {
 	program := ast.New()
 	parser.outerStatements(program.Body)
-	return program
+	return program, parser.diagnostics
 }
 
 func ParseStr(source string) ast.Node {
-	lex := lexer.New(source)
-	parser := &Parser{lex, lex.Next(), make([]ParserState, 0), make([]string, 0), false}
+	lex := lexer.New(source, "")
+	parser := &Parser{lexer: lex, current: lex.Next()}
 	return parser.statement(ast.NewBlock(&lexer.Token{Kind: lexer.EOF, Lexeme: "...", Line: 0, Column: 0}))
 }
 
 // --- Private ---
-func report(msg string, args ...any) {
-	res := fmt.Sprintf(msg, args...)
-	shared.ReportErrFatal(res)
+func (parser *Parser) report(token *lexer.Token, expected string, msg string, args ...any) {
+	diagnostic := shared.NewDiagnostic("Syntax", msg, args...).At(parser.path, token.Line, token.Column, token.Length())
+	diagnostic.Expected = expected
+	diagnostic.Found = token.Lexeme
+
+	// Lexer errors describe themselves better than the parser can
+	if token.Kind == lexer.ERROR {
+		diagnostic.Message = token.Lexeme
+		diagnostic.Expected = ""
+		diagnostic.Found = ""
+	}
+
+	parser.diagnostics = append(parser.diagnostics, diagnostic)
 }
 
-func (parser *Parser) fileExists(path string) bool {
-	for _, file := range parser.files {
-		if shared.SameFile(file, path) {
-			return true
+// Record the error and abandon the current statement
+func (parser *Parser) reportFatal(token *lexer.Token, expected string, msg string, args ...any) {
+	parser.report(token, expected, msg, args...)
+	panic(parseError{})
+}
+
+// Run a parsing step, recovering from a syntax error by skipping ahead to the
+// next statement boundary, so the rest of the file can still be checked
+func (parser *Parser) synchronised(step func()) {
+	start := parser.current
+	depth := parser.depth
+
+	defer func() {
+		if err := recover(); err != nil {
+			if _, ok := err.(parseError); !ok {
+				panic(err)
+			}
+
+			// Always make progress, otherwise the same token fails forever
+			if parser.current == start {
+				parser.advance()
+			}
+			parser.synchronise(depth)
 		}
-	}
-	return false
+	}()
+
+	step()
 }
 
-func (parser *Parser) pushState(path string) {
-	parser.stack = append(parser.stack, ParserState{parser.lexer, parser.current})
-	parser.files = append(parser.files, path)
+// Skips to the next statement, first closing any brackets opened since depth
+// so their contents are not mistaken for statements
+func (parser *Parser) synchronise(depth int) {
+	for parser.current.Kind != lexer.EOF {
+		if parser.depth > depth {
+			parser.advance()
+			continue
+		}
 
-	lexer := lexer.New(shared.ReadFile(path))
+		switch parser.current.Kind {
+		case lexer.SEMICOLON:
+			parser.advance()
+			return
+
+		case lexer.CLOSECURLY, lexer.VAR, lexer.LET, lexer.CONST, lexer.FUNCTION, lexer.CLASS, lexer.STRUCT, lexer.ENUM, lexer.TRAIT,
+			lexer.NAMESPACE, lexer.RETURN, lexer.IF, lexer.WHILE, lexer.FOR, lexer.THROW,
+			lexer.PRINT, lexer.IMPORT, lexer.TEST, lexer.MATCH:
+			return
+		}
 
-	parser.lexer = lexer
-	parser.current = lexer.Next()
+		parser.advance()
+	}
 }
 
-func (parser *Parser) popState() {
-	state := parser.stack[len(parser.stack)-1]
+func (parser *Parser) advance() {
+	if parser.current.Kind != lexer.EOF {
+		parser.next()
+	}
+}
 
-	parser.lexer = state.lexer
-	parser.current = state.current
+// Moves past the current token, keeping count of the brackets left open
+func (parser *Parser) next() {
+	switch parser.current.Kind {
+	case lexer.OPENCURLY, lexer.OPENPAREN, lexer.OPENSQUARE:
+		parser.depth++
+	case lexer.CLOSECURLY, lexer.CLOSEPAREN, lexer.CLOSESQUARE:
+		parser.depth--
+	}
 
-	parser.stack = parser.stack[:len(parser.stack)-1]
+	parser.current = parser.lexer.Next()
+}
+
+// Loops over delimited items must also stop at the end of the file, as the
+// closing token may be missing
+func (parser *Parser) until(end lexer.TokenKind) bool {
+	return parser.current.Kind != end && parser.current.Kind != lexer.EOF
 }
 
 func (parser *Parser) consume(expected lexer.TokenKind) {
 	if parser.current.Kind == expected {
-		parser.current = parser.lexer.Next()
+		parser.next()
 	} else {
-		report("Expected token kind '%s' but received '%s':%s [%d:%d] '%s'", expected.Name(), parser.current.Lexeme, parser.current.Kind.Name(), parser.current.Line, parser.current.Column, parser.files[len(parser.files)-1])
+		parser.reportFatal(parser.current, fmt.Sprintf("'%s'", expected.Name()), "Expected token kind '%s' but received '%s':%s", expected.Name(), parser.current.Lexeme, parser.current.Kind.Name())
 	}
 }
 
@@ -100,15 +163,28 @@ func (parser *Parser) match(expected ...lexer.TokenKind) (*lexer.Token, bool) {
 
 func (parser *Parser) consumeIfExists(expected lexer.TokenKind) {
 	if parser.current.Kind == expected {
-		parser.current = parser.lexer.Next()
+		parser.next()
 	}
 }
 
 func (parser *Parser) functionCall(outer *ast.Block, callee ast.Node) ast.Node {
 	arguments := make([]ast.Node, 0)
 
+	named := false
+
 	for parser.current.Kind != lexer.CLOSEPAREN {
-		arguments = append(arguments, parser.expr(outer))
+		arg := parser.expr(outer)
+
+		// Named arguments look like 'name: value'
+		if id, ok := arg.(*ast.Identifier); ok && parser.current.Kind == lexer.COLON {
+			parser.consume(lexer.COLON)
+			arg = &ast.Argument{Token: id.Token, Expr: parser.expr(outer)}
+			named = true
+		} else if named {
+			parser.report(arg.GetToken(), "", "Positional arguments cannot follow named arguments")
+		}
+
+		arguments = append(arguments, arg)
 		parser.consumeIfExists(lexer.COMMA)
 	}
 	parser.consume(lexer.CLOSEPAREN)
@@ -162,6 +238,10 @@ func (parser *Parser) primary(outer *ast.Block) ast.Node {
 	case lexer.CATCH:
 		return parser.catch(outer)
 
+	case lexer.IMPORT:
+		parser.consume(lexer.IMPORT)
+		return &ast.ImportExpr{Token: ftoken, Expr: parser.primary(outer)}
+
 	case lexer.BREAK:
 		parser.consume(lexer.BREAK)
 		return &ast.Break{Token: ftoken}
@@ -174,26 +254,38 @@ func (parser *Parser) primary(outer *ast.Block) ast.Node {
 		return parser.block()
 	}
 
-	report("Unexpected token found in expression '%s': [%d:%d]", parser.current.Lexeme, parser.current.Line, parser.current.Column)
+	parser.reportFatal(parser.current, "expression", "Unexpected token found in expression '%s'", parser.current.Lexeme)
 	return nil
 }
 
 func (parser *Parser) call(outer *ast.Block) ast.Node {
 	node := parser.primary(outer)
 
+	// Once a step is optional the rest of the chain is too, so 'a?.b.c()'
+	// gives back unit when 'a' is unit, instead of failing at '.c'
+	optional := false
+
 	for {
+		if _, ok := parser.match(lexer.QUESTION_DOT); ok {
+			optional = true
+
+			if parser.current.Kind != lexer.OPENPAREN {
+				node = parser.field(node, optional)
+				continue
+			}
+		}
+
 		if _, ok := parser.match(lexer.OPENPAREN); ok {
-			node = parser.functionCall(outer, node)
+			call := parser.functionCall(outer, node).(*ast.Call)
+			call.Optional = optional
+			node = call
 		} else if _, ok := parser.match(lexer.OPENSQUARE); ok {
-			expr := parser.expr(outer)
-			parser.consume(lexer.CLOSESQUARE)
-
-			node = &ast.Index{Token: node.GetToken(), Caller: node, Expr: expr}
+			node = parser.index(outer, node, optional)
+		} else if _, ok := parser.match(lexer.QUESTION_SQUARE); ok {
+			optional = true
+			node = parser.index(outer, node, optional)
 		} else if _, ok := parser.match(lexer.DOT); ok {
-			identifier := parser.current
-			parser.consume(lexer.IDENTIFIER)
-
-			node = &ast.Get{Token: identifier, Expr: node}
+			node = parser.field(node, optional)
 		} else {
 			break
 		}
@@ -202,6 +294,20 @@ func (parser *Parser) call(outer *ast.Block) ast.Node {
 	return node
 }
 
+func (parser *Parser) field(node ast.Node, optional bool) ast.Node {
+	identifier := parser.current
+	parser.consume(lexer.IDENTIFIER)
+
+	return &ast.Get{Token: identifier, Expr: node, Optional: optional}
+}
+
+func (parser *Parser) index(outer *ast.Block, node ast.Node, optional bool) ast.Node {
+	expr := parser.expr(outer)
+	parser.consume(lexer.CLOSESQUARE)
+
+	return &ast.Index{Token: node.GetToken(), Caller: node, Expr: expr, Optional: optional}
+}
+
 func (parser *Parser) unary(outer *ast.Block) ast.Node {
 	if operator, ok := parser.match(lexer.BANG, lexer.MINUS); ok {
 		return &ast.UnaryOp{Token: operator, Right: parser.unary(outer)}
@@ -238,12 +344,54 @@ func (parser *Parser) term(outer *ast.Block) ast.Node {
 	return node
 }
 
+// Ranges bind looser than arithmetic, so '0..n - 1' ends at 'n - 1'
+func (parser *Parser) rangeExpr(outer *ast.Block) ast.Node {
+	var start ast.Node = nil
+
+	if parser.current.Kind != lexer.DOT_DOT && parser.current.Kind != lexer.DOT_DOT_EQUAL {
+		start = parser.term(outer)
+	}
+
+	operator, ok := parser.match(lexer.DOT_DOT, lexer.DOT_DOT_EQUAL)
+	if !ok {
+		return start
+	}
+
+	var end ast.Node = nil
+
+	switch parser.current.Kind {
+	case lexer.CLOSESQUARE, lexer.CLOSEPAREN, lexer.COMMA, lexer.SEMICOLON, lexer.OPENCURLY:
+	default:
+		if !parser.isStep() {
+			end = parser.term(outer)
+		}
+	}
+
+	if end == nil && operator.Kind == lexer.DOT_DOT_EQUAL {
+		parser.report(parser.current, "expression", "Inclusive range must have an end, found '%s'", parser.current.Lexeme)
+	}
+
+	var step ast.Node = nil
+
+	// 'step' is only special after a range, so can still be used as a name
+	if parser.isStep() {
+		parser.consume(lexer.IDENTIFIER)
+		step = parser.term(outer)
+	}
+
+	return &ast.Range{Token: operator, Start: start, End: end, Step: step, Inclusive: operator.Kind == lexer.DOT_DOT_EQUAL}
+}
+
+func (parser *Parser) isStep() bool {
+	return parser.current.Kind == lexer.IDENTIFIER && parser.current.Lexeme == "step"
+}
+
 func (parser *Parser) comparison(outer *ast.Block) ast.Node {
-	node := parser.term(outer)
+	node := parser.rangeExpr(outer)
 
 	for {
 		if operator, ok := parser.match(lexer.LESS, lexer.LESS_EQUAL, lexer.GREATER, lexer.GREATER_EQUAL); ok {
-			node = &ast.BinaryOp{Token: operator, Left: node, Right: parser.term(outer)}
+			node = &ast.BinaryOp{Token: operator, Left: node, Right: parser.rangeExpr(outer)}
 		} else {
 			break
 		}
@@ -294,15 +442,60 @@ func (parser *Parser) or(outer *ast.Block) ast.Node {
 	return node
 }
 
-func (parser *Parser) assignment(outer *ast.Block) ast.Node {
+// Gives back the left side unless it is unit, only then running the right
+func (parser *Parser) coalesce(outer *ast.Block) ast.Node {
 	node := parser.or(outer)
 
+	for {
+		if operator, ok := parser.match(lexer.QUESTION_QUESTION); ok {
+			node = &ast.LogicalOp{Token: operator, Left: node, Right: parser.or(outer)}
+		} else {
+			break
+		}
+	}
+
+	return node
+}
+
+// Pipelines pass the value on the left as the first argument of the call on
+// the right, so 'x |> f(1)' becomes 'f(x, 1)' and 'x |> f' becomes 'f(x)'
+func (parser *Parser) pipeline(outer *ast.Block) ast.Node {
+	node := parser.coalesce(outer)
+
+	for {
+		if _, ok := parser.match(lexer.PIPELINE); ok {
+			node = parser.pipe(node, parser.coalesce(outer))
+		} else {
+			break
+		}
+	}
+
+	return node
+}
+
+func (parser *Parser) pipe(value ast.Node, target ast.Node) ast.Node {
+	switch t := target.(type) {
+	case *ast.Call:
+		arguments := append([]ast.Node{value}, t.Arguments...)
+		return &ast.Call{Token: t.Token, Callee: t.Callee, Arguments: arguments, Optional: t.Optional}
+
+	case *ast.Identifier, *ast.Get, *ast.Index, *ast.AnonymousFunction:
+		return &ast.Call{Token: target.GetToken(), Callee: target, Arguments: []ast.Node{value}}
+	}
+
+	parser.report(target.GetToken(), "function or call", "Cannot pipe into '%s', it must be a function or a call", target.GetToken().Lexeme)
+	return value
+}
+
+func (parser *Parser) assignment(outer *ast.Block) ast.Node {
+	node := parser.pipeline(outer)
+
 	if operator, ok := parser.match(lexer.EQUAL); ok {
 		switch t := node.(type) {
 		case *ast.Get:
-			return &ast.Set{Token: t.Token, Caller: t.Expr, Expr: parser.or(outer)}
+			return &ast.Set{Token: t.Token, Caller: t.Expr, Expr: parser.pipeline(outer), Optional: t.Optional}
 		case *ast.Index:
-			return &ast.IndexSet{Token: operator, Idx: t, Expr: parser.or(outer)}
+			return &ast.IndexSet{Token: operator, Idx: t, Expr: parser.pipeline(outer)}
 		default:
 			return parser.variableAssign(outer, node.GetToken(), operator)
 		}
@@ -315,15 +508,38 @@ func (parser *Parser) expr(outer *ast.Block) ast.Node {
 	return parser.assignment(outer)
 }
 
-func (parser *Parser) collectParameters() []*ast.Parameter {
+// Parameters are plain names, optionally followed by '= default', with an
+// optional '...rest' at the end collecting the remaining arguments
+func (parser *Parser) collectParameters(outer *ast.Block) []*ast.Parameter {
 	params := make([]*ast.Parameter, 0, 2)
 	parser.consume(lexer.OPENPAREN)
 
-	for parser.current.Kind == lexer.IDENTIFIER {
+	optional := false
+
+	for parser.current.Kind == lexer.IDENTIFIER || parser.current.Kind == lexer.ELLIPSIS {
+		if len(params) > 0 && params[len(params)-1].Variadic {
+			parser.report(parser.current, "')'", "Nothing can follow a variadic parameter")
+		}
+
+		_, variadic := parser.match(lexer.ELLIPSIS)
+
 		identifier := parser.current
 		parser.consume(lexer.IDENTIFIER)
 
-		params = append(params, &ast.Parameter{Token: identifier, Mutable: false})
+		param := &ast.Parameter{Token: identifier, Mutable: false, Variadic: variadic}
+
+		if equal, ok := parser.match(lexer.EQUAL); ok {
+			if variadic {
+				parser.report(equal, "", "Variadic parameter '%s' cannot have a default value", identifier.Lexeme)
+			}
+
+			param.Default = parser.or(outer)
+			optional = true
+		} else if optional && !variadic {
+			parser.report(identifier, "", "Parameter '%s' must have a default value, as it follows one which does", identifier.Lexeme)
+		}
+
+		params = append(params, param)
 		parser.consumeIfExists(lexer.COMMA)
 	}
 
@@ -331,22 +547,48 @@ func (parser *Parser) collectParameters() []*ast.Parameter {
 	return params
 }
 
-func (parser *Parser) functionDef(_ *ast.Block) *ast.FunctionDef {
+func (parser *Parser) functionDef(outer *ast.Block) *ast.FunctionDef {
+	doc := parser.current.Doc
 	parser.consume(lexer.FUNCTION)
 
 	identifier := parser.current
 	parser.consume(lexer.IDENTIFIER)
 
 	// FIXME: Add function return type
-	return ast.NewFnDef(identifier, parser.collectParameters(), parser.block())
+	params := parser.collectParameters(outer)
+	body, generator := parser.functionBody()
+
+	fn := ast.NewFnDef(identifier, params, body)
+	fn.Doc = doc
+	fn.Generator = generator
+
+	return fn
 }
 
-func (parser *Parser) anonymousFunction(_ *ast.Block) *ast.AnonymousFunction {
+func (parser *Parser) anonymousFunction(outer *ast.Block) *ast.AnonymousFunction {
 	ftoken := parser.current
 	parser.consume(lexer.FUNCTION)
 
 	// FIXME: Add function return type
-	return ast.NewAnonFn(ftoken, parser.collectParameters(), parser.block())
+	params := parser.collectParameters(outer)
+	body, generator := parser.functionBody()
+
+	fn := ast.NewAnonFn(ftoken, params, body)
+	fn.Generator = generator
+	return fn
+}
+
+// Parses the body of a function, reporting whether it yields. Nested
+// functions track their own bodies, so a yield only marks the closest one.
+func (parser *Parser) functionBody() (*ast.Block, bool) {
+	enclosing := parser.yielded
+	parser.yielded = false
+
+	body := parser.block()
+	generator := parser.yielded
+
+	parser.yielded = enclosing
+	return body, generator
 }
 
 func (parser *Parser) throw(outer *ast.Block) *ast.Throw {
@@ -355,6 +597,14 @@ func (parser *Parser) throw(outer *ast.Block) *ast.Throw {
 	return &ast.Throw{Token: ftoken, Expr: parser.expr(outer)}
 }
 
+func (parser *Parser) yield(outer *ast.Block) *ast.Yield {
+	ftoken := parser.current
+	parser.consume(lexer.YIELD)
+
+	parser.yielded = true
+	return &ast.Yield{Token: ftoken, Expr: parser.expr(outer)}
+}
+
 func (parser *Parser) catch(outer *ast.Block) *ast.Catch {
 	ftoken := parser.current
 	parser.consume(lexer.CATCH)
@@ -365,7 +615,24 @@ func (parser *Parser) catch(outer *ast.Block) *ast.Catch {
 	id := parser.current
 	parser.consume(lexer.IDENTIFIER)
 
-	return &ast.Catch{Token: ftoken, Expr: expr, Var: id, Body: parser.block()}
+	catch := &ast.Catch{Token: ftoken, Expr: expr, Var: id, Body: parser.block()}
+
+	if _, ok := parser.match(lexer.FINALLY); ok {
+		catch.Finally = parser.block()
+	}
+
+	return catch
+}
+
+func (parser *Parser) deferStmt(outer *ast.Block) *ast.Defer {
+	ftoken := parser.current
+	parser.consume(lexer.DEFER)
+
+	if parser.current.Kind == lexer.OPENCURLY {
+		return &ast.Defer{Token: ftoken, Body: parser.block()}
+	}
+
+	return &ast.Defer{Token: ftoken, Body: parser.statement(outer)}
 }
 
 func (parser *Parser) matchcase(outer *ast.Block) *ast.Match {
@@ -378,85 +645,180 @@ func (parser *Parser) matchcase(outer *ast.Block) *ast.Match {
 
 	var catchAll ast.Node = nil
 
-	for parser.current.Kind != lexer.CLOSECURLY {
-		token := parser.current
+	for parser.until(lexer.CLOSECURLY) {
+		parser.synchronised(func() {
+			token := parser.current
+
+			if parser.current.Kind == lexer.CATCH {
+				if catchAll != nil {
+					parser.report(token, "", "Match statement cannot declare multiple catch alls")
+				}
+
+				parser.consume(lexer.CATCH)
+				parser.consume(lexer.FAT_ARROW)
+				catchAll = parser.statement(outer)
+			} else {
+				value := parser.expr(outer)
+				bindings := caseBindings(value)
+
+				if bindings != nil {
+					value = value.(*ast.Call).Callee
+				}
+
+				parser.consume(lexer.FAT_ARROW)
+				body := parser.statement(outer)
 
-		if parser.current.Kind == lexer.CATCH {
-			if catchAll != nil {
-				report("Match statement cannot declare multiple catch alls")
+				cases = append(cases, &ast.Case{Token: token, Expr: value, Bindings: bindings, Body: body})
 			}
+		})
+	}
 
-			parser.consume(lexer.CATCH)
-			parser.consume(lexer.FAT_ARROW)
-			catchAll = parser.statement(outer)
-		} else {
-			value := parser.expr(outer)
-			parser.consume(lexer.FAT_ARROW)
-			body := parser.statement(outer)
+	parser.consume(lexer.CLOSECURLY)
+
+	return &ast.Match{Token: ftoken, Expr: expr, Cases: cases, CatchAll: catchAll}
+}
 
-			cases = append(cases, &ast.Case{Token: token, Expr: value, Body: body})
+// Arms like 'Shape.Circle(r)' name the payload of a variant rather than call
+// it, so they must be a member followed only by plain names
+func caseBindings(value ast.Node) []*lexer.Token {
+	call, ok := value.(*ast.Call)
+	if !ok || len(call.Arguments) == 0 {
+		return nil
+	}
+
+	if _, ok := call.Callee.(*ast.Get); !ok {
+		return nil
+	}
+
+	bindings := make([]*lexer.Token, 0, len(call.Arguments))
+
+	for _, arg := range call.Arguments {
+		id, ok := arg.(*ast.Identifier)
+		if !ok {
+			return nil
 		}
 
+		bindings = append(bindings, id.Token)
+	}
+
+	return bindings
+}
+
+// Enums list their variants, which may carry a payload: enum Shape { Circle(r), Empty }
+func (parser *Parser) enumDef(_ *ast.Block) *ast.EnumDef {
+	doc := parser.current.Doc
+	parser.consume(lexer.ENUM)
+
+	identifier := parser.current
+	parser.consume(lexer.IDENTIFIER)
+	parser.consume(lexer.OPENCURLY)
+
+	variants := make([]*ast.Variant, 0, 2)
+	names := make(map[string]bool)
+
+	for parser.until(lexer.CLOSECURLY) {
+		variant := &ast.Variant{Token: parser.current}
+		parser.consume(lexer.IDENTIFIER)
+
+		if names[variant.Token.Lexeme] {
+			parser.report(variant.Token, "", "Variant with name '%s' already exists in enum '%s'", variant.Token.Lexeme, identifier.Lexeme)
+		}
+		names[variant.Token.Lexeme] = true
+
+		if _, ok := parser.match(lexer.OPENPAREN); ok {
+			variant.Fields = make([]*lexer.Token, 0, 2)
+
+			for parser.until(lexer.CLOSEPAREN) {
+				field := parser.current
+				parser.consume(lexer.IDENTIFIER)
+
+				for _, existing := range variant.Fields {
+					if existing.Lexeme == field.Lexeme {
+						parser.report(field, "", "Field with name '%s' already exists in variant '%s'", field.Lexeme, variant.Token.Lexeme)
+					}
+				}
+
+				variant.Fields = append(variant.Fields, field)
+
+				if _, ok := parser.match(lexer.COMMA); !ok {
+					break
+				}
+			}
+
+			parser.consume(lexer.CLOSEPAREN)
+
+			if len(variant.Fields) == 0 {
+				parser.report(variant.Token, "", "Variant '%s' has an empty payload, leave off the brackets instead", variant.Token.Lexeme)
+			}
+		}
+
+		variants = append(variants, variant)
+
+		if _, ok := parser.match(lexer.COMMA); !ok {
+			break
+		}
 	}
 
 	parser.consume(lexer.CLOSECURLY)
 
-	return &ast.Match{Token: ftoken, Expr: expr, Cases: cases, CatchAll: catchAll}
+	if len(variants) == 0 {
+		parser.report(identifier, "", "Enum '%s' must have at least one variant", identifier.Lexeme)
+	}
+
+	return &ast.EnumDef{Token: identifier, Variants: variants, Doc: doc}
 }
 
-func (parser *Parser) importFile(outer *ast.Block) ast.Node {
+func (parser *Parser) importFile() *ast.Import {
 	parser.consume(lexer.IMPORT)
 
 	file := parser.current
 	parser.consume(lexer.STRING)
 
-	var into *lexer.Token = nil
 	if parser.current.Kind == lexer.INTO {
 		parser.consume(lexer.INTO)
 
-		into = parser.current
+		alias := parser.current
 		parser.consume(lexer.IDENTIFIER)
-	}
 
-	// FIXME: Check for extension
+		return &ast.Import{Token: file, Alias: alias}
+	}
 
-	fileName, err := filepath.Abs(file.Lexeme + ".tiny")
-	if err != nil {
-		report("Could not resolve path '%s'", fileName)
+	// Without a name, the module is bound to the name of its file
+	name := strings.TrimSuffix(filepath.Base(file.Lexeme), ".tiny")
+	if !isIdentifier(name) {
+		parser.reportFatal(file, "", "Cannot name module after '%s', use 'into' to give it a name", file.Lexeme)
 	}
 
-	// Skip the file if it's in the file stack
-	// FIXME: Queue the file rather than parsing now
-	// 		  This will also allow for tracking unused imports
-	if !parser.fileExists(fileName) {
-		parser.pushState(fileName)
+	alias := *file
+	alias.Kind = lexer.IDENTIFIER
+	alias.Lexeme = name
 
-		// Push into a namespace
-		if into != nil {
-			ns := ast.NewNamespace(into)
-			parser.outerStatements(ns.Body)
-			parser.popState()
-			return ns
-		}
+	return &ast.Import{Token: file, Alias: &alias}
+}
 
-		// Include into current scope
-		program := ast.New()
-		parser.outerStatements(program.Body)
-		outer.Statements = append(outer.Statements, program.Body.Statements...)
+func isIdentifier(name string) bool {
+	if _, ok := lexer.KeyWords[name]; ok || len(name) == 0 {
+		return false
+	}
 
-		parser.popState()
+	for idx, ch := range name {
+		if !(ch == '_' || unicode.IsLetter(ch) || (idx > 0 && unicode.IsDigit(ch))) {
+			return false
+		}
 	}
 
-	return &ast.NoOp{Token: into}
+	return true
 }
 
 func (parser *Parser) namespace(_ *ast.Block) *ast.NameSpace {
+	doc := parser.current.Doc
 	parser.consume(lexer.NAMESPACE)
 
 	identifer := parser.current
 	parser.consume(lexer.IDENTIFIER)
 
-	return &ast.NameSpace{Token: identifer, Body: parser.namespaced()}
+	body, private := parser.namespaced()
+	return &ast.NameSpace{Token: identifer, Body: body, Private: private, Doc: doc}
 }
 
 func (parser *Parser) testblock(_ *ast.Block) *ast.Test {
@@ -469,15 +831,22 @@ func (parser *Parser) testblock(_ *ast.Block) *ast.Test {
 }
 
 func (parser *Parser) classDef(outer *ast.Block) *ast.ClassDef {
+	doc := parser.current.Doc
 	parser.consume(lexer.CLASS)
 
 	identifier := parser.current
 	parser.consume(lexer.IDENTIFIER)
 
 	var baseClass ast.Node = nil
+	var traits []ast.Node = nil
+
 	if _, ok := parser.match(lexer.COLON); ok {
-		// Skip some process, since they are not relevant in this context
-		baseClass = parser.call(outer)
+		if parser.current.Kind != lexer.IMPL {
+			// Skip some process, since they are not relevant in this context
+			baseClass = parser.call(outer)
+		}
+
+		traits = parser.traits(outer)
 	}
 
 	// TODO: identifier for inheritance
@@ -486,47 +855,169 @@ func (parser *Parser) classDef(outer *ast.Block) *ast.ClassDef {
 
 	fields := make(map[string]*ast.VariableDecl, 0)
 	methods := make(map[string]*ast.FunctionDef, 0)
+	staticFields := make(map[string]*ast.VariableDecl, 0)
+	staticMethods := make(map[string]*ast.FunctionDef, 0)
+	getters := make(map[string]*ast.FunctionDef, 0)
+	setters := make(map[string]*ast.FunctionDef, 0)
+	private := make(map[string]bool, 0)
 
 	block := ast.NewBlock(curly)
 
-	for parser.current.Kind != lexer.CLOSECURLY {
-		switch parser.current.Kind {
-		case lexer.FUNCTION:
-			fn := parser.functionDef(block)
+	for parser.until(lexer.CLOSECURLY) {
+		parser.synchronised(func() {
+			isPrivate := parser.visibility()
+			var member *lexer.Token
 
-			if _, ok := methods[fn.GetToken().Lexeme]; ok {
-				shared.ReportErrFatal(fmt.Sprintf("Function with name '%s' already exists in class '%s'", fn.GetToken().Lexeme, identifier.Lexeme))
-			}
+			switch parser.current.Kind {
+			case lexer.FUNCTION:
+				fn := parser.functionDef(block)
+				member = fn.GetToken()
 
-			methods[fn.GetToken().Lexeme] = fn
+				if isPrivate && fn.GetToken().Lexeme == identifier.Lexeme {
+					parser.report(fn.GetToken(), "", "Constructor of class '%s' cannot be private", identifier.Lexeme)
+				}
 
-		case lexer.VAR:
-			parser.consume(lexer.VAR)
-			variable := parser.variableDeclEmpty(true)
+				if _, ok := methods[fn.GetToken().Lexeme]; ok {
+					parser.report(fn.GetToken(), "", "Function with name '%s' already exists in class '%s'", fn.GetToken().Lexeme, identifier.Lexeme)
+				}
 
-			if _, ok := fields[variable.GetToken().Lexeme]; ok {
-				shared.ReportErrFatal(fmt.Sprintf("Field with name '%s' already exists in class '%s'", variable.GetToken().Lexeme, identifier.Lexeme))
-			}
+				methods[fn.GetToken().Lexeme] = fn
 
-			fields[variable.GetToken().Lexeme] = variable
-			parser.consume(lexer.SEMICOLON)
+			case lexer.VAR:
+				parser.consume(lexer.VAR)
+				variable := parser.variableDeclEmpty(true)
+				member = variable.GetToken()
 
-		default:
-			shared.ReportErrFatal(fmt.Sprintf("Unexpected item in class definition '%s'", parser.current.Lexeme))
-		}
+				if _, ok := fields[variable.GetToken().Lexeme]; ok {
+					parser.report(variable.GetToken(), "", "Field with name '%s' already exists in class '%s'", variable.GetToken().Lexeme, identifier.Lexeme)
+				}
+
+				fields[variable.GetToken().Lexeme] = variable
+				parser.consume(lexer.SEMICOLON)
+
+			case lexer.STATIC:
+				parser.consume(lexer.STATIC)
+
+				switch parser.current.Kind {
+				case lexer.FUNCTION:
+					fn := parser.functionDef(block)
+					member = fn.GetToken()
+
+					if fn.GetToken().Lexeme == identifier.Lexeme {
+						parser.report(fn.GetToken(), "", "Constructor of class '%s' cannot be static", identifier.Lexeme)
+					}
+
+					if _, ok := staticMethods[fn.GetToken().Lexeme]; ok {
+						parser.report(fn.GetToken(), "", "Static function with name '%s' already exists in class '%s'", fn.GetToken().Lexeme, identifier.Lexeme)
+					}
+
+					staticMethods[fn.GetToken().Lexeme] = fn
+
+				case lexer.VAR:
+					parser.consume(lexer.VAR)
+					variable := parser.variableDeclEmpty(true)
+					member = variable.GetToken()
+
+					// Unlike instance fields, static fields can start with a value
+					if _, ok := parser.match(lexer.EQUAL); ok {
+						variable.Expr = parser.expr(block)
+					}
+
+					if _, ok := staticFields[variable.GetToken().Lexeme]; ok {
+						parser.report(variable.GetToken(), "", "Static field with name '%s' already exists in class '%s'", variable.GetToken().Lexeme, identifier.Lexeme)
+					}
+
+					staticFields[variable.GetToken().Lexeme] = variable
+					parser.consume(lexer.SEMICOLON)
+
+				default:
+					parser.reportFatal(parser.current, "function or var", "Unexpected item after 'static' in class definition '%s'", parser.current.Lexeme)
+				}
+
+			case lexer.IDENTIFIER:
+				// 'get' and 'set' are only special at the start of a member
+				var accessors map[string]*ast.FunctionDef
+
+				switch parser.current.Lexeme {
+				case "get":
+					accessors = getters
+				case "set":
+					accessors = setters
+				default:
+					parser.reportFatal(parser.current, "function or var", "Unexpected item in class definition '%s'", parser.current.Lexeme)
+				}
+
+				kind := parser.current.Lexeme
+				fn := parser.accessor(block)
+				member = fn.GetToken()
+
+				if _, ok := accessors[fn.GetToken().Lexeme]; ok {
+					parser.report(fn.GetToken(), "", "Property '%s' already has a %ster in class '%s'", fn.GetToken().Lexeme, kind, identifier.Lexeme)
+				}
+
+				if _, ok := fields[fn.GetToken().Lexeme]; ok {
+					parser.report(fn.GetToken(), "", "Property '%s' has the same name as a field in class '%s'", fn.GetToken().Lexeme, identifier.Lexeme)
+				}
+
+				accessors[fn.GetToken().Lexeme] = fn
+
+			default:
+				parser.reportFatal(parser.current, "function or var", "Unexpected item in class definition '%s'", parser.current.Lexeme)
+			}
+
+			if isPrivate {
+				private[member.Lexeme] = true
+			}
+		})
 	}
 
 	parser.consume(lexer.CLOSECURLY)
 
-	return &ast.ClassDef{Token: identifier, Base: baseClass, Constructor: nil, Fields: fields, Methods: methods}
+	return &ast.ClassDef{
+		Token: identifier, Base: baseClass, Constructor: nil, Fields: fields, Methods: methods,
+		StaticFields: staticFields, StaticMethods: staticMethods, Getters: getters, Setters: setters, Private: private, Traits: traits, Doc: doc,
+	}
 }
 
-func (parser *Parser) structDef(_ *ast.Block) *ast.StructDef {
+// Parses a 'get' or 'set' accessor, which is written like a method without 'function'
+func (parser *Parser) accessor(outer *ast.Block) *ast.FunctionDef {
+	doc := parser.current.Doc
+	parser.consume(lexer.IDENTIFIER)
+
+	identifier := parser.current
+	parser.consume(lexer.IDENTIFIER)
+
+	params := parser.collectParameters(outer)
+	body, generator := parser.functionBody()
+
+	if generator {
+		parser.report(identifier, "", "Accessor '%s' cannot yield", identifier.Lexeme)
+	}
+
+	fn := ast.NewFnDef(identifier, params, body)
+	fn.Doc = doc
+
+	return fn
+}
+
+func (parser *Parser) structDef(outer *ast.Block) *ast.StructDef {
+	doc := parser.current.Doc
 	parser.consume(lexer.STRUCT)
 
 	identifier := parser.current
 	parser.consume(lexer.IDENTIFIER)
 
+	var traits []ast.Node = nil
+
+	// Structs cannot inherit, so only traits can follow
+	if _, ok := parser.match(lexer.COLON); ok {
+		if parser.current.Kind != lexer.IMPL {
+			parser.reportFatal(parser.current, "impl", "Structs can only implement traits, found '%s'", parser.current.Lexeme)
+		}
+
+		traits = parser.traits(outer)
+	}
+
 	// TODO: identifier for inheritance
 	curly := parser.current
 	parser.consume(lexer.OPENCURLY)
@@ -534,51 +1025,230 @@ func (parser *Parser) structDef(_ *ast.Block) *ast.StructDef {
 	block := ast.NewBlock(curly)
 
 	fields := make(map[string]*ast.VariableDecl, 0)
+	methods := make(map[string]*ast.FunctionDef, 0)
+	private := make(map[string]bool, 0)
 	var constructor *ast.FunctionDef = nil
 
-	for parser.current.Kind != lexer.CLOSECURLY {
-		switch parser.current.Kind {
-		case lexer.FUNCTION:
-			fn := parser.functionDef(block)
+	for parser.until(lexer.CLOSECURLY) {
+		parser.synchronised(func() {
+			isPrivate := parser.visibility()
+
+			switch parser.current.Kind {
+			case lexer.FUNCTION:
+				fn := parser.functionDef(block)
+
+				// Functions named after the struct construct it, the rest are methods
+				if fn.GetToken().Lexeme != identifier.Lexeme {
+					if _, ok := methods[fn.GetToken().Lexeme]; ok {
+						parser.report(fn.GetToken(), "", "Function with name '%s' already exists in struct '%s'", fn.GetToken().Lexeme, identifier.Lexeme)
+					}
+
+					methods[fn.GetToken().Lexeme] = fn
+
+					if isPrivate {
+						private[fn.GetToken().Lexeme] = true
+					}
+					return
+				}
+
+				if isPrivate {
+					parser.report(fn.GetToken(), "", "Constructor of struct '%s' cannot be private", identifier.Lexeme)
+				}
+
+				// Constructor already defined
+				if constructor != nil {
+					parser.report(fn.GetToken(), "", "Constructor exists in struct '%s'.", identifier.Lexeme)
+				}
 
-			// Must use struct name as constructor
-			if fn.GetToken().Lexeme != identifier.Lexeme {
-				shared.ReportErrFatal(fmt.Sprintf("Struct '%s' constructor must be '%s' not '%s'.", identifier.Lexeme, identifier.Lexeme, fn.GetToken().Lexeme))
+				constructor = fn
+
+			case lexer.VAR:
+				parser.consume(lexer.VAR)
+				variable := parser.variableDeclEmpty(true)
+
+				if _, ok := fields[variable.GetToken().Lexeme]; ok {
+					parser.report(variable.GetToken(), "", "Field with name '%s' already exists in struct '%s'", variable.GetToken().Lexeme, identifier.Lexeme)
+				}
+
+				fields[variable.GetToken().Lexeme] = variable
+
+				if isPrivate {
+					private[variable.GetToken().Lexeme] = true
+				}
+				parser.consume(lexer.SEMICOLON)
+
+			default:
+				parser.reportFatal(parser.current, "function or var", "Unexpected item in struct definition '%s'", parser.current.Lexeme)
 			}
+		})
+	}
+
+	parser.consume(lexer.CLOSECURLY)
+
+	return &ast.StructDef{Token: identifier, Constructor: constructor, Fields: fields, Methods: methods, Private: private, Traits: traits, Doc: doc}
+}
+
+// Traits follow 'impl', like 'class Foo : Base impl Iterable, Printable'
+func (parser *Parser) traits(outer *ast.Block) []ast.Node {
+	if _, ok := parser.match(lexer.IMPL); !ok {
+		return nil
+	}
 
-			// Constructor already defined
-			if constructor != nil {
-				shared.ReportErrFatal(fmt.Sprintf("Constructor exists in struct '%s'.", identifier.Lexeme))
+	traits := []ast.Node{parser.call(outer)}
+
+	for _, ok := parser.match(lexer.COMMA); ok; _, ok = parser.match(lexer.COMMA) {
+		traits = append(traits, parser.call(outer))
+	}
+
+	return traits
+}
+
+// Trait methods end with ';' when they must be implemented, or have a body
+// which is used when they are not
+func (parser *Parser) traitDef(_ *ast.Block) *ast.TraitDef {
+	doc := parser.current.Doc
+	parser.consume(lexer.TRAIT)
+
+	identifier := parser.current
+	parser.consume(lexer.IDENTIFIER)
+
+	curly := parser.current
+	parser.consume(lexer.OPENCURLY)
+
+	block := ast.NewBlock(curly)
+	methods := make([]*ast.FunctionDef, 0, 2)
+	names := make(map[string]bool)
+
+	for parser.until(lexer.CLOSECURLY) {
+		parser.synchronised(func() {
+			if parser.current.Kind != lexer.FUNCTION {
+				parser.reportFatal(parser.current, "function", "Unexpected item in trait definition '%s'", parser.current.Lexeme)
 			}
 
-			constructor = fn
+			fnDoc := parser.current.Doc
+			parser.consume(lexer.FUNCTION)
+
+			name := parser.current
+			parser.consume(lexer.IDENTIFIER)
 
-		case lexer.VAR:
-			parser.consume(lexer.VAR)
-			variable := parser.variableDeclEmpty(true)
+			params := parser.collectParameters(block)
 
-			if _, ok := fields[variable.GetToken().Lexeme]; ok {
-				shared.ReportErrFatal(fmt.Sprintf("Field with name '%s' already exists in struct '%s'", variable.GetToken().Lexeme, identifier.Lexeme))
+			var body *ast.Block = nil
+			generator := false
+			if parser.current.Kind == lexer.OPENCURLY {
+				body, generator = parser.functionBody()
+			} else {
+				parser.consume(lexer.SEMICOLON)
 			}
 
-			fields[variable.GetToken().Lexeme] = variable
-			parser.consume(lexer.SEMICOLON)
+			if names[name.Lexeme] {
+				parser.report(name, "", "Function with name '%s' already exists in trait '%s'", name.Lexeme, identifier.Lexeme)
+			}
+			names[name.Lexeme] = true
 
-		default:
-			shared.ReportErrFatal(fmt.Sprintf("Unexpected item in struct definition '%s'", parser.current.Lexeme))
-		}
+			method := ast.NewFnDef(name, params, body)
+			method.Doc = fnDoc
+			method.Generator = generator
+
+			methods = append(methods, method)
+		})
 	}
 
 	parser.consume(lexer.CLOSECURLY)
 
-	return &ast.StructDef{Token: identifier, Constructor: constructor, Fields: fields}
+	return &ast.TraitDef{Token: identifier, Methods: methods, Doc: doc}
 }
 
 func (parser *Parser) variableAssign(outer *ast.Block, identifier *lexer.Token, operator *lexer.Token) *ast.Assign {
 	return &ast.Assign{Token: identifier, Operator: operator, Expr: parser.expr(outer)}
 }
 
+// Assigns several variables at once, like 'a, b = b, a'
+func (parser *Parser) multipleAssign(outer *ast.Block, first *lexer.Token) *ast.Assign {
+	pattern := &ast.Pattern{Token: first, Kind: ast.PATTERN_LIST, Names: []*lexer.Token{first}}
+
+	for _, ok := parser.match(lexer.COMMA); ok; _, ok = parser.match(lexer.COMMA) {
+		parser.patternName(pattern)
+	}
+
+	operator := parser.current
+	parser.consume(lexer.EQUAL)
+
+	exprs := []ast.Node{parser.expr(outer)}
+
+	for _, ok := parser.match(lexer.COMMA); ok; _, ok = parser.match(lexer.COMMA) {
+		exprs = append(exprs, parser.expr(outer))
+	}
+
+	// Several values are gathered into a list first, so swaps see the old values
+	expr := exprs[0]
+	if len(exprs) > 1 {
+		expr = &ast.ListLiteral{Token: operator, Exprs: exprs}
+	}
+
+	return &ast.Assign{Token: first, Operator: operator, Expr: expr, Pattern: pattern}
+}
+
+// Patterns are either [a, b, ...rest] for lists or {x, y} for fields
+func (parser *Parser) pattern() *ast.Pattern {
+	ftoken := parser.current
+	kind, end := ast.PATTERN_LIST, lexer.CLOSESQUARE
+
+	if ftoken.Kind == lexer.OPENCURLY {
+		kind, end = ast.PATTERN_FIELDS, lexer.CLOSECURLY
+	}
+
+	parser.consume(ftoken.Kind)
+	pattern := &ast.Pattern{Token: ftoken, Kind: kind, Names: make([]*lexer.Token, 0, 2)}
+
+	for parser.current.Kind != end && parser.current.Kind != lexer.EOF {
+		parser.patternName(pattern)
+
+		if _, ok := parser.match(lexer.COMMA); !ok {
+			break
+		}
+	}
+
+	parser.consume(end)
+
+	if len(pattern.Names) == 0 && pattern.Rest == nil {
+		parser.report(ftoken, "", "Pattern must bind at least one name")
+	}
+
+	return pattern
+}
+
+func (parser *Parser) patternName(pattern *ast.Pattern) {
+	if rest, ok := parser.match(lexer.ELLIPSIS); ok {
+		if pattern.Kind == ast.PATTERN_FIELDS {
+			parser.report(rest, "", "Only list patterns can capture the rest")
+		} else if pattern.Rest != nil {
+			parser.report(rest, "", "Pattern can only capture the rest once")
+		}
+
+		pattern.Rest = parser.current
+		parser.consume(lexer.IDENTIFIER)
+		return
+	}
+
+	if pattern.Rest != nil {
+		parser.report(parser.current, "", "Nothing can follow the rest of a pattern")
+	}
+
+	name := parser.current
+	parser.consume(lexer.IDENTIFIER)
+
+	pattern.Names = append(pattern.Names, name)
+}
+
 func (parser *Parser) variableDecl(outer *ast.Block, mutable bool) *ast.VariableDecl {
+	if parser.current.Kind == lexer.OPENSQUARE || parser.current.Kind == lexer.OPENCURLY {
+		pattern := parser.pattern()
+
+		parser.consume(lexer.EQUAL)
+		return ast.NewPatternDecl(pattern, mutable, parser.expr(outer))
+	}
+
 	identifier := parser.current
 	parser.consume(lexer.IDENTIFIER)
 
@@ -588,6 +1258,20 @@ func (parser *Parser) variableDecl(outer *ast.Block, mutable bool) *ast.Variable
 	return ast.NewVarDecl(identifier, mutable, expr)
 }
 
+// Constants take a single name, their value is folded by the analyser
+func (parser *Parser) constDecl(outer *ast.Block) *ast.VariableDecl {
+	parser.consume(lexer.CONST)
+
+	if parser.current.Kind == lexer.OPENSQUARE || parser.current.Kind == lexer.OPENCURLY {
+		parser.report(parser.current, "identifier", "Constants cannot be destructured")
+	}
+
+	node := parser.variableDecl(outer, false)
+	node.Constant = true
+
+	return node
+}
+
 func (parser *Parser) variableDeclEmpty(mutable bool) *ast.VariableDecl {
 	identifier := parser.current
 	parser.consume(lexer.IDENTIFIER)
@@ -680,35 +1364,26 @@ func (parser *Parser) whilestmt(outer *ast.Block) *ast.While {
 	return &ast.While{Token: ftoken, VarDec: varDecl, Condition: condition, Increment: increment, Body: parser.block()}
 }
 
-func (parser *Parser) forStmt(_ *ast.Block) ast.Node {
+func (parser *Parser) forStmt(outer *ast.Block) *ast.For {
 	ftoken := parser.current
 	parser.consume(lexer.FOR)
 
-	current_block := ast.NewBlock(ftoken)
-
-	identifier := parser.current
+	var index *lexer.Token = nil
+	item := parser.current
 	parser.consume(lexer.IDENTIFIER)
-	parser.consume(lexer.IN)
 
-	var node ast.Node
-	switch parser.current.Kind {
-	case lexer.STRING:
-		node = parser.primary(current_block)
-		current_block.Statements = append(current_block.Statements, ParseStr(fmt.Sprintf("let _collection_value = \"%s\";", node.AsSExp())))
-
-	default:
-		node = parser.expr(current_block)
-		current_block.Statements = append(current_block.Statements, ParseStr(fmt.Sprintf("let _collection_value = %s;", node.AsSExp())))
+	// Enumerating names the position first, like 'for i, x in xs'
+	if _, ok := parser.match(lexer.COMMA); ok {
+		index = item
+		item = parser.current
+		parser.consume(lexer.IDENTIFIER)
 	}
 
-	whileStmt := ParseStr(fmt.Sprintf("while var _loop_idx = 0; _loop_idx < builtin.len(_collection_value); _loop_idx = _loop_idx + 1 { let %s = _collection_value[_loop_idx]; }", identifier.Lexeme))
-
-	body := whileStmt.(*ast.While).Body
-	body.Statements = append(body.Statements, parser.block().Statements...)
+	parser.consume(lexer.IN)
 
-	current_block.Statements = append(current_block.Statements, whileStmt)
+	iterable := parser.expr(outer)
 
-	return current_block
+	return &ast.For{Token: ftoken, Index: index, Item: item, Iterable: iterable, Body: parser.block()}
 }
 
 // FIXME: Use a system similar to Lox so that parsing expression statements are simplified
@@ -724,6 +1399,9 @@ func (parser *Parser) statement(outer *ast.Block) ast.Node {
 		parser.consume(lexer.LET)
 		node = parser.variableDecl(outer, false)
 		parser.consume(lexer.SEMICOLON)
+	case lexer.CONST:
+		node = parser.constDecl(outer)
+		parser.consume(lexer.SEMICOLON)
 	case lexer.PRINT:
 		node = parser.print(outer)
 		parser.consume(lexer.SEMICOLON)
@@ -739,6 +1417,11 @@ func (parser *Parser) statement(outer *ast.Block) ast.Node {
 	case lexer.THROW:
 		node = parser.throw(outer)
 		parser.consume(lexer.SEMICOLON)
+	case lexer.YIELD:
+		node = parser.yield(outer)
+		parser.consume(lexer.SEMICOLON)
+	case lexer.DEFER:
+		node = parser.deferStmt(outer)
 	case lexer.CATCH:
 		node = parser.catch(outer)
 	case lexer.MATCH:
@@ -747,6 +1430,11 @@ func (parser *Parser) statement(outer *ast.Block) ast.Node {
 	default:
 		// Expression assignment
 		node = parser.expr(outer)
+
+		if _, ok := node.(*ast.Identifier); ok && parser.current.Kind == lexer.COMMA {
+			node = parser.multipleAssign(outer, node.GetToken())
+		}
+
 		parser.consume(lexer.SEMICOLON)
 	}
 
@@ -754,84 +1442,217 @@ func (parser *Parser) statement(outer *ast.Block) ast.Node {
 }
 
 func (parser *Parser) statementList(outer *ast.Block, endType lexer.TokenKind) {
-	for parser.current.Kind != endType {
-		outer.Statements = append(outer.Statements, parser.statement(outer))
+	for parser.until(endType) {
+		parser.synchronised(func() {
+			outer.Statements = append(outer.Statements, parser.statement(outer))
+		})
 	}
 }
 
-func (parser *Parser) namespaced() *ast.Block {
+// Parses the declarations of a namespace, along with the names marked 'priv'
+func (parser *Parser) namespaced() (*ast.Block, map[string]bool) {
 	start_token := parser.current
 	parser.consume(lexer.OPENCURLY)
 
 	block := ast.NewBlock(start_token)
+	private := make(map[string]bool, 0)
 
-	for parser.current.Kind != lexer.CLOSECURLY {
-		switch parser.current.Kind {
-		case lexer.CLASS:
-			block.Statements = append(block.Statements, parser.classDef(block))
-			continue
-		case lexer.STRUCT:
-			block.Statements = append(block.Statements, parser.structDef(block))
-			continue
-		case lexer.NAMESPACE:
-			block.Statements = append(block.Statements, parser.namespace(block))
-			continue
-		case lexer.FUNCTION:
-			block.Statements = append(block.Statements, parser.functionDef(block))
-			continue
+	for parser.until(lexer.CLOSECURLY) {
+		parser.synchronised(func() {
+			isPrivate := parser.visibility()
+			start := len(block.Statements)
 
-		case lexer.VAR:
-			parser.consume(lexer.VAR)
-			block.Statements = append(block.Statements, parser.variableDecl(block, true))
+			parser.namespaceMember(block)
 
-		case lexer.LET:
-			parser.consume(lexer.LET)
-			block.Statements = append(block.Statements, parser.variableDecl(block, false))
+			if !isPrivate {
+				return
+			}
 
-		default:
-			report("Unexpected item in namespace definition '%s'", parser.current.Lexeme)
-		}
+			for _, stmt := range block.Statements[start:] {
+				if decl, ok := stmt.(*ast.VariableDecl); ok && decl.Pattern != nil {
+					for _, identifier := range decl.Pattern.Identifiers() {
+						private[identifier.Lexeme] = true
+					}
+					continue
+				}
 
-		parser.consume(lexer.SEMICOLON)
+				private[stmt.GetToken().Lexeme] = true
+			}
+		})
 	}
 
 	parser.consume(lexer.CLOSECURLY)
 
-	return block
+	return block, private
+}
+
+func (parser *Parser) namespaceMember(block *ast.Block) {
+	switch parser.current.Kind {
+	case lexer.CLASS:
+		block.Statements = append(block.Statements, parser.classDef(block))
+		return
+	case lexer.STRUCT:
+		block.Statements = append(block.Statements, parser.structDef(block))
+		return
+	case lexer.ENUM:
+		block.Statements = append(block.Statements, parser.enumDef(block))
+		return
+	case lexer.TRAIT:
+		block.Statements = append(block.Statements, parser.traitDef(block))
+		return
+	case lexer.NAMESPACE:
+		block.Statements = append(block.Statements, parser.namespace(block))
+		return
+	case lexer.FUNCTION:
+		block.Statements = append(block.Statements, parser.functionDef(block))
+		return
+
+	case lexer.VAR:
+		parser.consume(lexer.VAR)
+		block.Statements = append(block.Statements, parser.variableDecl(block, true))
+
+	case lexer.LET:
+		parser.consume(lexer.LET)
+		block.Statements = append(block.Statements, parser.variableDecl(block, false))
+
+	case lexer.CONST:
+		block.Statements = append(block.Statements, parser.constDecl(block))
+
+	default:
+		parser.reportFatal(parser.current, "declaration", "Unexpected item in namespace definition '%s'", parser.current.Lexeme)
+	}
+
+	parser.consume(lexer.SEMICOLON)
+}
+
+// Reads an optional 'pub' or 'priv' before a member. Members are public
+// unless marked 'priv', so 'pub' only spells that out.
+func (parser *Parser) visibility() bool {
+	token, ok := parser.match(lexer.PUB, lexer.PRIV)
+	if !ok {
+		return false
+	}
+
+	// Keep doc comments written above the modifier with the member
+	if len(parser.current.Doc) == 0 {
+		parser.current.Doc = token.Doc
+	}
+
+	return token.Kind == lexer.PRIV
+}
+
+// Declarations marked 'pub' can be used by files which import this one
+func (parser *Parser) public(block *ast.Block) ast.Node {
+	pub := parser.current
+	parser.consume(lexer.PUB)
+
+	// Keep doc comments written above 'pub' with the declaration
+	if len(parser.current.Doc) == 0 {
+		parser.current.Doc = pub.Doc
+	}
+
+	switch parser.current.Kind {
+	case lexer.FUNCTION:
+		node := parser.functionDef(block)
+		node.Public = true
+		return node
+
+	case lexer.CLASS:
+		node := parser.classDef(block)
+		node.Public = true
+		return node
+
+	case lexer.STRUCT:
+		node := parser.structDef(block)
+		node.Public = true
+		return node
+
+	case lexer.ENUM:
+		node := parser.enumDef(block)
+		node.Public = true
+		return node
+
+	case lexer.TRAIT:
+		node := parser.traitDef(block)
+		node.Public = true
+		return node
+
+	case lexer.NAMESPACE:
+		node := parser.namespace(block)
+		node.Public = true
+		return node
+
+	case lexer.VAR, lexer.LET:
+		mutable := parser.current.Kind == lexer.VAR
+		parser.advance()
+
+		node := parser.variableDecl(block, mutable)
+		node.Public = true
+		parser.consume(lexer.SEMICOLON)
+		return node
+
+	case lexer.CONST:
+		node := parser.constDecl(block)
+		node.Public = true
+		parser.consume(lexer.SEMICOLON)
+		return node
+	}
+
+	parser.reportFatal(parser.current, "declaration", "Only declarations can be made public, found '%s'", parser.current.Lexeme)
+	return nil
 }
 
 func (parser *Parser) outerStatements(block *ast.Block) {
 	for parser.current.Kind != lexer.EOF {
-		switch parser.current.Kind {
-		case lexer.IMPORT:
-			block.Statements = append(block.Statements, parser.importFile(block))
-			parser.consume(lexer.SEMICOLON)
+		parser.synchronised(func() {
+			parser.outerStatement(block)
+		})
+	}
+}
+
+func (parser *Parser) outerStatement(block *ast.Block) {
+	switch parser.current.Kind {
+	case lexer.IMPORT:
+		block.Statements = append(block.Statements, parser.importFile())
+		parser.consume(lexer.SEMICOLON)
 
-		case lexer.CLASS:
-			block.Statements = append(block.Statements, parser.classDef(block))
+	case lexer.PUB:
+		block.Statements = append(block.Statements, parser.public(block))
 
-		case lexer.STRUCT:
-			block.Statements = append(block.Statements, parser.structDef(block))
+	case lexer.PRIV:
+		parser.reportFatal(parser.current, "declaration", "Only members of classes, structs and namespaces can be private, top level declarations are private unless marked 'pub'")
 
-		case lexer.NAMESPACE:
-			block.Statements = append(block.Statements, parser.namespace(block))
+	case lexer.CLASS:
+		block.Statements = append(block.Statements, parser.classDef(block))
 
-		case lexer.FUNCTION:
-			block.Statements = append(block.Statements, parser.functionDef(block))
+	case lexer.STRUCT:
+		block.Statements = append(block.Statements, parser.structDef(block))
 
-		case lexer.TEST:
-			node := parser.testblock(block)
+	case lexer.ENUM:
+		block.Statements = append(block.Statements, parser.enumDef(block))
 
-			if parser.test {
-				block.Statements = append(block.Statements, node)
-			}
+	case lexer.TRAIT:
+		block.Statements = append(block.Statements, parser.traitDef(block))
 
-		default:
-			node := parser.statement(block)
+	case lexer.NAMESPACE:
+		block.Statements = append(block.Statements, parser.namespace(block))
 
-			if !parser.test {
-				block.Statements = append(block.Statements, node)
-			}
+	case lexer.FUNCTION:
+		block.Statements = append(block.Statements, parser.functionDef(block))
+
+	case lexer.TEST:
+		node := parser.testblock(block)
+
+		if parser.test {
+			block.Statements = append(block.Statements, node)
+		}
+
+	default:
+		node := parser.statement(block)
+
+		// Top-level variables are kept for tests to use as fixtures
+		if _, ok := node.(*ast.VariableDecl); ok || !parser.test {
+			block.Statements = append(block.Statements, node)
 		}
 	}
 }
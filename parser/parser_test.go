@@ -10,6 +10,20 @@ func exprEq(expect string, receive string) bool {
 	return expect == receive
 }
 
+func parse(t *testing.T, parser *Parser) *ast.Program {
+	program, diagnostics := parser.Parse()
+
+	for _, diagnostic := range diagnostics {
+		t.Error(diagnostic.String())
+	}
+
+	if len(diagnostics) > 0 {
+		t.FailNow()
+	}
+
+	return program
+}
+
 func TestSimpleExpression(t *testing.T) {
 	path := "../tests/valid/parser/simple_expression.tiny"
 	source := shared.ReadFile(path)
@@ -26,7 +40,7 @@ func TestFunctionDefinition(t *testing.T) {
 	source := shared.ReadFile(path)
 	parser := New(source, path, false)
 
-	result := parser.Parse().Body.AsSExp()
+	result := parse(t, parser).Body.AsSExp()
 	if !exprEq(result, "((function foo (a, b, c)()))") {
 		t.Fatalf("Expression failed '%s'", result)
 	}
@@ -37,7 +51,7 @@ func TestFunctionDefinitionMutable(t *testing.T) {
 	source := shared.ReadFile(path)
 	parser := New(source, path, false)
 
-	result := parser.Parse().Body.AsSExp()
+	result := parse(t, parser).Body.AsSExp()
 	if !exprEq(result, "((function foo (a, b, c)()))") {
 		t.Fatalf("Expression failed '%s'", result)
 	}
@@ -48,7 +62,7 @@ func TestVariableDeclaration(t *testing.T) {
 	source := shared.ReadFile(path)
 	parser := New(source, path, false)
 
-	result := parser.Parse().Body.AsSExp()
+	result := parse(t, parser).Body.AsSExp()
 	if !exprEq(result, "((mut foo (+ 1 2)))") {
 		t.Fatalf("Expression failed '%s'", result)
 	}
@@ -59,7 +73,7 @@ func TestFunctionWithBlock(t *testing.T) {
 	source := shared.ReadFile(path)
 	parser := New(source, path, false)
 
-	result := parser.Parse().Body.AsSExp()
+	result := parse(t, parser).Body.AsSExp()
 	if !exprEq(result, "((mut a 1)(mut b a)(function foo (a, b, c)((mut d 1)(mut e a))))") {
 		t.Fatalf("Expression failed '%s'", result)
 	}
@@ -70,7 +84,7 @@ func TestAssignment(t *testing.T) {
 	source := shared.ReadFile(path)
 	parser := New(source, path, false)
 
-	result := parser.Parse().Body.AsSExp()
+	result := parse(t, parser).Body.AsSExp()
 	if !exprEq(result, "((mut a 10)(mut b (a = (+ 3 (/ (* 20 3) 2))))(b = 2))") {
 		t.Fatalf("Expression failed '%s'", result)
 	}
@@ -81,8 +95,328 @@ func TestAnonymousFunction(t *testing.T) {
 	source := shared.ReadFile(path)
 	parser := New(source, path, false)
 
-	result := parser.Parse().Body.AsSExp()
+	result := parse(t, parser).Body.AsSExp()
 	if !exprEq(result, "((function call (x, y, fn)((return fn(x, y))))(mut fn (anon function (a, b)((return (+ a b)))))(mut value1 call(10, 20, fn))(print(value1))(mut value2 call(30, 40, (anon function (a, b)((return (+ a b))))))(print(value2)))") {
 		t.Fatalf("Expression failed '%s'", result)
 	}
 }
+
+func TestDocComments(t *testing.T) {
+	path := "../tests/valid/parser/doc_comments.tiny"
+	source := shared.ReadFile(path)
+	parser := New(source, path, false)
+
+	result := parse(t, parser).Body.AsSExp()
+	if !exprEq(result, `((function add (doc "Adds two numbers\nReturns their sum") (a, b)())(function plain ()())(Point (doc "A point in space")((mut x )))(namespace Shapes (doc "Shapes")((Circle (doc "A circle")()()))))`) {
+		t.Fatalf("Expression failed '%s'", result)
+	}
+}
+
+func TestModules(t *testing.T) {
+	path := "../tests/valid/parser/modules.tiny"
+	source := shared.ReadFile(path)
+	parser := New(source, path, false)
+
+	program := parse(t, parser)
+
+	result := program.Body.AsSExp()
+	if !exprEq(result, `((import "lib/math" into math)(import "lib/math" into numbers)(function add (doc "Exported") (a, b)())(mut count 0)(code (import script)))`) {
+		t.Fatalf("Expression failed '%s'", result)
+	}
+
+	for _, stmt := range program.Body.Statements[2:4] {
+		if fn, ok := stmt.(*ast.FunctionDef); ok && !fn.Public {
+			t.Fatalf("Expected '%s' to be public", fn.GetToken().Lexeme)
+		}
+
+		if decl, ok := stmt.(*ast.VariableDecl); ok && !decl.Public {
+			t.Fatalf("Expected '%s' to be public", decl.GetToken().Lexeme)
+		}
+	}
+}
+
+func TestPatterns(t *testing.T) {
+	path := "../tests/valid/parser/patterns.tiny"
+	source := shared.ReadFile(path)
+	parser := New(source, path, false)
+
+	result := parse(t, parser).Body.AsSExp()
+	if !exprEq(result, `(([a b ...rest] list)(mut {x y} point)([a b] = [b, a]))`) {
+		t.Fatalf("Expression failed '%s'", result)
+	}
+}
+
+func TestParams(t *testing.T) {
+	path := "../tests/valid/parser/params.tiny"
+	source := shared.ReadFile(path)
+	parser := New(source, path, false)
+
+	result := parse(t, parser).Body.AsSExp()
+	if !exprEq(result, `((function f (a, b=2, ...rest)())f(1, b: 5))`) {
+		t.Fatalf("Expression failed '%s'", result)
+	}
+}
+
+func TestEnums(t *testing.T) {
+	path := "../tests/valid/parser/enums.tiny"
+	source := shared.ReadFile(path)
+	parser := New(source, path, false)
+
+	result := parse(t, parser).Body.AsSExp()
+	if !exprEq(result, `((enum Shape Circle(r) Rect(w, h) Empty)(match shape((Circle.Shape(r)=> (print(r)))(Empty.Shape=> (print(empty))))))`) {
+		t.Fatalf("Expression failed '%s'", result)
+	}
+}
+
+func TestTraits(t *testing.T) {
+	path := "../tests/valid/parser/traits.tiny"
+	source := shared.ReadFile(path)
+	parser := New(source, path, false)
+
+	result := parse(t, parser).Body.AsSExp()
+	if !exprEq(result, `((trait Shape area() (function name ()((return shape))))(Square (impl Shape, Named) ()()))`) {
+		t.Fatalf("Expression failed '%s'", result)
+	}
+}
+
+func TestFor(t *testing.T) {
+	path := "../tests/valid/parser/for.tiny"
+	source := shared.ReadFile(path)
+	parser := New(source, path, false)
+
+	result := parse(t, parser).Body.AsSExp()
+	if !exprEq(result, `((for i, x in items((print(x)))))`) {
+		t.Fatalf("Expression failed '%s'", result)
+	}
+}
+
+func TestRanges(t *testing.T) {
+	path := "../tests/valid/parser/ranges.tiny"
+	source := shared.ReadFile(path)
+	parser := New(source, path, false)
+
+	result := parse(t, parser).Body.AsSExp()
+	if !exprEq(result, `((a (0..(- n 1) step 2))(b items[(..5)])(c items[(1..=2)]))`) {
+		t.Fatalf("Expression failed '%s'", result)
+	}
+}
+
+func TestGenerators(t *testing.T) {
+	path := "../tests/valid/parser/generators.tiny"
+	source := shared.ReadFile(path)
+	parser := New(source, path, false)
+
+	program := parse(t, parser)
+	result := program.Body.AsSExp()
+	if !exprEq(result, `((function count (to)((yield to)(inner (anon function ()())))))`) {
+		t.Fatalf("Expression failed '%s'", result)
+	}
+
+	fn := program.Body.Statements[0].(*ast.FunctionDef)
+	if !fn.Generator {
+		t.Fatalf("Function with yield was not marked as a generator")
+	}
+
+	anon := fn.Body.Statements[1].(*ast.VariableDecl).Expr.(*ast.AnonymousFunction)
+	if anon.Generator {
+		t.Fatalf("Nested function was marked as a generator")
+	}
+}
+
+func TestDefer(t *testing.T) {
+	path := "../tests/valid/parser/defer.tiny"
+	source := shared.ReadFile(path)
+	parser := New(source, path, false)
+
+	result := parse(t, parser).Body.AsSExp()
+	if !exprEq(result, `((function f ()((defer close())(a (catch g():err() finally(close()))))))`) {
+		t.Fatalf("Expression failed '%s'", result)
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	path := "../tests/valid/parser/pipeline.tiny"
+	source := shared.ReadFile(path)
+	parser := New(source, path, false)
+
+	result := parse(t, parser).Body.AsSExp()
+	if !exprEq(result, `((a g(f(x, 1))))`) {
+		t.Fatalf("Expression failed '%s'", result)
+	}
+}
+
+func TestOptional(t *testing.T) {
+	path := "../tests/valid/parser/optional.tiny"
+	source := shared.ReadFile(path)
+	parser := New(source, path, false)
+
+	result := parse(t, parser).Body.AsSExp()
+	if !exprEq(result, `((a (?? z?.y?.x w?[0]))f?.(1))`) {
+		t.Fatalf("Expression failed '%s'", result)
+	}
+}
+
+func TestConst(t *testing.T) {
+	path := "../tests/valid/parser/const.tiny"
+	source := shared.ReadFile(path)
+	parser := New(source, path, false)
+
+	result := parse(t, parser).Body.AsSExp()
+	if !exprEq(result, `((const a (+ 1 2)))`) {
+		t.Fatalf("Expression failed '%s'", result)
+	}
+}
+
+func TestStatic(t *testing.T) {
+	path := "../tests/valid/parser/static.tiny"
+	source := shared.ReadFile(path)
+	parser := New(source, path, false)
+
+	result := parse(t, parser).Body.AsSExp()
+	if !exprEq(result, `((A()()(static (mut count 1))(get (function size ()((return 1))))))`) {
+		t.Fatalf("Expression failed '%s'", result)
+	}
+}
+
+func TestVisibility(t *testing.T) {
+	path := "../tests/valid/parser/visibility.tiny"
+	source := shared.ReadFile(path)
+	parser := New(source, path, false)
+
+	result := parse(t, parser).Body.AsSExp()
+	if !exprEq(result, `((A((mut b ))(priv b)))`) {
+		t.Fatalf("Expression failed '%s'", result)
+	}
+}
+
+// --- Invalid ---
+func TestMultipleErrors(t *testing.T) {
+	path := "../tests/invalid/parser/multiple_errors.tiny"
+	source := shared.ReadFile(path)
+	parser := New(source, path, false)
+
+	_, diagnostics := parser.Parse()
+	expected := []struct {
+		line, column int
+		expected     string
+	}{
+		{2, 10, "expression"},
+		{6, 11, "';'"},
+		{10, 2, "function or var"},
+		{14, 1, "'}'"},
+	}
+
+	if len(diagnostics) != len(expected) {
+		for _, diagnostic := range diagnostics {
+			t.Log(diagnostic.String())
+		}
+		t.Fatalf("Expected %d diagnostics but received %d", len(expected), len(diagnostics))
+	}
+
+	for idx, diagnostic := range diagnostics {
+		if diagnostic.Line != expected[idx].line || diagnostic.Column != expected[idx].column || diagnostic.Expected != expected[idx].expected {
+			t.Errorf("Unexpected diagnostic '%s' expected %v", diagnostic.String(), expected[idx])
+		}
+
+		if diagnostic.File != path {
+			t.Errorf("Diagnostic has wrong file '%s'", diagnostic.File)
+		}
+	}
+}
+
+func TestInvalidParams(t *testing.T) {
+	path := "../tests/invalid/parser/params.tiny"
+	source := shared.ReadFile(path)
+	parser := New(source, path, false)
+
+	_, diagnostics := parser.Parse()
+	expected := []struct {
+		line, column int
+	}{
+		{1, 19},
+		{2, 21},
+		{3, 20},
+		{4, 9},
+	}
+
+	if len(diagnostics) != len(expected) {
+		for _, diagnostic := range diagnostics {
+			t.Log(diagnostic.String())
+		}
+		t.Fatalf("Expected %d diagnostics but received %d", len(expected), len(diagnostics))
+	}
+
+	for idx, diagnostic := range diagnostics {
+		if diagnostic.Line != expected[idx].line || diagnostic.Column != expected[idx].column {
+			t.Errorf("Unexpected diagnostic '%s' expected %v", diagnostic.String(), expected[idx])
+		}
+	}
+}
+
+func TestInvalidRanges(t *testing.T) {
+	path := "../tests/invalid/parser/ranges.tiny"
+	source := shared.ReadFile(path)
+	parser := New(source, path, false)
+
+	_, diagnostics := parser.Parse()
+	if len(diagnostics) != 1 || diagnostics[0].Line != 1 || diagnostics[0].Column != 17 {
+		t.Fatalf("Expected a single diagnostic at 1:17 but received %v", diagnostics)
+	}
+}
+
+func TestInvalidPipeline(t *testing.T) {
+	path := "../tests/invalid/parser/pipeline.tiny"
+	source := shared.ReadFile(path)
+	parser := New(source, path, false)
+
+	_, diagnostics := parser.Parse()
+	if len(diagnostics) != 1 || diagnostics[0].Line != 1 || diagnostics[0].Column != 14 {
+		t.Fatalf("Expected a single diagnostic at 1:14 but received %v", diagnostics)
+	}
+}
+
+func TestInvalidConst(t *testing.T) {
+	path := "../tests/invalid/parser/const.tiny"
+	source := shared.ReadFile(path)
+	parser := New(source, path, false)
+
+	_, diagnostics := parser.Parse()
+	if len(diagnostics) != 1 || diagnostics[0].Line != 1 || diagnostics[0].Column != 7 {
+		t.Fatalf("Expected a single diagnostic at 1:7 but received %v", diagnostics)
+	}
+}
+
+func TestInvalidStatic(t *testing.T) {
+	path := "../tests/invalid/parser/static.tiny"
+	source := shared.ReadFile(path)
+	parser := New(source, path, false)
+
+	_, diagnostics := parser.Parse()
+	if len(diagnostics) != 1 || diagnostics[0].Line != 1 || diagnostics[0].Column != 18 {
+		t.Fatalf("Expected a single diagnostic at 1:18 but received %v", diagnostics)
+	}
+}
+
+func TestInvalidVisibility(t *testing.T) {
+	path := "../tests/invalid/parser/visibility.tiny"
+	source := shared.ReadFile(path)
+	parser := New(source, path, false)
+
+	_, diagnostics := parser.Parse()
+	if len(diagnostics) != 1 || diagnostics[0].Line != 1 || diagnostics[0].Column != 1 {
+		t.Fatalf("Expected a single diagnostic at 1:1 but received %v", diagnostics)
+	}
+}
+
+// Recovering skips past the brackets the failed statement opened, rather
+// than reporting their contents as well
+func TestInvalidSynchronise(t *testing.T) {
+	path := "../tests/invalid/parser/synchronise.tiny"
+	source := shared.ReadFile(path)
+	parser := New(source, path, false)
+
+	_, diagnostics := parser.Parse()
+	if len(diagnostics) != 1 || diagnostics[0].Line != 1 || diagnostics[0].Column != 7 {
+		t.Fatalf("Expected a single diagnostic at 1:7 but received %v", diagnostics)
+	}
+}
@@ -0,0 +1,143 @@
+package runtime
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// Describe a value for messages, quoting strings so they stand out from
+// other values with the same text
+func Describe(value Value) string {
+	if str, ok := value.(*StringVal); ok {
+		return strconv.Quote(str.Value)
+	}
+
+	return value.Inspect()
+}
+
+// Diff compares two values structurally, walking into lists, structs and
+// class instances. Each difference is described on its own line, starting
+// with the path to where it was found, so an empty result means they match.
+func Diff(expected Value, actual Value) []string {
+	return diff("value", expected, actual, make([]string, 0))
+}
+
+// DeepEquality is like Equality, but compares the contents of lists, structs
+// and class instances rather than only their shape
+func DeepEquality(expected Value, actual Value) bool {
+	return len(Diff(expected, actual)) == 0
+}
+
+func diff(path string, expected Value, actual Value, lines []string) []string {
+	// Fields which were never set have no value
+	if expected == nil || actual == nil {
+		if expected != actual {
+			return append(lines, fmt.Sprintf("%s: expected %s, got %s", path, describeField(expected), describeField(actual)))
+		}
+		return lines
+	}
+
+	if reflect.TypeOf(expected) != reflect.TypeOf(actual) {
+		return append(lines, fmt.Sprintf("%s: expected %s (%s), got %s (%s)", path, Describe(expected), expected.GetType().GetName(), Describe(actual), actual.GetType().GetName()))
+	}
+
+	switch left := expected.(type) {
+	case *UnitVal:
+		return lines
+
+	case *ListVal:
+		right := actual.(*ListVal)
+
+		if len(left.Values) != len(right.Values) {
+			lines = append(lines, fmt.Sprintf("%s: expected %d item(s), got %d", path, len(left.Values), len(right.Values)))
+		}
+
+		for idx := 0; idx < len(left.Values) && idx < len(right.Values); idx++ {
+			lines = diff(fmt.Sprintf("%s[%d]", path, idx), left.Values[idx], right.Values[idx], lines)
+		}
+
+		for idx := len(right.Values); idx < len(left.Values); idx++ {
+			lines = append(lines, fmt.Sprintf("%s[%d]: missing %s", path, idx, Describe(left.Values[idx])))
+		}
+
+		for idx := len(left.Values); idx < len(right.Values); idx++ {
+			lines = append(lines, fmt.Sprintf("%s[%d]: unexpected %s", path, idx, Describe(right.Values[idx])))
+		}
+
+		return lines
+
+	case *StructInstanceValue:
+		right := actual.(*StructInstanceValue)
+
+		// Types with their own equality decide for themselves
+		if equal, ok := overloadEquality(left, right); ok {
+			if !equal {
+				lines = append(lines, fmt.Sprintf("%s: expected %s, got %s", path, left.Inspect(), right.Inspect()))
+			}
+			return lines
+		}
+
+		if left.def != right.def {
+			return append(lines, fmt.Sprintf("%s: expected %s, got %s", path, left.def.identifier, right.def.identifier))
+		}
+
+		for _, field := range left.def.fields {
+			lines = diff(path+"."+field, left.fields[field], right.fields[field], lines)
+		}
+
+		return lines
+
+	case *EnumVal:
+		right := actual.(*EnumVal)
+
+		values, ok := right.payload(left.variant)
+		if !ok {
+			return append(lines, fmt.Sprintf("%s: expected %s, got %s", path, left.Inspect(), right.Inspect()))
+		}
+
+		for idx, field := range left.variant.fields {
+			lines = diff(path+"."+field, left.values[idx], values[idx], lines)
+		}
+
+		return lines
+
+	case *ClassInstanceValue:
+		right := actual.(*ClassInstanceValue)
+
+		if equal, ok := overloadEquality(left, right); ok {
+			if !equal {
+				lines = append(lines, fmt.Sprintf("%s: expected %s, got %s", path, left.Inspect(), right.Inspect()))
+			}
+			return lines
+		}
+
+		def, ok := left.Def.(*ClassDefValue)
+		if !ok || left.Def != right.Def {
+			if !Equality(left, right) {
+				return append(lines, fmt.Sprintf("%s: expected %s, got %s", path, left.Inspect(), right.Inspect()))
+			}
+			return lines
+		}
+
+		for _, field := range def.fields {
+			lines = diff(path+"."+field, left.fields[field], right.fields[field], lines)
+		}
+
+		return lines
+	}
+
+	if !Equality(expected, actual) {
+		lines = append(lines, fmt.Sprintf("%s: expected %s, got %s", path, Describe(expected), Describe(actual)))
+	}
+
+	return lines
+}
+
+func describeField(value Value) string {
+	if value == nil {
+		return "nothing"
+	}
+
+	return Describe(value)
+}
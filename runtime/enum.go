@@ -0,0 +1,153 @@
+package runtime
+
+import (
+	"fmt"
+	"strings"
+	"tiny/ast"
+	"tiny/lexer"
+)
+
+// EnumDefValue holds the variants of an enum, which are read from it like members
+type EnumDefValue struct {
+	identifier string
+	variants   []*EnumVariantValue
+}
+
+// EnumVariantValue is one variant of an enum. Variants with a payload are
+// called with their fields to build a value, the others are a value already.
+type EnumVariantValue struct {
+	enum       *EnumDefValue
+	identifier string
+	fields     []string
+	// Shared by every use of a variant without a payload
+	value *EnumVal
+}
+
+// EnumVal is a variant of an enum, with the payload it was built with
+type EnumVal struct {
+	variant *EnumVariantValue
+	values  []Value
+}
+
+func newEnumDef(def *ast.EnumDef) *EnumDefValue {
+	enum := &EnumDefValue{identifier: def.Token.Lexeme, variants: make([]*EnumVariantValue, 0, len(def.Variants))}
+
+	for _, node := range def.Variants {
+		variant := &EnumVariantValue{enum: enum, identifier: node.Token.Lexeme}
+
+		if node.Fields == nil {
+			variant.value = &EnumVal{variant: variant, values: []Value{}}
+		} else {
+			variant.fields = make([]string, 0, len(node.Fields))
+
+			for _, field := range node.Fields {
+				variant.fields = append(variant.fields, field.Lexeme)
+			}
+		}
+
+		enum.variants = append(enum.variants, variant)
+	}
+
+	return enum
+}
+
+func (v *EnumDefValue) GetType() Type                                      { return &EnumDefType{} }
+func (v *EnumDefValue) Inspect() string                                    { return fmt.Sprintf("<enum %s>", v.identifier) }
+func (v *EnumDefValue) Copy() Value                                        { return v }
+func (v *EnumDefValue) Modify(operation lexer.TokenKind, other Value) bool { return false }
+
+// Variants with a payload give back their constructor, the others their value
+func (def *EnumDefValue) Get(identifier string) (Value, bool) {
+	for _, variant := range def.variants {
+		if variant.identifier != identifier {
+			continue
+		}
+
+		if variant.value != nil {
+			return variant.value, true
+		}
+
+		return variant, true
+	}
+
+	return nil, false
+}
+
+func (v *EnumVariantValue) GetType() Type { return &EnumDefType{} }
+func (v *EnumVariantValue) Inspect() string {
+	return fmt.Sprintf("<variant %s.%s>", v.enum.identifier, v.identifier)
+}
+func (v *EnumVariantValue) Copy() Value                                        { return v }
+func (v *EnumVariantValue) Modify(operation lexer.TokenKind, other Value) bool { return false }
+
+func (variant *EnumVariantValue) Arity() int { return len(variant.fields) }
+
+func (variant *EnumVariantValue) Parameters() []Param {
+	params := make([]Param, 0, len(variant.fields))
+
+	for _, field := range variant.fields {
+		params = append(params, Param{Name: field})
+	}
+
+	return params
+}
+
+func (variant *EnumVariantValue) Call(interpreter *Interpreter, values []Value) Value {
+	values, err := Bind(variant.Parameters(), values)
+	if err != nil {
+		interpreter.Report("Variant '%s.%s' %s", variant.enum.identifier, variant.identifier, err)
+	}
+
+	return &EnumVal{variant: variant, values: values}
+}
+
+func (v *EnumVal) GetType() Type { return &EnumType{} }
+func (v *EnumVal) Inspect() string {
+	name := fmt.Sprintf("%s.%s", v.variant.enum.identifier, v.variant.identifier)
+
+	if v.variant.value != nil {
+		return name
+	}
+
+	values := make([]string, 0, len(v.values))
+
+	for _, value := range v.values {
+		values = append(values, value.Inspect())
+	}
+
+	return fmt.Sprintf("%s(%s)", name, strings.Join(values, ", "))
+}
+
+// Enum values cannot be changed, so they are shared rather than copied
+func (v *EnumVal) Copy() Value                                        { return v }
+func (v *EnumVal) Modify(operation lexer.TokenKind, other Value) bool { return false }
+
+// The payload can be read by field name, like 'shape.radius'
+func (enum *EnumVal) Get(identifier string) (Value, bool) {
+	for idx, field := range enum.variant.fields {
+		if field == identifier {
+			return enum.values[idx], true
+		}
+	}
+
+	return nil, false
+}
+
+// Name of the enum the value belongs to
+func (enum *EnumVal) Definition() string {
+	return enum.variant.enum.identifier
+}
+
+// Name of the variant, without the enum
+func (enum *EnumVal) Variant() string {
+	return enum.variant.identifier
+}
+
+// Payload of the value, when it was built from the given variant
+func (enum *EnumVal) payload(variant *EnumVariantValue) ([]Value, bool) {
+	if enum.variant != variant {
+		return nil, false
+	}
+
+	return enum.values, true
+}
@@ -0,0 +1,92 @@
+package runtime
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"tiny/lexer"
+)
+
+// FileValue is an open file, read a line at a time or written in pieces
+// instead of all at once
+type FileValue struct {
+	Path   string
+	file   *os.File
+	reader *bufio.Reader
+}
+
+// OpenFile opens a file for reading with "r", writing over it with "w" or
+// adding to its end with "a"
+func OpenFile(path string, mode string) (*FileValue, error) {
+	var flags int
+
+	switch mode {
+	case "r":
+		flags = os.O_RDONLY
+	case "w":
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	case "a":
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	default:
+		return nil, fmt.Errorf("Unknown file mode '%s', expected 'r', 'w' or 'a'", mode)
+	}
+
+	file, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileValue{Path: path, file: file, reader: bufio.NewReader(file)}, nil
+}
+
+// ReadLine gives back the next line without its line ending, and false once
+// the file has nothing left to read
+func (v *FileValue) ReadLine() (string, bool, error) {
+	if v.file == nil {
+		return "", false, os.ErrClosed
+	}
+
+	line, err := v.reader.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", false, err
+	}
+
+	if len(line) == 0 && err != nil {
+		return "", false, nil
+	}
+
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), true, nil
+}
+
+func (v *FileValue) Write(contents string) error {
+	if v.file == nil {
+		return os.ErrClosed
+	}
+
+	_, err := v.file.WriteString(contents)
+	return err
+}
+
+// Close can be called more than once, only the first closes the file
+func (v *FileValue) Close() error {
+	if v.file == nil {
+		return nil
+	}
+
+	err := v.file.Close()
+	v.file = nil
+	return err
+}
+
+func (v *FileValue) GetType() Type { return &FileType{} }
+func (v *FileValue) Inspect() string {
+	if v.file == nil {
+		return fmt.Sprintf("<file %s : closed>", v.Path)
+	}
+	return fmt.Sprintf("<file %s>", v.Path)
+}
+func (v *FileValue) Copy() Value                                        { return v }
+func (v *FileValue) Modify(operation lexer.TokenKind, other Value) bool { return false }
@@ -0,0 +1,75 @@
+package runtime
+
+import "fmt"
+
+// Values that can be frozen, after which changing them throws instead
+type Freezable interface {
+	Value
+	Freeze()
+	Frozen() bool
+}
+
+// Freezes a value along with everything it holds. Other values cannot be
+// changed in place anyway, so they are left alone.
+func Freeze(value Value) Value {
+	if freezable, ok := value.(Freezable); ok && !freezable.Frozen() {
+		freezable.Freeze()
+	}
+
+	return value
+}
+
+func IsFrozen(value Value) bool {
+	freezable, ok := value.(Freezable)
+	return ok && freezable.Frozen()
+}
+
+// Thrown when something tries to change a frozen value
+func FrozenError(value Value) *ThrowValue {
+	return NewThrow(&StringVal{Value: fmt.Sprintf("Cannot modify frozen %s", describeFrozen(value))})
+}
+
+func describeFrozen(value Value) string {
+	switch t := value.(type) {
+	case *ClassInstanceValue:
+		return fmt.Sprintf("instance of '%s'", t.Definition())
+	case *StructInstanceValue:
+		return fmt.Sprintf("instance of '%s'", t.Definition())
+	}
+
+	return "list"
+}
+
+func (v *ListVal) Freeze() {
+	v.frozen = true
+
+	for _, item := range v.Values {
+		Freeze(item)
+	}
+}
+
+func (v *ListVal) Frozen() bool { return v.frozen }
+
+func (v *StructInstanceValue) Freeze() {
+	v.frozen = true
+
+	for _, field := range v.fields {
+		Freeze(field)
+	}
+}
+
+func (v *StructInstanceValue) Frozen() bool { return v.frozen }
+
+func (v *ClassInstanceValue) Freeze() {
+	v.frozen = true
+
+	for _, field := range v.fields {
+		Freeze(field)
+	}
+
+	if v.base != nil {
+		v.base.Freeze()
+	}
+}
+
+func (v *ClassInstanceValue) Frozen() bool { return v.frozen }
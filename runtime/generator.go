@@ -0,0 +1,180 @@
+package runtime
+
+import (
+	goruntime "runtime"
+	"tiny/ast"
+)
+
+// generator runs the body of a generator function on its own goroutine, so it
+// can be paused at each yield. Only one side runs at a time, the caller waits
+// for a step while the body runs, and the body waits to be resumed.
+type generator struct {
+	resume chan bool
+	steps  chan generatorStep
+	done   bool
+	// The goroutine is only started when the first item is asked for, so a
+	// generator which is never used costs nothing
+	started     bool
+	interpreter *Interpreter
+	body        *ast.Block
+	// Set when the iterator was dropped part way, so the paused body ends
+	// without running anything else
+	abandoned bool
+}
+
+type generatorStep struct {
+	value    Value
+	finished bool
+	// Raised while running the body, to be raised again by the caller
+	failure any
+}
+
+// Raised at a yield when the generator is stopped before it finishes
+type generatorStopped struct{}
+
+// Calls a generator function, binding its arguments straight away so they
+// are checked where it was called
+func (interpreter *Interpreter) generate(name string, bound Value, params []*ast.Parameter, values []Value, body *ast.Block) Value {
+	child := interpreter.fork()
+	child.push()
+
+	if bound != nil {
+		child.insert("self", bound)
+	}
+
+	child.bindParams(name, params, values)
+
+	return child.newGenerator(name, body)
+}
+
+// Creates an iterator over the values yielded by a body. Nothing runs until
+// the first item is asked for. The interpreter must be one made by fork,
+// with the parameters already bound.
+func (interpreter *Interpreter) newGenerator(name string, body *ast.Block) *IteratorValue {
+	gen := &generator{resume: make(chan bool), steps: make(chan generatorStep), interpreter: interpreter, body: body}
+	interpreter.generator = gen
+
+	iterator := &IteratorValue{name: name, next: gen.next, stop: gen.stop}
+
+	// Loops stop what they leave early, but an iterator can be dropped part
+	// way elsewhere, leaving its goroutine paused for good
+	goruntime.SetFinalizer(iterator, func(*IteratorValue) { gen.abandon() })
+
+	return iterator
+}
+
+// Gives the generator a copy of the scopes it was called from, so pushing
+// and popping as it resumes does not disturb the caller
+func (interpreter *Interpreter) fork() *Interpreter {
+	return &Interpreter{env: interpreter.env.snapshot(), importer: interpreter.importer, class: interpreter.class}
+}
+
+func (gen *generator) run() {
+	defer func() {
+		if r := recover(); r != nil {
+			gen.steps <- generatorStep{failure: r}
+		}
+	}()
+	defer gen.interpreter.unwind(0)
+
+	gen.interpreter.enter()
+	result := gen.runBody()
+
+	if gen.abandoned {
+		return
+	}
+
+	result = gen.interpreter.exit(result)
+
+	// A thrown value is the last item, and returning simply finishes
+	if thrown, ok := result.(*ThrowValue); ok {
+		gen.steps <- generatorStep{value: thrown, finished: true}
+		return
+	}
+
+	gen.steps <- generatorStep{finished: true}
+}
+
+// Runs the body until it finishes or is stopped at a yield
+func (gen *generator) runBody() (result Value) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(generatorStopped); !ok {
+				panic(r)
+			}
+
+			result = &UnitVal{}
+		}
+	}()
+
+	return gen.interpreter.visitBlock(gen.body, false)
+}
+
+func (gen *generator) next() (Value, bool, error) {
+	if gen.done {
+		return nil, false, nil
+	}
+
+	if gen.started {
+		gen.resume <- true
+	} else {
+		gen.started = true
+		go gen.run()
+	}
+
+	step := <-gen.steps
+
+	if step.failure != nil {
+		gen.done = true
+		panic(step.failure)
+	}
+
+	if step.finished {
+		gen.done = true
+		return step.value, step.value != nil, nil
+	}
+
+	return step.value, true, nil
+}
+
+// Lets a paused body unwind when the generator will not be resumed again,
+// waiting for what it deferred to run
+func (gen *generator) stop() {
+	if gen.done {
+		return
+	}
+
+	gen.done = true
+
+	// Nothing has run, so there is nothing to unwind
+	if !gen.started {
+		return
+	}
+
+	gen.resume <- false
+
+	if step := <-gen.steps; step.failure != nil {
+		panic(step.failure)
+	}
+}
+
+// Ends the goroutine of a paused body nothing can resume. What it deferred
+// is not run, as that would happen alongside the rest of the script.
+func (gen *generator) abandon() {
+	if gen.done || !gen.started {
+		return
+	}
+
+	gen.done = true
+	gen.abandoned = true
+	gen.resume <- false
+}
+
+// Hands a value to the caller, then waits to be resumed
+func (gen *generator) yield(value Value) {
+	gen.steps <- generatorStep{value: value}
+
+	if !<-gen.resume {
+		panic(generatorStopped{})
+	}
+}
@@ -23,41 +23,171 @@ type testStats struct {
 }
 
 type Interpreter struct {
-	env     environment
-	in_test bool
-	tests   testStats
+	env      environment
+	tests    testStats
+	importer Importer
+	// Set while running the body of a generator
+	generator *generator
+	// Statements deferred by each function being called
+	defers [][]deferred
+	// Definition of the class or struct whose function is running
+	class Value
+}
+
+// A statement to run when a function exits. Calls and prints have what they
+// are given evaluated when deferred, like Go, so only run is left. Anything
+// else runs in the scopes it was deferred in, seeing their values at exit.
+type deferred struct {
+	run  func() Value
+	body ast.Node
+	env  environment
+}
+
+// Importer provides the namespace of the module an import refers to
+type Importer interface {
+	Load(interpreter *Interpreter, imp *ast.Import) Value
+	// Import loads a file while running, throwing when it cannot be loaded
+	Import(interpreter *Interpreter, path string, token *lexer.Token) Value
 }
 
 type TinyCallable interface {
+	// The number of arguments which must always be given
 	Arity() int
+	Parameters() []Param
 	Call(*Interpreter, []Value) Value
 }
 
 func New() *Interpreter {
-	interpreter := &Interpreter{env: environment{variables: make([]map[string]Value, 0, 1), depth: 0}, in_test: false, tests: testStats{0, 0}}
+	interpreter := &Interpreter{env: environment{variables: make([]map[string]Value, 0, 1), depth: 0}, tests: testStats{0, 0}}
 	interpreter.push()
 
 	return interpreter
 }
 
-func (interpreter *Interpreter) Run(program *ast.Program) {
-	// TODO: Might return a value to the caller of the interpreter run
+// RuntimeError is raised when the interpreter cannot continue executing
+type RuntimeError struct {
+	Diagnostic *shared.Diagnostic
+}
+
+func (err *RuntimeError) Error() string { return err.Diagnostic.String() }
+
+// ExitRequest is raised by a script asking to stop with a status code
+type ExitRequest struct {
+	Code int
+}
+
+// Run the program, returning the status the process should exit with
+func (interpreter *Interpreter) Run(program *ast.Program) (code int) {
+	defer func() {
+		if r := recover(); r != nil {
+			code = Recover(r)
+		}
+	}()
+
 	result := interpreter.visitBlock(program.Body, false)
 	interpreter.pop()
 
 	if res, ok := result.(*ThrowValue); ok {
-		interpreter.Report("Uncaught value thrown '%s'", res.inner.Inspect())
+		shared.Emit(shared.NewDiagnostic("Runtime", "Uncaught value thrown '%s'", res.inner.Inspect()))
+		return shared.EXIT_THROW
 	}
 
 	if interpreter.tests.tests > 0 {
 		shared.Info(fmt.Sprintf("Tests passed [%d/%d]", interpreter.tests.passed, interpreter.tests.tests))
+
+		if interpreter.tests.passed != interpreter.tests.tests {
+			return shared.EXIT_TEST
+		}
+	}
+
+	return shared.EXIT_OK
+}
+
+// Eval runs statements in the global environment, keeping their declarations
+// for later calls. It returns the value of the last statement, or nil with the
+// status of the error that stopped it.
+func (interpreter *Interpreter) Eval(program *ast.Program) (Value, int) {
+	result, err := interpreter.Execute(program)
+
+	if err != nil {
+		shared.Emit(err.Diagnostic)
+		return nil, shared.EXIT_RUNTIME
+	}
+
+	if res, ok := result.(*ThrowValue); ok {
+		shared.Emit(shared.NewDiagnostic("Runtime", "Uncaught value thrown '%s'", res.inner.Inspect()))
+		return nil, shared.EXIT_THROW
+	}
+
+	return result, shared.EXIT_OK
+}
+
+// Execute is like Eval, but hands back an uncaught throw or the runtime error
+// which stopped it, rather than reporting them
+func (interpreter *Interpreter) Execute(program *ast.Program) (result Value, err *RuntimeError) {
+	depth := interpreter.env.depth
+	frames := len(interpreter.defers)
+
+	defer func() {
+		if r := recover(); r != nil {
+			runtimeErr, ok := r.(*RuntimeError)
+			if !ok {
+				panic(r)
+			}
+
+			interpreter.env.depth = depth
+			interpreter.env.variables = interpreter.env.variables[:depth]
+			interpreter.defers = interpreter.defers[:frames]
+			result, err = nil, runtimeErr
+		}
+	}()
+
+	result = &UnitVal{}
+
+	for _, stmt := range program.Body.Statements {
+		result = interpreter.Visit(stmt)
+
+		if _, ok := result.(*ThrowValue); ok {
+			return result, nil
+		}
+	}
+
+	return result, nil
+}
+
+// Recover turns a value recovered from a runtime panic into an exit status,
+// reporting runtime errors and re-raising anything it does not own
+func Recover(r any) int {
+	switch err := r.(type) {
+	case *RuntimeError:
+		shared.Emit(err.Diagnostic)
+		return shared.EXIT_RUNTIME
+	case *ExitRequest:
+		return err.Code
+	default:
+		panic(r)
 	}
 }
 
+// Exit unwinds the interpreter, stopping the script with the given code
+func (interpreter *Interpreter) Exit(code int) {
+	panic(&ExitRequest{Code: code})
+}
+
 func (interpreter *Interpreter) Import(identifier string, value Value) {
 	interpreter.env.variables[interpreter.env.depth-1][identifier] = value
 }
 
+func (interpreter *Interpreter) SetImporter(importer Importer) {
+	interpreter.importer = importer
+}
+
+// Global finds a value declared at the top level of the program
+func (interpreter *Interpreter) Global(identifier string) (Value, bool) {
+	value, ok := interpreter.env.variables[0][identifier]
+	return value, ok
+}
+
 func (interpreter *Interpreter) insert(identifier string, value Value) {
 	interpreter.env.variables[interpreter.env.depth-1][identifier] = value
 }
@@ -93,6 +223,15 @@ func (interpreter *Interpreter) lookup(identifier string) Value {
 	return nil
 }
 
+// Copies the stack of scopes, so pushing and popping on the copy leaves this
+// one alone. The scopes themselves are shared.
+func (env environment) snapshot() environment {
+	variables := make([]map[string]Value, len(env.variables))
+	copy(variables, env.variables)
+
+	return environment{variables: variables, depth: env.depth}
+}
+
 func (interpreter *Interpreter) push() {
 	interpreter.env.depth += 1
 	interpreter.env.variables = append(interpreter.env.variables, make(map[string]Value))
@@ -105,22 +244,11 @@ func (interpreter *Interpreter) pop() {
 
 // --- Private ---
 func (interpreter *Interpreter) Report(msg string, args ...any) {
-	if interpreter.in_test {
-		interpreter.ReportTestF(msg, args)
-	} else {
-		res := fmt.Sprintf(msg, args...)
-		shared.ReportErrFatal("Runtime: " + res)
-	}
+	panic(&RuntimeError{shared.NewDiagnostic("Runtime", msg, args...)})
 }
 
 func (interpreter *Interpreter) ReportT(msg string, token *lexer.Token, args ...any) {
-	if interpreter.in_test {
-		interpreter.ReportTest(msg, token)
-	} else {
-		res := fmt.Sprintf(msg, args...)
-		res = fmt.Sprintf("Runtime: %s [%d:%d]", res, token.Line, token.Column)
-		shared.ReportErrFatal(res)
-	}
+	panic(&RuntimeError{shared.NewDiagnostic("Runtime", msg, args...).At(token.File, token.Line, token.Column, token.Length())})
 }
 
 func (interpreter *Interpreter) ReportTest(msg string, token *lexer.Token) {
@@ -131,10 +259,6 @@ func (interpreter *Interpreter) ReportTest(msg string, token *lexer.Token) {
 	}
 }
 
-func (interpreter *Interpreter) ReportTestF(msg string, args ...any) {
-	log.Printf("Test: %s", fmt.Sprintf(msg, args...))
-}
-
 func (interpreter *Interpreter) Visit(node ast.Node) Value {
 	switch n := node.(type) {
 	case *ast.BinaryOp:
@@ -149,6 +273,8 @@ func (interpreter *Interpreter) Visit(node ast.Node) Value {
 		return &UnitVal{}
 	case *ast.ListLiteral:
 		return interpreter.visitList(n)
+	case *ast.Range:
+		return interpreter.visitRange(n)
 	case *ast.Literal:
 		return interpreter.visitLiteral(n)
 	case *ast.Identifier:
@@ -165,6 +291,10 @@ func (interpreter *Interpreter) Visit(node ast.Node) Value {
 		return interpreter.visitClassDef(n)
 	case *ast.StructDef:
 		return interpreter.visitStructDef(n)
+	case *ast.EnumDef:
+		return interpreter.visitEnumDef(n)
+	case *ast.TraitDef:
+		return interpreter.visitTraitDef(n)
 	case *ast.NameSpace:
 		return interpreter.visitNamespace(n)
 	case *ast.Argument:
@@ -177,6 +307,10 @@ func (interpreter *Interpreter) Visit(node ast.Node) Value {
 		return interpreter.visitReturn(n)
 	case *ast.Throw:
 		return interpreter.visitThrow(n)
+	case *ast.Yield:
+		return interpreter.visitYield(n)
+	case *ast.Defer:
+		return interpreter.visitDefer(n)
 	case *ast.Get:
 		return interpreter.visitGet(n)
 	case *ast.Set:
@@ -191,8 +325,12 @@ func (interpreter *Interpreter) Visit(node ast.Node) Value {
 		return interpreter.visitIfStmt(n)
 	case *ast.While:
 		return interpreter.visitWhileStmt(n)
+	case *ast.For:
+		return interpreter.visitFor(n)
 	case *ast.Catch:
 		return interpreter.visitCatch(n)
+	case *ast.ImportExpr:
+		return interpreter.visitImportExpr(n)
 	case *ast.Test:
 		return interpreter.visitTest(n)
 	case *ast.Break:
@@ -202,9 +340,8 @@ func (interpreter *Interpreter) Visit(node ast.Node) Value {
 	case *ast.Match:
 		return interpreter.visitMatchCase(n)
 
-	// Ignore
 	case *ast.Import:
-		return nil
+		return interpreter.visitImport(n)
 	}
 
 	interpreter.ReportT("Unhandled node in Visit '%s'", node.GetToken(), node.GetToken().Lexeme)
@@ -216,6 +353,11 @@ func (interpreter *Interpreter) visitBinaryOp(binop *ast.BinaryOp) Value {
 	left := interpreter.Visit(binop.Left)
 	right := interpreter.Visit(binop.Right)
 
+	// Instances can define how operators treat them
+	if value, ok := interpreter.overloadBinaryOp(binop, left, right); ok {
+		return value
+	}
+
 	if reflect.TypeOf(left) != reflect.TypeOf(right) {
 		interpreter.ReportT("Invalid binary operation '%s %s %s'", binop.Left.GetToken(), binop.Left.GetToken().Lexeme, binop.Token.Lexeme, binop.Right.GetToken().Lexeme)
 		return nil
@@ -246,6 +388,14 @@ func (interpreter *Interpreter) visitBinaryOp(binop *ast.BinaryOp) Value {
 		if value, ok := BinopL(binop.GetToken().Kind, left.(*ListVal).Values, right.(*ListVal).Values); ok {
 			return value
 		}
+
+	case *EnumVal:
+		switch binop.GetToken().Kind {
+		case lexer.EQUAL_EQUAL:
+			return &BoolVal{Value: Equality(left, right)}
+		case lexer.NOT_EQUAL:
+			return &BoolVal{Value: !Equality(left, right)}
+		}
 	}
 
 	interpreter.ReportT("Invalid binary operation '%s %s %s'", binop.Left.GetToken(), binop.Left.GetToken().Lexeme, binop.Token.Lexeme, binop.Right.GetToken().Lexeme)
@@ -273,6 +423,10 @@ func (interpreter *Interpreter) visitUnaryOp(unary *ast.UnaryOp) Value {
 }
 
 func (interpreter *Interpreter) visitLogicalOp(logical *ast.LogicalOp) Value {
+	if logical.Token.Kind == lexer.QUESTION_QUESTION {
+		return interpreter.coalesce(logical)
+	}
+
 	left := interpreter.Visit(logical.Left)
 	right := interpreter.Visit(logical.Right)
 
@@ -286,6 +440,17 @@ func (interpreter *Interpreter) visitLogicalOp(logical *ast.LogicalOp) Value {
 	return &BoolVal{Value: left.(*BoolVal).Value || right.(*BoolVal).Value}
 }
 
+// Gives back the left side unless it is unit, only then running the right
+func (interpreter *Interpreter) coalesce(logical *ast.LogicalOp) Value {
+	left := interpreter.Visit(logical.Left)
+
+	if _, ok := left.(*UnitVal); !ok {
+		return left
+	}
+
+	return interpreter.Visit(logical.Right)
+}
+
 func (interpreter *Interpreter) visitBlock(block *ast.Block, newEnv bool) Value {
 	if newEnv {
 		interpreter.push()
@@ -311,7 +476,7 @@ func (interpreter *Interpreter) visitList(lit *ast.ListLiteral) Value {
 		values = append(values, interpreter.Visit(value))
 	}
 
-	return &ListVal{values}
+	return &ListVal{Values: values}
 }
 
 func (interpreter *Interpreter) visitLiteral(lit *ast.Literal) Value {
@@ -342,23 +507,74 @@ func (interpreter *Interpreter) visitIdentifier(id *ast.Identifier) Value {
 
 func (interpreter *Interpreter) visitVarDecl(decl *ast.VariableDecl) Value {
 	value := interpreter.Visit(decl.Expr).Copy()
-	interpreter.insert(decl.GetToken().Lexeme, value)
+
+	if decl.Pattern == nil {
+		interpreter.insert(decl.GetToken().Lexeme, value)
+		return value
+	}
+
+	if _, ok := value.(*ThrowValue); ok {
+		return value
+	}
+
+	for idx, value := range interpreter.destructure(decl.Pattern, value) {
+		interpreter.insert(decl.Pattern.Identifiers()[idx].Lexeme, value)
+	}
+
 	return value
 }
 
+func (interpreter *Interpreter) destructure(pattern *ast.Pattern, value Value) []Value {
+	var values []Value
+	var err error
+
+	switch pattern.Kind {
+	case ast.PATTERN_LIST:
+		values, err = Unpack(value, len(pattern.Names), pattern.Rest != nil)
+	case ast.PATTERN_FIELDS:
+		names := make([]string, 0, len(pattern.Names))
+
+		for _, name := range pattern.Names {
+			interpreter.checkVisible(value, name)
+			names = append(names, name.Lexeme)
+		}
+
+		values, err = Fields(value, names)
+	}
+
+	if err != nil {
+		interpreter.ReportT("%s", pattern.Token, err.Error())
+	}
+
+	return values
+}
+
 func (interpreter *Interpreter) visitPrint(print *ast.Print) Value {
-	var sb strings.Builder
+	return interpreter.preparePrint(print)()
+}
+
+// Evaluates the expressions to print, giving back the print to do with them
+func (interpreter *Interpreter) preparePrint(print *ast.Print) func() Value {
+	values := make([]Value, 0, len(print.Exprs))
 
 	for _, expr := range print.Exprs {
-		sb.WriteString(interpreter.Visit(expr).Inspect())
+		values = append(values, interpreter.Visit(expr))
 	}
 
-	fmt.Println(sb.String())
-	return &UnitVal{}
+	return func() Value {
+		var sb strings.Builder
+
+		for _, value := range values {
+			sb.WriteString(value.Inspect())
+		}
+
+		fmt.Println(sb.String())
+		return &UnitVal{}
+	}
 }
 
 func (interpreter *Interpreter) visitFunctionDef(fndef *ast.FunctionDef, insert bool) Value {
-	def := &FunctionValue{definition: fndef, bound: nil}
+	def := &FunctionValue{definition: fndef, bound: nil, owner: interpreter}
 	if insert {
 		interpreter.insert(fndef.GetToken().Lexeme, def)
 	}
@@ -366,47 +582,160 @@ func (interpreter *Interpreter) visitFunctionDef(fndef *ast.FunctionDef, insert
 }
 
 func (interpreter *Interpreter) visitAnonymousFunction(fndef *ast.AnonymousFunction) Value {
-	return &AnonFunctionValue{definition: fndef}
+	return &AnonFunctionValue{definition: fndef, owner: interpreter, class: interpreter.class}
 }
 
 func (interpreter *Interpreter) visitClassDef(def *ast.ClassDef) Value {
-	classDef := &ClassDefValue{identifier: def.GetToken().Lexeme, constructor: nil, fields: make([]string, 0, len(def.Fields)), methods: make(map[string]Value, len(def.Methods))}
+	classDef := &ClassDefValue{
+		identifier: def.GetToken().Lexeme, constructor: nil, fields: make([]string, 0, len(def.Fields)), methods: make(map[string]Value, len(def.Methods)),
+		statics: make(map[string]Value, len(def.StaticFields)+len(def.StaticMethods)), getters: make(map[string]*FunctionValue, len(def.Getters)), setters: make(map[string]*FunctionValue, len(def.Setters)),
+		private: def.Private,
+	}
 
 	if def.Constructor != nil {
-		classDef.constructor = interpreter.visitFunctionDef(def.Constructor, false).(*FunctionValue)
+		classDef.constructor = interpreter.method(classDef, def.Constructor)
 	}
 
 	for id, val := range def.Methods {
-		classDef.methods[id] = interpreter.visitFunctionDef(val, false).(*FunctionValue)
+		classDef.methods[id] = interpreter.method(classDef, val)
 	}
 
 	for id := range def.Fields {
 		classDef.fields = append(classDef.fields, id)
 	}
 
+	for id, val := range def.Getters {
+		classDef.getters[id] = interpreter.method(classDef, val)
+	}
+
+	for id, val := range def.Setters {
+		classDef.setters[id] = interpreter.method(classDef, val)
+	}
+
+	for id, val := range def.StaticMethods {
+		classDef.statics[id] = interpreter.method(classDef, val)
+	}
+
+	classDef.traits = interpreter.implement("Class", def.GetToken(), def.Traits, classDef.methods)
+
 	interpreter.insert(def.GetToken().Lexeme, classDef)
+
+	// Static fields start once the class exists, so their values can use it
+	for id, field := range def.StaticFields {
+		var value Value = &UnitVal{}
+
+		if field.Expr != nil {
+			value = interpreter.Visit(field.Expr).Copy()
+		}
+
+		classDef.statics[id] = value
+	}
+
 	return classDef
 }
 
+// Creates a function belonging to a class or struct, which can use its private members
+func (interpreter *Interpreter) method(owner Value, def *ast.FunctionDef) *FunctionValue {
+	fn := interpreter.visitFunctionDef(def, false).(*FunctionValue)
+	fn.class = owner
+	return fn
+}
+
 func (interpreter *Interpreter) visitStructDef(def *ast.StructDef) Value {
-	structDef := &StructDefValue{identifier: def.GetToken().Lexeme, constructor: nil, fields: make([]string, 0, len(def.Fields))}
+	structDef := &StructDefValue{identifier: def.GetToken().Lexeme, constructor: nil, fields: make([]string, 0, len(def.Fields)), methods: make(map[string]Value, len(def.Methods)), private: def.Private}
 
 	if def.Constructor != nil {
-		structDef.constructor = interpreter.visitFunctionDef(def.Constructor, false).(*FunctionValue)
+		structDef.constructor = interpreter.method(structDef, def.Constructor)
+	}
+
+	for id, val := range def.Methods {
+		structDef.methods[id] = interpreter.method(structDef, val)
 	}
 
 	for id := range def.Fields {
 		structDef.fields = append(structDef.fields, id)
 	}
 
+	structDef.traits = interpreter.implement("Struct", def.GetToken(), def.Traits, structDef.methods)
+
 	interpreter.insert(def.GetToken().Lexeme, structDef)
 	return structDef
 }
 
+func (interpreter *Interpreter) visitImport(imp *ast.Import) Value {
+	if interpreter.importer == nil {
+		interpreter.ReportT("Cannot import '%s' without a module loader", imp.Token, imp.Token.Lexeme)
+		return nil
+	}
+
+	interpreter.insert(imp.Alias.Lexeme, interpreter.importer.Load(interpreter, imp))
+	return &UnitVal{}
+}
+
+func (interpreter *Interpreter) visitImportExpr(imp *ast.ImportExpr) Value {
+	path, ok := interpreter.Visit(imp.Expr).(*StringVal)
+	if !ok {
+		interpreter.ReportT("Import expected a path to a file, but received '%s'", imp.Token, imp.Expr.GetToken().Lexeme)
+		return nil
+	}
+
+	if interpreter.importer == nil {
+		interpreter.ReportT("Cannot import '%s' without a module loader", imp.Token, path.Value)
+		return nil
+	}
+
+	return interpreter.importer.Import(interpreter, path.Value, imp.Token)
+}
+
+func (interpreter *Interpreter) visitTraitDef(def *ast.TraitDef) Value {
+	trait := newTrait(interpreter, def)
+
+	interpreter.insert(def.GetToken().Lexeme, trait)
+	return trait
+}
+
+// Check each trait is implemented, filling in the default methods left out
+func (interpreter *Interpreter) implement(kind string, token *lexer.Token, nodes []ast.Node, methods map[string]Value) []*TraitValue {
+	traits := make([]*TraitValue, 0, len(nodes))
+
+	for _, node := range nodes {
+		trait, ok := interpreter.Visit(node).(*TraitValue)
+		if !ok {
+			interpreter.ReportT("'%s' is not a trait", node.GetToken(), node.GetToken().Lexeme)
+			return nil
+		}
+
+		if err := trait.apply(methods); err != nil {
+			interpreter.ReportT("%s '%s' %s", token, kind, token.Lexeme, err)
+			return nil
+		}
+
+		traits = append(traits, trait)
+	}
+
+	return traits
+}
+
+func (interpreter *Interpreter) visitEnumDef(def *ast.EnumDef) Value {
+	enum := newEnumDef(def)
+
+	interpreter.insert(def.GetToken().Lexeme, enum)
+	return enum
+}
+
 func (interpreter *Interpreter) visitNamespace(ns *ast.NameSpace) Value {
-	namespace := &NameSpaceValue{Identifier: ns.Token.Lexeme, Members: make(map[string]Value)}
+	namespace := &NameSpaceValue{Identifier: ns.Token.Lexeme, Members: make(map[string]Value), private: ns.Private}
 
 	for _, stmt := range ns.Body.Statements {
+		if decl, ok := stmt.(*ast.VariableDecl); ok && decl.Pattern != nil {
+			interpreter.Visit(stmt)
+
+			for _, identifier := range decl.Pattern.Identifiers() {
+				namespace.Members[identifier.Lexeme] = interpreter.lookup(identifier.Lexeme)
+			}
+			continue
+		}
+
 		namespace.Members[stmt.GetToken().Lexeme] = interpreter.Visit(stmt)
 	}
 
@@ -415,36 +744,84 @@ func (interpreter *Interpreter) visitNamespace(ns *ast.NameSpace) Value {
 }
 
 func (interpreter *Interpreter) visitCall(call *ast.Call) Value {
+	return interpreter.prepareCall(call)()
+}
+
+// Evaluates what is called and its arguments, giving back the call to make
+// with them
+func (interpreter *Interpreter) prepareCall(call *ast.Call) func() Value {
 	caller := interpreter.Visit(call.Callee)
 
+	if _, ok := caller.(*UnitVal); ok && call.Optional {
+		return func() Value { return caller }
+	}
+
 	if _, ok := caller.(TinyCallable); !ok {
 		interpreter.ReportT("'%s' is not callable.", call.GetToken(), caller.Inspect())
 	}
 
 	callable := caller.(TinyCallable)
 
-	if callable.Arity() != len(call.Arguments) {
-		interpreter.ReportT(
-			"Function '%s' expected %d arguments but received %d",
-			call.Token,
-			call.Token.Lexeme,
-			callable.Arity(),
-			len(call.Arguments),
-		)
+	positional := make([]Value, 0, len(call.Arguments))
+	names, named := make([]string, 0), make([]Value, 0)
+
+	for _, arg := range call.Arguments {
+		if argument, ok := arg.(*ast.Argument); ok {
+			names = append(names, argument.Token.Lexeme)
+			named = append(named, interpreter.Visit(argument.Expr).Copy())
+			continue
+		}
+
+		positional = append(positional, interpreter.Visit(arg).Copy())
 	}
 
-	arguments := make([]Value, 0, len(call.Arguments))
+	// Check the arguments here, so the error points at the call
+	arguments, err := Arrange(callable.Parameters(), positional, names, named)
+	if err == nil {
+		_, err = Bind(callable.Parameters(), arguments)
+	}
 
-	for _, arg := range call.Arguments {
-		arguments = append(arguments, interpreter.Visit(arg).Copy())
+	if err != nil {
+		interpreter.ReportT("Function '%s' %s", call.Token, call.Token.Lexeme, err)
+	}
+
+	return func() Value { return callable.Call(interpreter, arguments) }
+}
+
+// Insert the arguments of a call into the function's scope. Defaults for the
+// ones left out are evaluated there too, so they can use earlier parameters.
+func (interpreter *Interpreter) bindParams(identifier string, params []*ast.Parameter, values []Value) {
+	bound, err := Bind(scriptParams(params), values)
+	if err != nil {
+		interpreter.Report("Function '%s' %s", identifier, err)
 	}
 
-	return callable.Call(interpreter, arguments)
+	for idx, param := range params {
+		value := bound[idx]
+
+		if value == nil {
+			value = interpreter.Visit(param.Default).Copy()
+		}
+
+		interpreter.insert(param.Token.Lexeme, value)
+	}
 }
 
 func (interpreter *Interpreter) visitAssign(assign *ast.Assign) Value {
 	value := interpreter.Visit(assign.Expr).Copy()
-	interpreter.set(assign.GetToken().Lexeme, assign.Operator.Kind, value)
+
+	if assign.Pattern == nil {
+		interpreter.set(assign.GetToken().Lexeme, assign.Operator.Kind, value)
+		return value
+	}
+
+	if _, ok := value.(*ThrowValue); ok {
+		return value
+	}
+
+	for idx, value := range interpreter.destructure(assign.Pattern, value) {
+		interpreter.set(assign.Pattern.Identifiers()[idx].Lexeme, assign.Operator.Kind, value)
+	}
 
 	return value
 }
@@ -468,14 +845,36 @@ func (interpreter *Interpreter) visitThrow(throw *ast.Throw) Value {
 	return &ThrowValue{inner: innerValue.Copy()}
 }
 
+func (interpreter *Interpreter) visitYield(yield *ast.Yield) Value {
+	value := interpreter.Visit(yield.Expr)
+	if _, ok := value.(*ThrowValue); ok {
+		return value
+	}
+
+	if interpreter.generator == nil {
+		interpreter.ReportT("Cannot yield outside of a generator", yield.Token)
+	}
+
+	interpreter.generator.yield(value)
+	return &UnitVal{}
+}
+
 func (interpreter *Interpreter) visitGet(get *ast.Get) Value {
 	value := interpreter.Visit(get.Expr)
 
+	if _, ok := value.(*UnitVal); ok && get.Optional {
+		return value
+	}
+
+	interpreter.checkVisible(value, get.GetToken())
+
 	switch inner := value.(type) {
 	case *ClassInstanceValue:
 		if ret, ok := inner.Get(get.GetToken().Lexeme); ok {
 			return ret.Copy()
 		}
+
+		interpreter.checkNotStatic(inner, get.GetToken())
 	case *StructInstanceValue:
 		if ret, ok := inner.Get(get.GetToken().Lexeme); ok {
 			return ret.Copy()
@@ -484,21 +883,103 @@ func (interpreter *Interpreter) visitGet(get *ast.Get) Value {
 		if ret, ok := inner.Get(get.GetToken().Lexeme); ok {
 			return ret.Copy()
 		}
+	case *ClassDefValue:
+		if ret, ok := inner.Get(get.GetToken().Lexeme); ok {
+			return ret.Copy()
+		}
+
+		interpreter.ReportT("Class '%s' has no static member '%s'", get.GetToken(), inner.identifier, get.GetToken().Lexeme)
+	case *EnumDefValue:
+		if ret, ok := inner.Get(get.GetToken().Lexeme); ok {
+			return ret
+		}
+
+		interpreter.ReportT("Enum '%s' has no variant '%s'", get.GetToken(), inner.identifier, get.GetToken().Lexeme)
+	case *EnumVal:
+		if ret, ok := inner.Get(get.GetToken().Lexeme); ok {
+			return ret.Copy()
+		}
+
+		interpreter.ReportT("Variant '%s' has no field '%s'", get.GetToken(), inner.Inspect(), get.GetToken().Lexeme)
+	case *UnitVal:
+		interpreter.ReportT("Cannot get '%s' from unit, use '?.' to give back unit instead", get.GetToken(), get.GetToken().Lexeme)
 	}
 
 	interpreter.ReportT("Cannot use getter on non-instance values '%s':%s", get.Expr.GetToken(), get.Expr.GetToken().Lexeme, reflect.TypeOf(value))
 	return nil
 }
 
+// Static members belong to the class declaring them, so are never reached
+// through an instance
+func (interpreter *Interpreter) checkNotStatic(instance *ClassInstanceValue, member *lexer.Token) {
+	def, ok := instance.Def.(*ClassDefValue)
+	if !ok {
+		return
+	}
+
+	for ; def != nil; def = def.base {
+		if _, ok := def.statics[member.Lexeme]; ok {
+			interpreter.ReportT("Static member '%s' must be accessed through the class '%s'", member, member.Lexeme, def.identifier)
+		}
+	}
+}
+
+// Private members can only be used by the functions of their class or
+// struct. Namespaces use them by name, so they are never reached through it.
+func (interpreter *Interpreter) checkVisible(value Value, member *lexer.Token) {
+	var kind, owner string
+
+	switch t := value.(type) {
+	case *ClassInstanceValue:
+		if def, ok := t.Def.(*ClassDefValue); ok && def.private[member.Lexeme] && interpreter.class != def {
+			kind, owner = "class", def.identifier
+		}
+	case *ClassDefValue:
+		if t.private[member.Lexeme] && interpreter.class != t {
+			kind, owner = "class", t.identifier
+		}
+	case *StructInstanceValue:
+		if t.def.private[member.Lexeme] && interpreter.class != t.def {
+			kind, owner = "struct", t.def.identifier
+		}
+	case *NameSpaceValue:
+		if t.private[member.Lexeme] {
+			kind, owner = "namespace", t.Identifier
+		}
+	}
+
+	if len(owner) > 0 {
+		interpreter.ReportT("'%s' is private to %s '%s'", member, member.Lexeme, kind, owner)
+	}
+}
+
 func (interpreter *Interpreter) visitSet(set *ast.Set) Value {
 	caller := interpreter.Visit(set.Caller)
 	obj := interpreter.Visit(set.Expr)
 
+	interpreter.checkVisible(caller, set.GetToken())
+
+	if IsFrozen(caller) {
+		return FrozenError(caller)
+	}
+
 	switch t := caller.(type) {
 	case *ClassInstanceValue:
 		if ret, ok := t.Set(set.GetToken().Lexeme, obj); ok {
 			return ret.Copy()
 		}
+
+		if t.readOnly(set.GetToken().Lexeme) {
+			interpreter.ReportT("Property '%s' of '%s' has a getter but no setter", set.GetToken(), set.GetToken().Lexeme, t.Definition())
+		}
+
+		interpreter.checkNotStatic(t, set.GetToken())
+	case *ClassDefValue:
+		if ret, ok := t.Set(set.GetToken().Lexeme, obj); ok {
+			return ret.Copy()
+		}
+
+		interpreter.ReportT("Class '%s' has no static field '%s'", set.GetToken(), t.identifier, set.GetToken().Lexeme)
 	case *StructInstanceValue:
 		if ret, ok := t.Set(set.GetToken().Lexeme, obj); ok {
 			return ret.Copy()
@@ -515,65 +996,136 @@ func (interpreter *Interpreter) visitSet(set *ast.Set) Value {
 
 func (interpreter *Interpreter) visitIndex(index *ast.Index) Value {
 	caller := interpreter.Visit(index.Caller)
+
+	// The index is left alone, like the arguments of an optional call
+	if _, ok := caller.(*UnitVal); ok && index.Optional {
+		return caller
+	}
+
 	indexer := interpreter.Visit(index.Expr)
 
-	if _, ok := indexer.(*IntVal); !ok {
-		interpreter.ReportT("Index must use an integer value but received '%d'", index.GetToken(), indexer.Inspect())
+	if value, ok := Overload(caller, "__index__", indexer); ok {
+		return value
 	}
 
-	indexer_int := indexer.(*IntVal).Value
+	if rng, ok := indexer.(*RangeVal); ok {
+		return interpreter.slice(index, caller, rng)
+	}
+
+	if _, ok := indexer.(*IntVal); !ok {
+		interpreter.ReportT("Index must use an integer or range but received '%s'", index.GetToken(), indexer.Inspect())
+	}
 
 	switch t := caller.(type) {
 	case *ListVal:
-		if indexer_int < 0 || indexer_int >= len(t.Values) {
-			interpreter.ReportT("Index %d is out of list range 0-%d", index.GetToken(), indexer_int, len(t.Values)-1)
+		idx, err := position(indexer.(*IntVal).Value, len(t.Values))
+		if err != nil {
+			return NewThrow(&StringVal{Value: err.Error()})
 		}
-		return t.Values[indexer_int]
+		return t.Values[idx]
 	case *StringVal:
-		if indexer_int < 0 || indexer_int >= len(t.Value) {
-			interpreter.ReportT("Index %d is out of string range 0-%d", index.GetToken(), indexer_int, len(t.Value)-1)
+		// Strings are indexed by character, not byte
+		runes := []rune(t.Value)
+		idx, err := position(indexer.(*IntVal).Value, len(runes))
+		if err != nil {
+			return NewThrow(&StringVal{Value: err.Error()})
 		}
 
 		// FIXME: Replace with char type
-		return &StringVal{Value: string(t.Value[indexer_int])}
+		return &StringVal{Value: string(runes[idx])}
 	}
 
 	interpreter.ReportT("Cannot use index on '%s':'%s'", index.Caller.GetToken(), index.Caller.GetToken().Lexeme, reflect.TypeOf(caller))
 	return nil
 }
 
+// Slices are copies, so changing them leaves the original alone
+func (interpreter *Interpreter) slice(index *ast.Index, caller Value, rng *RangeVal) Value {
+	switch t := caller.(type) {
+	case *ListVal:
+		start, end, err := rng.bounds(len(t.Values))
+		if err != nil {
+			return NewThrow(&StringVal{Value: err.Error()})
+		}
+		return &ListVal{Values: append([]Value{}, t.Values[start:end]...)}
+	case *StringVal:
+		runes := []rune(t.Value)
+		start, end, err := rng.bounds(len(runes))
+		if err != nil {
+			return NewThrow(&StringVal{Value: err.Error()})
+		}
+		return &StringVal{Value: string(runes[start:end])}
+	}
+
+	interpreter.ReportT("Cannot slice '%s':'%s'", index.Caller.GetToken(), index.Caller.GetToken().Lexeme, reflect.TypeOf(caller))
+	return nil
+}
+
 func (interpreter *Interpreter) visitIndexSet(iset *ast.IndexSet) Value {
 	caller := interpreter.Visit(iset.Idx.Caller)
 	index := interpreter.Visit(iset.Idx.Expr)
 	value := interpreter.Visit(iset.Expr)
 
+	if _, ok := index.(*IntVal); !ok {
+		interpreter.ReportT("Index must use an integer but received '%s'", iset.GetToken(), index.Inspect())
+	}
+
 	indexer_int := index.(*IntVal).Value
 
 	switch t := caller.(type) {
 	case *ListVal:
-		if indexer_int < 0 || indexer_int >= len(t.Values) {
-			interpreter.ReportT("Index %d is out of list range 0-%d", iset.GetToken(), indexer_int, len(t.Values)-1)
+		if t.frozen {
+			return FrozenError(t)
 		}
-		if ret, ok := t.Set(iset.Token.Kind, indexer_int, value); ok {
+
+		idx, err := position(indexer_int, len(t.Values))
+		if err != nil {
+			return NewThrow(&StringVal{Value: err.Error()})
+		}
+		if ret, ok := t.Set(iset.Token.Kind, idx, value); ok {
 			return ret
 		}
 	case *StringVal:
-		if indexer_int < 0 || indexer_int >= len(t.Value) {
-			interpreter.ReportT("Index %d is out of string range 0-%d", iset.GetToken(), indexer_int, len(t.Value)-1)
+		new_str := []rune(t.Value)
+		idx, err := position(indexer_int, len(new_str))
+		if err != nil {
+			return NewThrow(&StringVal{Value: err.Error()})
 		}
 
 		// FIXME: Make this better and only allow chars
-		new_str := []byte(t.Value)
-		new_str[indexer_int] = byte(value.Inspect()[0])
+		new_str[idx] = []rune(value.Inspect())[0]
 		t.Value = string(new_str)
 
 		return t
 	}
 
-	interpreter.ReportT("Cannot use index on '%s':'%s'", iset.GetToken(), iset.Idx.Caller.GetToken().Lexeme, reflect.TypeOf(caller), iset.Idx.Caller.GetToken().Line, iset.Idx.Caller.GetToken().Column)
+	interpreter.ReportT("Cannot use index on '%s':'%s'", iset.GetToken(), iset.Idx.Caller.GetToken().Lexeme, reflect.TypeOf(caller))
 	return nil
 }
 
+func (interpreter *Interpreter) visitRange(expr *ast.Range) Value {
+	parts := make([]Value, 3)
+
+	for idx, node := range []ast.Node{expr.Start, expr.End, expr.Step} {
+		if node == nil {
+			continue
+		}
+
+		parts[idx] = interpreter.Visit(node)
+
+		if _, ok := parts[idx].(*ThrowValue); ok {
+			return parts[idx]
+		}
+	}
+
+	value, err := NewRange(parts[0], parts[1], parts[2], expr.Inclusive)
+	if err != nil {
+		interpreter.ReportT("%s", expr.GetToken(), err)
+	}
+
+	return value
+}
+
 func (interpreter *Interpreter) visitIfStmt(stmt *ast.If) Value {
 	interpreter.push()
 	defer interpreter.pop()
@@ -607,14 +1159,8 @@ func (interpreter *Interpreter) visitWhileStmt(stmt *ast.While) Value {
 	checkBoolOperand(interpreter, stmt.Condition.GetToken(), condition)
 
 	for condition.(*BoolVal).Value {
-		if throw, ok := interpreter.visitBlock(stmt.Body, false).(*ReturnValue); ok {
-			if loop, ok := throw.inner.(*LoopFlow); ok {
-				if loop.exit {
-					break
-				}
-			} else {
-				return throw
-			}
+		if stop, value := loopResult(interpreter.visitBlock(stmt.Body, false)); stop {
+			return value
 		}
 
 		if stmt.Increment != nil {
@@ -627,6 +1173,68 @@ func (interpreter *Interpreter) visitWhileStmt(stmt *ast.While) Value {
 	return &UnitVal{}
 }
 
+func (interpreter *Interpreter) visitFor(stmt *ast.For) Value {
+	iterable := interpreter.Visit(stmt.Iterable)
+	if _, ok := iterable.(*ThrowValue); ok {
+		return iterable
+	}
+
+	iterator, err := Iterate(iterable)
+	if err != nil {
+		interpreter.ReportT("%s", stmt.Iterable.GetToken(), err)
+	}
+	defer iterator.Stop()
+
+	for {
+		index, item, ok, err := iterator.Next()
+		if err != nil {
+			interpreter.ReportT("%s", stmt.Iterable.GetToken(), err)
+		}
+
+		if !ok {
+			break
+		}
+
+		if _, ok := item.(*ThrowValue); ok {
+			return item
+		}
+
+		interpreter.push()
+
+		if stmt.Index != nil {
+			interpreter.insert(stmt.Index.Lexeme, &IntVal{Value: index})
+		}
+		interpreter.insert(stmt.Item.Lexeme, item)
+
+		stop, value := loopResult(interpreter.visitBlock(stmt.Body, false))
+
+		interpreter.pop()
+
+		if stop {
+			return value
+		}
+	}
+
+	return &UnitVal{}
+}
+
+// Whether a loop stops after running its body, and the value it gives back.
+// Breaking stops the loop, continuing does not, and anything else returned or
+// thrown is passed on.
+func loopResult(value Value) (bool, Value) {
+	switch result := value.(type) {
+	case *ReturnValue:
+		return true, result
+	case *ThrowValue:
+		if loop, ok := result.inner.(*LoopFlow); ok {
+			return loop.exit, &UnitVal{}
+		}
+		return true, result
+	}
+
+	return false, nil
+}
+
 func (interpreter *Interpreter) visitCatch(catch *ast.Catch) Value {
 	interpreter.push()
 	defer interpreter.pop()
@@ -642,26 +1250,130 @@ func (interpreter *Interpreter) visitCatch(catch *ast.Catch) Value {
 		interpreter.pop()
 	}
 
+	// Throwing from the finally block replaces whatever the catch gave back
+	if catch.Finally != nil {
+		if thrown, ok := interpreter.visitBlock(catch.Finally, true).(*ThrowValue); ok {
+			value = thrown
+		}
+	}
+
 	return value
 }
 
-func (interpreter *Interpreter) visitTest(test *ast.Test) Value {
-	enclosing := interpreter.in_test
-	interpreter.in_test = true
+func (interpreter *Interpreter) visitDefer(stmt *ast.Defer) Value {
+	if len(interpreter.defers) == 0 {
+		interpreter.ReportT("Cannot defer outside of a function", stmt.Token)
+	}
+
+	later := deferred{body: stmt.Body, env: interpreter.env.snapshot()}
+
+	switch body := stmt.Body.(type) {
+	case *ast.Call:
+		later.run = interpreter.prepareCall(body)
+	case *ast.Print:
+		later.run = interpreter.preparePrint(body)
+	}
+
+	frame := &interpreter.defers[len(interpreter.defers)-1]
+	*frame = append(*frame, later)
+
+	return &UnitVal{}
+}
+
+// Starts collecting the statements deferred by a function call
+func (interpreter *Interpreter) enter() {
+	interpreter.defers = append(interpreter.defers, nil)
+}
+
+// Runs the statements deferred by the current function call, last first. A
+// value thrown by one replaces the result of the function.
+func (interpreter *Interpreter) exit(result Value) Value {
+	frame := interpreter.defers[len(interpreter.defers)-1]
+	interpreter.defers = interpreter.defers[:len(interpreter.defers)-1]
+
+	for idx := len(frame) - 1; idx >= 0; idx-- {
+		if thrown, ok := interpreter.runDeferred(frame[idx]).(*ThrowValue); ok {
+			result = thrown
+		}
+	}
+
+	return result
+}
+
+// Runs what the calls above frames deferred when a runtime error unwinds
+// through them, then lets the error carry on. It must be deferred itself.
+func (interpreter *Interpreter) unwind(frames int) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	if _, ok := r.(*RuntimeError); ok {
+		for len(interpreter.defers) > frames {
+			interpreter.exit(nil)
+		}
+	}
+
+	panic(r)
+}
+
+func (interpreter *Interpreter) runDeferred(stmt deferred) Value {
+	if stmt.run != nil {
+		return stmt.run()
+	}
+
+	env := interpreter.env
+	interpreter.env = stmt.env
+	defer func() { interpreter.env = env }()
 
+	return interpreter.Visit(stmt.body)
+}
+
+func (interpreter *Interpreter) visitTest(test *ast.Test) Value {
 	interpreter.tests.tests += 1
 
-	switch value := interpreter.visitBlock(test.Body, true).(type) {
-	case *ThrowValue:
-		interpreter.ReportTest(fmt.Sprintf("'%s' failed with '%s'", test.Token.Lexeme, value.Inspect()), test.GetToken())
-	default:
+	if failure := interpreter.RunTest(test); len(failure) > 0 {
+		interpreter.ReportTest(failure, test.GetToken())
+	} else {
 		interpreter.tests.passed += 1
 	}
 
-	interpreter.in_test = enclosing
 	return &UnitVal{}
 }
 
+// RunTest runs the body of a test, returning why it failed or an empty string
+// when it passed. Runtime errors and exits only fail this test.
+func (interpreter *Interpreter) RunTest(test *ast.Test) (failure string) {
+	depth := interpreter.env.depth
+	frames := len(interpreter.defers)
+
+	defer func() {
+		if r := recover(); r != nil {
+			switch err := r.(type) {
+			case *RuntimeError:
+				failure = fmt.Sprintf("'%s' failed: %s", test.Token.Lexeme, err.Diagnostic.Message)
+			case *ExitRequest:
+				failure = fmt.Sprintf("'%s' failed: exited with code %d", test.Token.Lexeme, err.Code)
+			default:
+				panic(r)
+			}
+
+			interpreter.env.depth = depth
+			interpreter.env.variables = interpreter.env.variables[:depth]
+			interpreter.defers = interpreter.defers[:frames]
+		}
+	}()
+	defer interpreter.unwind(frames)
+
+	interpreter.enter()
+
+	if value, ok := interpreter.exit(interpreter.visitBlock(test.Body, true)).(*ThrowValue); ok {
+		return fmt.Sprintf("'%s' failed with '%s'", test.Token.Lexeme, value.Inspect())
+	}
+
+	return ""
+}
+
 func (interpreter *Interpreter) visitLoopBreak() Value {
 	return &ThrowValue{&LoopFlow{true}}
 }
@@ -670,12 +1382,49 @@ func (interpreter *Interpreter) visitLoopContinue() Value {
 	return &ThrowValue{&LoopFlow{false}}
 }
 
+// Run a match arm for a variant, with its payload bound to the names given
+func (interpreter *Interpreter) visitVariantCase(arm *ast.Case, variant *EnumVariantValue, payload []Value) Value {
+	if arm.Bindings == nil {
+		return interpreter.Visit(arm.Body)
+	}
+
+	if len(arm.Bindings) != len(payload) {
+		interpreter.ReportT("Variant '%s.%s' has %d field(s) but %d name(s) were given", arm.Token, variant.enum.identifier, variant.identifier, len(payload), len(arm.Bindings))
+	}
+
+	interpreter.push()
+	defer interpreter.pop()
+
+	for idx, binding := range arm.Bindings {
+		interpreter.insert(binding.Lexeme, payload[idx])
+	}
+
+	return interpreter.Visit(arm.Body)
+}
+
 func (interpreter *Interpreter) visitMatchCase(match *ast.Match) Value {
 	value := interpreter.Visit(match.Expr)
 
 	for _, expr := range match.Cases {
 		caseExpr := interpreter.Visit(expr.Expr)
 
+		// Variants with a payload match every value built from them
+		if variant, ok := caseExpr.(*EnumVariantValue); ok {
+			enum, ok := value.(*EnumVal)
+			if !ok {
+				continue
+			}
+
+			if payload, ok := enum.payload(variant); ok {
+				return interpreter.visitVariantCase(expr, variant, payload)
+			}
+			continue
+		}
+
+		if expr.Bindings != nil {
+			interpreter.ReportT("'%s' is not a variant with a payload, so it cannot be destructured", expr.Token, caseExpr.Inspect())
+		}
+
 		if Equality(value, caseExpr) {
 			return interpreter.Visit(expr.Body)
 		}
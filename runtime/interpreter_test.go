@@ -0,0 +1,115 @@
+package runtime
+
+import (
+	"io"
+	"os"
+	goruntime "runtime"
+	"testing"
+	"time"
+	"tiny/ast"
+	"tiny/parser"
+	"tiny/shared"
+)
+
+func parse(t *testing.T, path string) *ast.Program {
+	program, diagnostics := parser.New(shared.ReadFile(path), path, false).Parse()
+	if len(diagnostics) > 0 {
+		t.Fatalf("Could not parse '%s': %s", path, diagnostics[0].String())
+	}
+
+	return program
+}
+
+// Run a script, giving back what it printed and the runtime error which
+// stopped it
+func execute(t *testing.T, path string) (string, *RuntimeError) {
+	program := parse(t, path)
+
+	read, write, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := make(chan string)
+	go func() {
+		printed, _ := io.ReadAll(read)
+		output <- string(printed)
+	}()
+
+	stdout := os.Stdout
+	os.Stdout = write
+	_, runtimeErr := New().Execute(program)
+	os.Stdout = stdout
+	write.Close()
+
+	return <-output, runtimeErr
+}
+
+func TestDeferEvaluatesArguments(t *testing.T) {
+	printed, err := execute(t, "../tests/valid/runtime/defer_loop.tiny")
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err.Diagnostic.Message)
+	}
+
+	if printed != "2\n1\n0\n" {
+		t.Fatalf("Expected deferred prints '2 1 0' but received '%q'", printed)
+	}
+}
+
+func TestDeferRunsOnRuntimeError(t *testing.T) {
+	printed, err := execute(t, "../tests/invalid/runtime/defer_unwind.tiny")
+	if err == nil {
+		t.Fatal("Expected a runtime error")
+	}
+
+	if printed != "inner\nouter\n" {
+		t.Fatalf("Expected each function's defers to run as the error unwinds, but received '%q'", printed)
+	}
+}
+
+func TestGeneratorUnusedNotStarted(t *testing.T) {
+	before := goruntime.NumGoroutine()
+
+	if _, err := execute(t, "../tests/valid/generators/unused.tiny"); err != nil {
+		t.Fatalf("Unexpected error '%s'", err.Diagnostic.Message)
+	}
+
+	if after := goruntime.NumGoroutine(); after > before {
+		t.Fatalf("Expected unused generators not to start, but %d goroutine(s) were left running", after-before)
+	}
+}
+
+// Takes the first item from a generator the script gives back, then drops it
+func partlyConsume(t *testing.T, path string) {
+	result, err := New().Execute(parse(t, path))
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err.Diagnostic.Message)
+	}
+
+	iterator, ok := result.(*IteratorValue)
+	if !ok {
+		t.Fatalf("Expected a generator but received '%s'", result.Inspect())
+	}
+
+	if _, item, ok, _ := iterator.Next(); !ok || item.Inspect() != "1" {
+		t.Fatalf("Expected the first item to be 1")
+	}
+}
+
+func TestGeneratorDroppedPartWay(t *testing.T) {
+	before := goruntime.NumGoroutine()
+	partlyConsume(t, "../tests/valid/runtime/generator_dropped.tiny")
+
+	// Finalizers run some time after a collection, so give them a moment
+	for attempt := 0; attempt < 100; attempt++ {
+		goruntime.GC()
+
+		if goruntime.NumGoroutine() <= before {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("Expected a dropped generator to end, but %d goroutine(s) were left running", goruntime.NumGoroutine()-before)
+}
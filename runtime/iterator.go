@@ -0,0 +1,154 @@
+package runtime
+
+import (
+	"fmt"
+	"tiny/lexer"
+)
+
+// IteratorValue steps through what a for loop runs over, counting the items
+// as it goes
+type IteratorValue struct {
+	index int
+	next  func() (Value, bool, error)
+	// Called when a loop is left before the iterator finishes
+	stop func()
+	// The function a generator was made by
+	name string
+}
+
+// NewIterator wraps a function giving back each item in turn, and false
+// once there are none left. Named iterators are shown as generators.
+func NewIterator(name string, next func() (Value, bool, error)) *IteratorValue {
+	return &IteratorValue{name: name, next: next}
+}
+
+// Iterate gives back an iterator over a list, string, range or instance
+// following the iterator protocol. Instances either have 'next()' and 'done()'
+// methods, or an 'iter()' method giving back something which does. The
+// language has no dictionary type, so there is nothing to iterate there.
+func Iterate(value Value) (*IteratorValue, error) {
+	switch iterable := value.(type) {
+	case *ListVal:
+		return &IteratorValue{next: listIterator(iterable.Values)}, nil
+
+	case *StringVal:
+		values := make([]Value, 0, len(iterable.Value))
+
+		// Matches indexing, which gives back a string of each character
+		for _, r := range iterable.Value {
+			values = append(values, &StringVal{Value: string(r)})
+		}
+
+		return &IteratorValue{next: listIterator(values)}, nil
+
+	case *RangeVal:
+		return &IteratorValue{next: iterable.iterator()}, nil
+
+	case *IteratorValue:
+		return iterable, nil
+	}
+
+	if _, ok := method(value, "iter"); ok {
+		return &IteratorValue{next: objectIterator(value)}, nil
+	}
+
+	if iterates(value) {
+		return &IteratorValue{next: objectIterator(value)}, nil
+	}
+
+	return nil, fmt.Errorf("Cannot iterate over '%s', it must be a list, string, range or have 'iter()' or 'next()' and 'done()' methods", value.Inspect())
+}
+
+// Next gives back the position and value of the next item, or false once there
+// are none left. Values thrown by an iterator's methods are given back as the
+// item, so they can be passed on.
+func (iterator *IteratorValue) Next() (int, Value, bool, error) {
+	value, ok, err := iterator.next()
+	if !ok || err != nil {
+		return 0, nil, false, err
+	}
+
+	index := iterator.index
+	iterator.index++
+
+	return index, value, true, nil
+}
+
+// Stop lets go of anything the iterator holds when it will not be used again
+func (iterator *IteratorValue) Stop() {
+	if iterator.stop != nil {
+		iterator.stop()
+	}
+}
+
+func (v *IteratorValue) GetType() Type { return &IteratorType{} }
+func (v *IteratorValue) Inspect() string {
+	if len(v.name) > 0 {
+		return fmt.Sprintf("<generator %s>", v.name)
+	}
+
+	return "<iterator>"
+}
+func (v *IteratorValue) Copy() Value                                        { return v }
+func (v *IteratorValue) Modify(operation lexer.TokenKind, other Value) bool { return false }
+
+// --- Private ---
+
+func listIterator(values []Value) func() (Value, bool, error) {
+	idx := 0
+
+	return func() (Value, bool, error) {
+		if idx >= len(values) {
+			return nil, false, nil
+		}
+
+		idx++
+		return values[idx-1], true, nil
+	}
+}
+
+func iterates(value Value) bool {
+	_, next := method(value, "next")
+	_, done := method(value, "done")
+	return next && done
+}
+
+// The iterator is only asked for on the first step, so anything it throws is
+// passed on like any other item
+func objectIterator(object Value) func() (Value, bool, error) {
+	var iterator Value = nil
+
+	return func() (Value, bool, error) {
+		if iterator == nil {
+			iterator = object
+
+			if result, ok := Overload(object, "iter"); ok {
+				if _, ok := result.(*ThrowValue); ok {
+					return result, true, nil
+				}
+
+				iterator = result
+			}
+
+			if !iterates(iterator) {
+				return nil, false, fmt.Errorf("Iterator '%s' must have 'next()' and 'done()' methods", iterator.Inspect())
+			}
+		}
+
+		done, _ := Overload(iterator, "done")
+
+		switch value := done.(type) {
+		case *ThrowValue:
+			return value, true, nil
+		case *BoolVal:
+			if value.Value {
+				return nil, false, nil
+			}
+		default:
+			return nil, false, fmt.Errorf("Iterator method 'done()' must return a bool, but returned '%s'", done.Inspect())
+		}
+
+		value, _ := Overload(iterator, "next")
+		return value, true, nil
+	}
+}
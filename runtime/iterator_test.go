@@ -0,0 +1,27 @@
+package runtime
+
+import "testing"
+
+func TestIterateStringByCharacter(t *testing.T) {
+	iterator, err := Iterate(&StringVal{Value: "hé→"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"h", "é", "→"}
+
+	for idx, want := range expected {
+		index, item, ok, err := iterator.Next()
+		if err != nil || !ok {
+			t.Fatalf("Expected item %d, but the iterator ended (%v)", idx, err)
+		}
+
+		if index != idx || item.Inspect() != want {
+			t.Fatalf("Expected '%s' at %d but received '%s' at %d", want, idx, item.Inspect(), index)
+		}
+	}
+
+	if _, _, ok, _ := iterator.Next(); ok {
+		t.Fatal("Expected the iterator to end after the last character")
+	}
+}
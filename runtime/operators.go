@@ -0,0 +1,109 @@
+package runtime
+
+import (
+	"tiny/ast"
+	"tiny/lexer"
+)
+
+// Special methods an operator calls on the left operand
+var operatorMethods = map[lexer.TokenKind]string{
+	lexer.PLUS:        "__add__",
+	lexer.MINUS:       "__sub__",
+	lexer.STAR:        "__mul__",
+	lexer.SLASH:       "__div__",
+	lexer.EQUAL_EQUAL: "__eq__",
+	lexer.LESS:        "__lt__",
+}
+
+// Overload calls a special method, such as '__add__', on a class or struct
+// instance which defines it. Methods run in the interpreter they were defined
+// in, so this also works where no interpreter is at hand, like Inspect.
+func Overload(value Value, name string, args ...Value) (Value, bool) {
+	fn, ok := method(value, name)
+	if !ok {
+		return nil, false
+	}
+
+	fn.bound = value
+	return fn.Call(fn.owner, args), true
+}
+
+// A method defined by the class or struct of an instance, ignoring its fields
+func method(value Value, name string) (*FunctionValue, bool) {
+	var methods map[string]Value
+
+	switch instance := value.(type) {
+	case *ClassInstanceValue:
+		if def, ok := instance.Def.(*ClassDefValue); ok {
+			methods = def.methods
+		}
+	case *StructInstanceValue:
+		methods = instance.def.methods
+	}
+
+	fn, ok := methods[name].(*FunctionValue)
+	return fn, ok
+}
+
+// Operators without a method of their own are built from '__eq__' and '__lt__'
+func (interpreter *Interpreter) overloadBinaryOp(binop *ast.BinaryOp, left Value, right Value) (Value, bool) {
+	switch binop.Token.Kind {
+	case lexer.NOT_EQUAL:
+		return interpreter.negate(binop, "__eq__", left, right)
+	case lexer.GREATER:
+		return Overload(right, "__lt__", left)
+	case lexer.LESS_EQUAL:
+		return interpreter.negate(binop, "__lt__", right, left)
+	case lexer.GREATER_EQUAL:
+		return interpreter.negate(binop, "__lt__", left, right)
+	}
+
+	name, ok := operatorMethods[binop.Token.Kind]
+	if !ok {
+		return nil, false
+	}
+
+	return Overload(left, name, right)
+}
+
+func (interpreter *Interpreter) negate(binop *ast.BinaryOp, name string, receiver Value, other Value) (Value, bool) {
+	result, ok := Overload(receiver, name, other)
+	if !ok {
+		return nil, false
+	}
+
+	switch value := result.(type) {
+	case *ThrowValue:
+		return value, true
+	case *BoolVal:
+		return &BoolVal{Value: !value.Value}, true
+	}
+
+	interpreter.ReportT("Special method '%s' must return a bool to use '%s', but returned '%s'", binop.GetToken(), name, binop.Token.Lexeme, result.Inspect())
+	return nil, false
+}
+
+// Whether '__eq__' considers two values equal, when the left defines it
+func overloadEquality(left Value, right Value) (bool, bool) {
+	result, ok := Overload(left, "__eq__", right)
+	if !ok {
+		return false, false
+	}
+
+	value, ok := result.(*BoolVal)
+	return ok && value.Value, true
+}
+
+// What '__str__' gives back, when the value defines it
+func overloadInspect(value Value) (string, bool) {
+	result, ok := Overload(value, "__str__")
+	if !ok {
+		return "", false
+	}
+
+	if str, ok := result.(*StringVal); ok {
+		return str.Value, true
+	}
+
+	return "", false
+}
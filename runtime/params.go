@@ -0,0 +1,142 @@
+package runtime
+
+import (
+	"fmt"
+	"tiny/ast"
+	"tiny/shared"
+)
+
+// Param describes what a callable accepts in one position
+type Param struct {
+	Name string
+	// Can be left out, leaving it to a default value
+	Optional bool
+	// Collects the remaining arguments into a list
+	Variadic bool
+}
+
+func scriptParams(params []*ast.Parameter) []Param {
+	converted := make([]Param, 0, len(params))
+
+	for _, param := range params {
+		converted = append(converted, Param{Name: param.Token.Lexeme, Optional: param.Default != nil || param.Variadic, Variadic: param.Variadic})
+	}
+
+	return converted
+}
+
+func nativeParams(specs []string) []Param {
+	converted := make([]Param, 0, len(specs))
+
+	for _, spec := range specs {
+		name, optional, variadic := shared.ParseParam(spec)
+		converted = append(converted, Param{Name: name, Optional: optional, Variadic: variadic})
+	}
+
+	return converted
+}
+
+// Count the parameters which must always be given
+func required(params []Param) int {
+	count := 0
+
+	for _, param := range params {
+		if !param.Optional {
+			count++
+		}
+	}
+
+	return count
+}
+
+// Describe how many arguments a callable accepts, like "1 to 3 arguments"
+func expects(params []Param) string {
+	least, most := required(params), len(params)
+
+	if most > 0 && params[most-1].Variadic {
+		return fmt.Sprintf("at least %d arguments", least)
+	}
+
+	if least == most {
+		return fmt.Sprintf("%d arguments", least)
+	}
+
+	return fmt.Sprintf("%d to %d arguments", least, most)
+}
+
+// Arrange places named arguments at the position of their parameter, after
+// the positional ones. Positions without an argument are left nil.
+func Arrange(params []Param, positional []Value, names []string, named []Value) ([]Value, error) {
+	values := append(make([]Value, 0, len(params)), positional...)
+
+	for idx, name := range names {
+		position := -1
+
+		for at, param := range params {
+			if param.Name == name {
+				position = at
+				break
+			}
+		}
+
+		if position < 0 {
+			return nil, fmt.Errorf("has no parameter named '%s'", name)
+		}
+
+		if params[position].Variadic {
+			return nil, fmt.Errorf("cannot be given its variadic parameter '%s' by name", name)
+		}
+
+		for len(values) <= position {
+			values = append(values, nil)
+		}
+
+		if values[position] != nil {
+			return nil, fmt.Errorf("received '%s' more than once", name)
+		}
+
+		values[position] = named[idx]
+	}
+
+	return values, nil
+}
+
+// Bind matches arguments to parameters, gathering any variadic ones into a
+// list. Optional parameters without an argument are left nil.
+func Bind(params []Param, values []Value) ([]Value, error) {
+	bound := make([]Value, len(params))
+
+	for idx, param := range params {
+		if param.Variadic {
+			rest := make([]Value, 0)
+
+			if idx < len(values) {
+				rest = append(rest, values[idx:]...)
+			}
+
+			bound[idx] = &ListVal{Values: rest}
+			return bound, nil
+		}
+
+		if idx < len(values) && values[idx] != nil {
+			bound[idx] = values[idx]
+			continue
+		}
+
+		if param.Optional {
+			continue
+		}
+
+		if idx < len(values) {
+			return nil, fmt.Errorf("is missing an argument for '%s'", param.Name)
+		}
+
+		return nil, fmt.Errorf("expected %s but received %d", expects(params), len(values))
+	}
+
+	if len(values) > len(params) {
+		return nil, fmt.Errorf("expected %s but received %d", expects(params), len(values))
+	}
+
+	return bound, nil
+}
@@ -0,0 +1,60 @@
+package runtime
+
+import "fmt"
+
+// Values with fields or members which can be read by name
+type getter interface {
+	Get(identifier string) (Value, bool)
+}
+
+// Unpack takes a list apart into count values. With rest, a list of the
+// values left over follows them, otherwise the list must have exactly count.
+func Unpack(value Value, count int, rest bool) ([]Value, error) {
+	list, ok := value.(*ListVal)
+	if !ok {
+		return nil, fmt.Errorf("Cannot destructure '%s' as a list", value.Inspect())
+	}
+
+	if len(list.Values) < count || (!rest && len(list.Values) > count) {
+		return nil, fmt.Errorf("Cannot destructure %d value(s) into %d name(s)", len(list.Values), count)
+	}
+
+	values := make([]Value, 0, count+1)
+
+	for _, item := range list.Values[:count] {
+		values = append(values, item.Copy())
+	}
+
+	if rest {
+		remaining := make([]Value, 0, len(list.Values)-count)
+
+		for _, item := range list.Values[count:] {
+			remaining = append(remaining, item.Copy())
+		}
+
+		values = append(values, &ListVal{Values: remaining})
+	}
+
+	return values, nil
+}
+
+// Fields reads each name from an instance or namespace, in order
+func Fields(value Value, names []string) ([]Value, error) {
+	object, ok := value.(getter)
+	if !ok {
+		return nil, fmt.Errorf("Cannot take fields from '%s'", value.Inspect())
+	}
+
+	values := make([]Value, 0, len(names))
+
+	for _, name := range names {
+		field, ok := object.Get(name)
+		if !ok {
+			return nil, fmt.Errorf("'%s' has no field '%s'", value.Inspect(), name)
+		}
+
+		values = append(values, field.Copy())
+	}
+
+	return values, nil
+}
@@ -0,0 +1,165 @@
+package runtime
+
+import (
+	"fmt"
+	"strings"
+	"tiny/lexer"
+)
+
+// RangeVal counts from Start towards End by Step. Values are only made when
+// looped over, so ranges without an end run until the loop stops.
+type RangeVal struct {
+	Start     int
+	End       int
+	Step      int
+	HasStart  bool
+	HasEnd    bool
+	Inclusive bool
+}
+
+// NewRange builds a range from its parts, where a nil end is left open
+func NewRange(start Value, end Value, step Value, inclusive bool) (*RangeVal, error) {
+	value := &RangeVal{Step: 1, Inclusive: inclusive}
+
+	if start != nil {
+		number, ok := start.(*IntVal)
+		if !ok {
+			return nil, fmt.Errorf("Range start must be an int, but received '%s'", start.Inspect())
+		}
+		value.Start, value.HasStart = number.Value, true
+	}
+
+	if end != nil {
+		number, ok := end.(*IntVal)
+		if !ok {
+			return nil, fmt.Errorf("Range end must be an int, but received '%s'", end.Inspect())
+		}
+		value.End, value.HasEnd = number.Value, true
+	}
+
+	if step != nil {
+		number, ok := step.(*IntVal)
+		if !ok {
+			return nil, fmt.Errorf("Range step must be an int, but received '%s'", step.Inspect())
+		}
+		value.Step = number.Value
+	}
+
+	if value.Step == 0 {
+		return nil, fmt.Errorf("Range step cannot be 0")
+	}
+
+	return value, nil
+}
+
+func (v *RangeVal) GetType() Type { return &RangeType{} }
+func (v *RangeVal) Inspect() string {
+	var sb strings.Builder
+
+	if v.HasStart {
+		sb.WriteString(fmt.Sprintf("%d", v.Start))
+	}
+
+	if v.Inclusive {
+		sb.WriteString("..=")
+	} else {
+		sb.WriteString("..")
+	}
+
+	if v.HasEnd {
+		sb.WriteString(fmt.Sprintf("%d", v.End))
+	}
+
+	if v.Step != 1 {
+		sb.WriteString(fmt.Sprintf(" step %d", v.Step))
+	}
+
+	return sb.String()
+}
+func (v *RangeVal) Copy() Value                                        { return v }
+func (v *RangeVal) Modify(operation lexer.TokenKind, other Value) bool { return false }
+
+// Whether a value is still inside the range, counting in the step's direction
+func (v *RangeVal) contains(value int) bool {
+	if !v.HasEnd {
+		return true
+	}
+
+	switch {
+	case v.Step > 0 && v.Inclusive:
+		return value <= v.End
+	case v.Step > 0:
+		return value < v.End
+	case v.Inclusive:
+		return value >= v.End
+	}
+
+	return value > v.End
+}
+
+func (v *RangeVal) iterator() func() (Value, bool, error) {
+	current := v.Start
+
+	return func() (Value, bool, error) {
+		if !v.contains(current) {
+			return nil, false, nil
+		}
+
+		current += v.Step
+		return &IntVal{Value: current - v.Step}, true, nil
+	}
+}
+
+// Where a slice starts and ends in something of the given length. Either end
+// can count back from the end when negative.
+func (v *RangeVal) bounds(length int) (int, int, error) {
+	if v.Step != 1 {
+		return 0, 0, fmt.Errorf("Slice '%s' cannot have a step", v.Inspect())
+	}
+
+	start, end := 0, length
+
+	if v.HasStart {
+		start = v.Start
+		if start < 0 {
+			start += length
+		}
+	}
+
+	if v.HasEnd {
+		end = v.End
+		if end < 0 {
+			end += length
+		}
+
+		if v.Inclusive {
+			end++
+		}
+	}
+
+	if start < 0 || start > length || end < 0 || end > length {
+		return 0, 0, fmt.Errorf("Slice '%s' is out of range for length %d", v.Inspect(), length)
+	}
+
+	// Backwards slices are empty, rather than an error
+	if end < start {
+		end = start
+	}
+
+	return start, end, nil
+}
+
+// Position of an index in something of the given length, counting back from
+// the end when negative
+func position(index int, length int) (int, error) {
+	position := index
+	if position < 0 {
+		position += length
+	}
+
+	if position < 0 || position >= length {
+		return 0, fmt.Errorf("Index %d is out of range for length %d", index, length)
+	}
+
+	return position, nil
+}
@@ -0,0 +1,88 @@
+package runtime
+
+import (
+	"fmt"
+	"tiny/ast"
+	"tiny/lexer"
+)
+
+// TraitValue holds the methods a class or struct must provide to implement a
+// trait, along with the defaults it is given for the ones it leaves out
+type TraitValue struct {
+	identifier string
+	// Parameter counts of every method, by name
+	methods  map[string]int
+	defaults map[string]*ast.FunctionDef
+	// The interpreter the trait was defined in, which differs for imported modules
+	owner *Interpreter
+}
+
+func newTrait(interpreter *Interpreter, def *ast.TraitDef) *TraitValue {
+	trait := &TraitValue{identifier: def.Token.Lexeme, methods: make(map[string]int, len(def.Methods)), defaults: make(map[string]*ast.FunctionDef), owner: interpreter}
+
+	for _, method := range def.Methods {
+		trait.methods[method.GetToken().Lexeme] = len(method.Params)
+
+		if method.Body != nil {
+			trait.defaults[method.GetToken().Lexeme] = method
+		}
+	}
+
+	return trait
+}
+
+func (v *TraitValue) GetType() Type                                      { return &TraitType{} }
+func (v *TraitValue) Inspect() string                                    { return fmt.Sprintf("<trait %s>", v.identifier) }
+func (v *TraitValue) Copy() Value                                        { return v }
+func (v *TraitValue) Modify(operation lexer.TokenKind, other Value) bool { return false }
+
+// Give methods the defaults they are missing, returning an error when one the
+// trait requires is not there or takes the wrong number of parameters
+func (trait *TraitValue) apply(methods map[string]Value) error {
+	for name, count := range trait.methods {
+		method, ok := methods[name]
+		if !ok {
+			def, ok := trait.defaults[name]
+			if !ok {
+				return fmt.Errorf("does not implement '%s' required by trait '%s'", name, trait.identifier)
+			}
+
+			// Each class gets its own, as methods are bound when they are read
+			methods[name] = &FunctionValue{definition: def, owner: trait.owner}
+			continue
+		}
+
+		if fn, ok := method.(*FunctionValue); ok && len(fn.definition.Params) != count {
+			return fmt.Errorf("method '%s' takes %d parameter(s), but trait '%s' expects %d", name, len(fn.definition.Params), trait.identifier, count)
+		}
+	}
+
+	return nil
+}
+
+// Implements reports whether a class, struct or an instance of either
+// declared that it implements a trait
+func Implements(value Value, trait *TraitValue) bool {
+	var traits []*TraitValue
+
+	switch v := value.(type) {
+	case *ClassDefValue:
+		traits = v.traits
+	case *StructDefValue:
+		traits = v.traits
+	case *ClassInstanceValue:
+		if def, ok := v.Def.(*ClassDefValue); ok {
+			traits = def.traits
+		}
+	case *StructInstanceValue:
+		traits = v.def.traits
+	}
+
+	for _, implemented := range traits {
+		if implemented == trait {
+			return true
+		}
+	}
+
+	return false
+}
@@ -15,6 +15,12 @@ const (
 	TYPE_CLASS_INSTANCE
 	TYPE_STRUCT
 	TYPE_STRUCT_INSTANCE
+	TYPE_ENUM
+	TYPE_ENUM_VALUE
+	TYPE_TRAIT
+	TYPE_ITERATOR
+	TYPE_RANGE
+	TYPE_FILE
 	TYPE_FUNCTION
 	TYPE_NATIVE_FUNCTION
 	TYPE_NAMESPACE
@@ -43,6 +49,12 @@ type ClassDefType struct{}
 type StructDefType struct{}
 type ClassInstanceType struct{}
 type StructInstanceType struct{}
+type EnumDefType struct{}
+type EnumType struct{}
+type TraitType struct{}
+type IteratorType struct{}
+type RangeType struct{}
+type FileType struct{}
 type NameSpaceType struct{}
 type ListType struct{} // FIXME: Only allow a single type within, lists can be the exception to dynamic rules
 type LoopFlowType struct{}
@@ -92,6 +104,24 @@ func (t *StructDefType) GetName() string   { return "struct" }
 func (t *StructInstanceType) GetKind() TypeKind { return TYPE_STRUCT_INSTANCE }
 func (t *StructInstanceType) GetName() string   { return "struct instance" }
 
+func (t *EnumDefType) GetKind() TypeKind { return TYPE_ENUM }
+func (t *EnumDefType) GetName() string   { return "enum" }
+
+func (t *EnumType) GetKind() TypeKind { return TYPE_ENUM_VALUE }
+func (t *EnumType) GetName() string   { return "enum value" }
+
+func (t *TraitType) GetKind() TypeKind { return TYPE_TRAIT }
+func (t *TraitType) GetName() string   { return "trait" }
+
+func (t *IteratorType) GetKind() TypeKind { return TYPE_ITERATOR }
+func (t *IteratorType) GetName() string   { return "iterator" }
+
+func (t *RangeType) GetKind() TypeKind { return TYPE_RANGE }
+func (t *RangeType) GetName() string   { return "range" }
+
+func (t *FileType) GetKind() TypeKind { return TYPE_FILE }
+func (t *FileType) GetName() string   { return "file" }
+
 func (t *NameSpaceType) GetKind() TypeKind { return TYPE_NAMESPACE }
 func (t *NameSpaceType) GetName() string   { return "namespace" }
 
@@ -38,12 +38,17 @@ type StringVal struct {
 type FunctionValue struct {
 	definition *ast.FunctionDef
 	bound      Value
+	// The interpreter the function was defined in, which differs for imported modules
+	owner *Interpreter
+	// Definition of the class or struct the function belongs to, if any
+	class Value
 }
 
 type CompiledFunctionValue struct {
-	Start_ip int
-	Arity    byte
-	Bound    Value
+	Start_ip  int
+	Arity     byte
+	Bound     Value
+	Generator bool
 }
 
 type NativeFunctionValue struct {
@@ -54,6 +59,7 @@ type NativeFunctionValue struct {
 
 type ListVal struct {
 	Values []Value
+	frozen bool
 }
 
 func NewFnValue(identifier string, params []string, fn NativeFn) *NativeFunctionValue {
@@ -62,6 +68,9 @@ func NewFnValue(identifier string, params []string, fn NativeFn) *NativeFunction
 
 type AnonFunctionValue struct {
 	definition *ast.AnonymousFunction
+	owner      *Interpreter
+	// Definition of the class or struct whose function made it, if any
+	class Value
 }
 
 type ReturnValue struct {
@@ -112,6 +121,12 @@ type ClassDefValue struct {
 	constructor *FunctionValue
 	fields      []string
 	methods     map[string]Value
+	traits      []*TraitValue
+	// Static fields and methods, reached through the class
+	statics map[string]Value
+	getters map[string]*FunctionValue
+	setters map[string]*FunctionValue
+	private map[string]bool
 }
 
 func (def *ClassDefValue) HasField(field string) bool {
@@ -127,6 +142,7 @@ type ClassInstanceValue struct {
 	Def    Value
 	base   *ClassInstanceValue
 	fields map[string]Value
+	frozen bool
 }
 
 func (klass *ClassInstanceValue) Definition() string {
@@ -137,6 +153,9 @@ type StructDefValue struct {
 	identifier  string
 	constructor *FunctionValue
 	fields      []string
+	methods     map[string]Value
+	traits      []*TraitValue
+	private     map[string]bool
 }
 
 func (str *StructDefValue) HasField(field string) bool {
@@ -151,6 +170,7 @@ func (str *StructDefValue) HasField(field string) bool {
 type StructInstanceValue struct {
 	def    *StructDefValue
 	fields map[string]Value
+	frozen bool
 }
 
 func (str *StructInstanceValue) Definition() string {
@@ -165,6 +185,8 @@ func (str *StructInstanceValue) HasField(field string) bool {
 type NameSpaceValue struct {
 	Identifier string
 	Members    map[string]Value
+	// Names of members which cannot be reached through the namespace
+	private map[string]bool
 }
 
 type LoopFlow struct {
@@ -251,19 +273,34 @@ func (v *FunctionValue) Inspect() string {
 func (v *FunctionValue) Copy() Value                                        { return v }
 func (v *FunctionValue) Modify(operation lexer.TokenKind, other Value) bool { return false }
 
-func (fn *FunctionValue) Arity() int { return len(fn.definition.Params) }
+func (fn *FunctionValue) Arity() int          { return required(fn.Parameters()) }
+func (fn *FunctionValue) Parameters() []Param { return scriptParams(fn.definition.Params) }
 
 func (fn *FunctionValue) Call(interpreter *Interpreter, values []Value) Value {
-	interpreter.push()
+	// Functions from another module run in its interpreter, so they see its globals
+	if fn.owner != interpreter {
+		return fn.Call(fn.owner, values)
+	}
+
+	// Private members are open to the functions of their class while they run
+	enclosing := interpreter.class
+	interpreter.class = fn.class
+	defer func() { interpreter.class = enclosing }()
 
-	for idx, arg := range values {
-		interpreter.insert(fn.definition.Params[idx].Token.Lexeme, arg)
+	if fn.definition.Generator {
+		return interpreter.generate(fn.definition.GetToken().Lexeme, fn.bound, fn.definition.Params, values, fn.definition.Body)
 	}
 
+	interpreter.push()
+	defer interpreter.unwind(len(interpreter.defers))
+	interpreter.enter()
+
 	if fn.bound != nil {
 		interpreter.insert("self", fn.bound)
 	}
 
+	interpreter.bindParams(fn.definition.GetToken().Lexeme, fn.definition.Params, values)
+
 	value := interpreter.Visit(fn.definition.Body)
 
 	if ret, ok := value.(*ReturnValue); ok {
@@ -274,6 +311,7 @@ func (fn *FunctionValue) Call(interpreter *Interpreter, values []Value) Value {
 		value = thrown
 	}
 
+	value = interpreter.exit(value)
 	interpreter.pop()
 	return value
 }
@@ -292,13 +330,18 @@ func (v *NativeFunctionValue) Inspect() string {
 func (v *NativeFunctionValue) Copy() Value                                        { return v }
 func (v *NativeFunctionValue) Modify(operation lexer.TokenKind, other Value) bool { return false }
 
-func (v *NativeFunctionValue) Arity() int { return len(v.Params) }
+func (v *NativeFunctionValue) Arity() int { return required(v.Parameters()) }
 
+// Native params are written 'name', 'name?' when optional or '...name' when variadic
+func (v *NativeFunctionValue) Parameters() []Param { return nativeParams(v.Params) }
+
+// Optional parameters left out are passed as nil, and variadic ones as a list
 func (v *NativeFunctionValue) Call(interpreter *Interpreter, values []Value) Value {
-	if v.Arity() != len(values) {
-		interpreter.Report("Native function '%s' expected %d arguments but received %d.", v.Identifier, v.Arity(), len(values))
+	bound, err := Bind(v.Parameters(), values)
+	if err != nil {
+		interpreter.Report("Native function '%s' %s.", v.Identifier, err)
 	}
-	return v.Fn(interpreter, values)
+	return v.Fn(interpreter, bound)
 }
 
 func (v *AnonFunctionValue) GetType() Type                                      { return &FunctionType{} }
@@ -306,15 +349,29 @@ func (v *AnonFunctionValue) Inspect() string
 func (v *AnonFunctionValue) Copy() Value                                        { return v }
 func (v *AnonFunctionValue) Modify(operation lexer.TokenKind, other Value) bool { return false }
 
-func (fn *AnonFunctionValue) Arity() int { return len(fn.definition.Params) }
+func (fn *AnonFunctionValue) Arity() int          { return required(fn.Parameters()) }
+func (fn *AnonFunctionValue) Parameters() []Param { return scriptParams(fn.definition.Params) }
 
 func (fn *AnonFunctionValue) Call(interpreter *Interpreter, values []Value) Value {
-	interpreter.push()
+	if fn.owner != interpreter {
+		return fn.Call(fn.owner, values)
+	}
+
+	// Only sees the private members of the class it was written in, not
+	// those of whoever calls it
+	enclosing := interpreter.class
+	interpreter.class = fn.class
+	defer func() { interpreter.class = enclosing }()
 
-	for idx, arg := range values {
-		interpreter.insert(fn.definition.Params[idx].Token.Lexeme, arg)
+	if fn.definition.Generator {
+		return interpreter.generate("anon fn", nil, fn.definition.Params, values, fn.definition.Body)
 	}
 
+	interpreter.push()
+	defer interpreter.unwind(len(interpreter.defers))
+	interpreter.enter()
+	interpreter.bindParams("anon fn", fn.definition.Params, values)
+
 	value := interpreter.Visit(fn.definition.Body)
 
 	if ret, ok := value.(*ReturnValue); ok {
@@ -325,6 +382,7 @@ func (fn *AnonFunctionValue) Call(interpreter *Interpreter, values []Value) Valu
 		value = thrown
 	}
 
+	value = interpreter.exit(value)
 	interpreter.pop()
 	return value
 }
@@ -348,11 +406,23 @@ func (def *NativeClassDefValue) Arity() int {
 	return len(def.Fields)
 }
 
+// Every field is given to the constructor, in order
+func (def *NativeClassDefValue) Parameters() []Param {
+	params := make([]Param, 0, len(def.Fields))
+
+	for _, field := range def.Fields {
+		params = append(params, Param{Name: field})
+	}
+
+	return params
+}
+
 func (def *NativeClassDefValue) Call(interpreter *Interpreter, values []Value) Value {
 	instance := &ClassInstanceValue{Def: def, fields: make(map[string]Value)}
 
-	if def.Arity() != len(values) {
-		interpreter.Report("Native class constructor '%s' expected %d arguments but received %d.", def.Identifier, def.Arity(), len(values))
+	values, err := Bind(def.Parameters(), values)
+	if err != nil {
+		interpreter.Report("Native class constructor '%s' %s.", def.Identifier, err)
 	}
 
 	for idx, id := range def.Fields {
@@ -367,11 +437,26 @@ func (v *ClassDefValue) Inspect() string                                    { re
 func (v *ClassDefValue) Copy() Value                                        { return v }
 func (v *ClassDefValue) Modify(operation lexer.TokenKind, other Value) bool { return false }
 
-func (def *ClassDefValue) Arity() int {
+func (def *ClassDefValue) Get(identifier string) (Value, bool) {
+	value, ok := def.statics[identifier]
+	return value, ok
+}
+
+func (def *ClassDefValue) Set(identifier string, value Value) (Value, bool) {
+	if _, ok := def.statics[identifier]; ok {
+		def.statics[identifier] = value
+		return value, true
+	}
+	return nil, false
+}
+
+func (def *ClassDefValue) Arity() int { return required(def.Parameters()) }
+
+func (def *ClassDefValue) Parameters() []Param {
 	if def.constructor != nil {
-		return len(def.constructor.definition.Params)
+		return def.constructor.Parameters()
 	}
-	return 0
+	return []Param{}
 }
 
 func (def *ClassDefValue) Call(interpreter *Interpreter, values []Value) Value {
@@ -391,6 +476,10 @@ func (def *ClassDefValue) Call(interpreter *Interpreter, values []Value) Value {
 
 func (v *ClassInstanceValue) GetType() Type { return &ClassInstanceType{} }
 func (v *ClassInstanceValue) Inspect() string {
+	if str, ok := overloadInspect(v); ok {
+		return str
+	}
+
 	var id string
 
 	switch t := v.Def.(type) {
@@ -427,6 +516,11 @@ func (instance *ClassInstanceValue) Get(identifier string) (Value, bool) {
 
 	switch t := instance.Def.(type) {
 	case *ClassDefValue:
+		if getter, ok := t.getters[identifier]; ok {
+			getter.bound = instance
+			return getter.Call(getter.owner, []Value{}), true
+		}
+
 		methods = t.methods
 	case *NativeClassDefValue:
 		methods = t.Methods
@@ -456,6 +550,15 @@ func (instance *ClassInstanceValue) Set(identifier string, value Value) (Value,
 	}
 
 	if def, ok := instance.Def.(*ClassDefValue); ok {
+		if setter, ok := def.setters[identifier]; ok {
+			setter.bound = instance
+
+			if thrown, ok := setter.Call(setter.owner, []Value{value}).(*ThrowValue); ok {
+				return thrown, true
+			}
+			return value, true
+		}
+
 		if def.base != nil {
 			return instance.base.Set(identifier, value)
 		}
@@ -464,16 +567,31 @@ func (instance *ClassInstanceValue) Set(identifier string, value Value) (Value,
 	return nil, false
 }
 
+// A property with a getter but no setter cannot be assigned
+func (instance *ClassInstanceValue) readOnly(identifier string) bool {
+	def, ok := instance.Def.(*ClassDefValue)
+	if !ok {
+		return false
+	}
+
+	_, getter := def.getters[identifier]
+	_, setter := def.setters[identifier]
+
+	return getter && !setter
+}
+
 func (v *StructDefValue) GetType() Type                                      { return &StructDefType{} }
 func (v *StructDefValue) Inspect() string                                    { return fmt.Sprintf("<struct %s>", v.identifier) }
 func (v *StructDefValue) Copy() Value                                        { return v }
 func (v *StructDefValue) Modify(operation lexer.TokenKind, other Value) bool { return false }
 
-func (def *StructDefValue) Arity() int {
+func (def *StructDefValue) Arity() int { return required(def.Parameters()) }
+
+func (def *StructDefValue) Parameters() []Param {
 	if def.constructor != nil {
-		return len(def.constructor.definition.Params)
+		return def.constructor.Parameters()
 	}
-	return 0
+	return []Param{}
 }
 
 func (def *StructDefValue) Call(interpreter *Interpreter, values []Value) Value {
@@ -493,6 +611,10 @@ func (def *StructDefValue) Call(interpreter *Interpreter, values []Value) Value
 
 func (v *StructInstanceValue) GetType() Type { return &StructInstanceType{} }
 func (v *StructInstanceValue) Inspect() string {
+	if str, ok := overloadInspect(v); ok {
+		return str
+	}
+
 	var sb strings.Builder
 
 	sb.WriteString(fmt.Sprintf("%s { ", v.def.identifier))
@@ -508,9 +630,9 @@ func (v *StructInstanceValue) Inspect() string {
 	return sb.String()
 }
 
-// Copy semantics on structs
+// Copy semantics on structs, a copy of a frozen struct stays frozen
 func (v *StructInstanceValue) Copy() Value {
-	new := &StructInstanceValue{def: v.def, fields: make(map[string]Value, len(v.fields))}
+	new := &StructInstanceValue{def: v.def, fields: make(map[string]Value, len(v.fields)), frozen: v.frozen}
 
 	for key, value := range v.fields {
 		new.fields[key] = value.Copy()
@@ -525,6 +647,11 @@ func (instance *StructInstanceValue) Get(identifier string) (Value, bool) {
 		return val, true
 	}
 
+	if fn, ok := instance.def.methods[identifier]; ok {
+		fn.(*FunctionValue).bound = instance
+		return fn, true
+	}
+
 	return nil, false
 }
 
@@ -630,7 +757,7 @@ func BinopL(operator lexer.TokenKind, a []Value, b []Value) (Value, bool) {
 			list = append(list, value.Copy())
 		}
 
-		return &ListVal{list}, true
+		return &ListVal{Values: list}, true
 	// FIXME: Better equality checks
 	case lexer.EQUAL_EQUAL:
 		return &BoolVal{Value: len(a) == len(b)}, true
@@ -757,11 +884,37 @@ func Equality(left Value, right Value) bool {
 	case *ClassDefValue:
 		return t.identifier == right.(*ClassDefValue).identifier
 	case *ClassInstanceValue:
+		if equal, ok := overloadEquality(t, right); ok {
+			return equal
+		}
 		return Equality(t.Def, right.(*ClassInstanceValue).Def)
 	case *StructDefValue:
 		return t.identifier == right.(*StructDefValue).identifier
 	case *StructInstanceValue:
+		if equal, ok := overloadEquality(t, right); ok {
+			return equal
+		}
 		return Equality(t.def, right.(*StructInstanceValue).def)
+	case *RangeVal:
+		return *t == *right.(*RangeVal)
+	case *EnumDefValue:
+		return t == right.(*EnumDefValue)
+	case *EnumVariantValue:
+		return t == right.(*EnumVariantValue)
+	case *EnumVal:
+		// Variants are equal when they match and so does their payload
+		values, ok := right.(*EnumVal).payload(t.variant)
+		if !ok {
+			return false
+		}
+
+		for idx, value := range t.values {
+			if !Equality(value, values[idx]) {
+				return false
+			}
+		}
+
+		return true
 	}
 
 	return false
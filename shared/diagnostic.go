@@ -0,0 +1,233 @@
+package shared
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+type Severity string
+
+const (
+	SEVERITY_ERROR   Severity = "error"
+	SEVERITY_WARNING Severity = "warning"
+)
+
+// A problem found in a source file, with enough information for it to be
+// reported alongside any others found in the same run
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	Kind     string   `json:"kind"`
+	Message  string   `json:"message"`
+	File     string   `json:"file,omitempty"`
+	Line     int      `json:"line,omitempty"`
+	Column   int      `json:"column,omitempty"`
+	Length   int      `json:"length,omitempty"`
+	Expected string   `json:"expected,omitempty"`
+	Found    string   `json:"found,omitempty"`
+	Notes    []string `json:"notes,omitempty"`
+	Hints    []string `json:"hints,omitempty"`
+}
+
+const (
+	ERROR_FORMAT_TEXT = "text"
+	ERROR_FORMAT_JSON = "json"
+)
+
+var (
+	errorFormat = ERROR_FORMAT_TEXT
+	sources     = make(map[string]string)
+	sourcesLock sync.Mutex
+)
+
+// Select how diagnostics are written, either "text" or "json"
+func SetErrorFormat(format string) bool {
+	switch format {
+	case ERROR_FORMAT_TEXT, ERROR_FORMAT_JSON:
+		errorFormat = format
+		return true
+	}
+
+	return false
+}
+
+func ErrorFormat() string {
+	return errorFormat
+}
+
+// Keep the source of a file, so diagnostics can show the offending line
+// without reading it from disk again
+func RegisterSource(path string, source string) {
+	sourcesLock.Lock()
+	defer sourcesLock.Unlock()
+
+	sources[path] = source
+}
+
+func NewDiagnostic(kind string, msg string, args ...any) *Diagnostic {
+	return &Diagnostic{Severity: SEVERITY_ERROR, Kind: kind, Message: fmt.Sprintf(msg, args...)}
+}
+
+// Position the diagnostic at a span within a file
+func (d *Diagnostic) At(file string, line int, column int, length int) *Diagnostic {
+	d.File = file
+	d.Line = line
+	d.Column = column
+	d.Length = length
+	return d
+}
+
+func (d *Diagnostic) Note(msg string, args ...any) *Diagnostic {
+	d.Notes = append(d.Notes, fmt.Sprintf(msg, args...))
+	return d
+}
+
+func (d *Diagnostic) Hint(msg string, args ...any) *Diagnostic {
+	d.Hints = append(d.Hints, fmt.Sprintf(msg, args...))
+	return d
+}
+
+func (d *Diagnostic) String() string {
+	if len(d.File) == 0 {
+		return fmt.Sprintf("%s [%d:%d]", d.Message, d.Line, d.Column)
+	}
+
+	return fmt.Sprintf("%s [%d:%d] '%s'", d.Message, d.Line, d.Column, d.File)
+}
+
+// Write the diagnostic to stderr in the selected error format
+func Emit(d *Diagnostic) {
+	if errorFormat == ERROR_FORMAT_JSON {
+		fmt.Fprintln(os.Stderr, d.JSON())
+		return
+	}
+
+	fmt.Fprint(os.Stderr, d.Render(useColour(os.Stderr)))
+}
+
+func (d *Diagnostic) JSON() string {
+	encoded, _ := json.Marshal(d)
+	return string(encoded)
+}
+
+// Render the diagnostic with the source line it refers to, underlining the
+// offending span. Notes, hints and expectations are listed beneath it.
+func (d *Diagnostic) Render(colour bool) string {
+	paint := func(code string, text string) string {
+		if !colour {
+			return text
+		}
+		return fmt.Sprintf("\u001b[%sm%s\u001b[0m", code, text)
+	}
+
+	var sb strings.Builder
+
+	header := string(d.Severity)
+	if len(d.Kind) > 0 {
+		header = fmt.Sprintf("%s[%s]", header, d.Kind)
+	}
+
+	severityColour := "31;1"
+	if d.Severity == SEVERITY_WARNING {
+		severityColour = "33;1"
+	}
+
+	sb.WriteString(fmt.Sprintf("%s: %s\n", paint(severityColour, header), paint("1", d.Message)))
+
+	gutter := strings.Repeat(" ", len(fmt.Sprint(d.Line)))
+	line, hasLine := sourceLine(d.File, d.Line)
+	column, length := d.Column, d.Length
+
+	// Spans running past the line, like a string left open, are cut at its
+	// end, pointing just after it at most
+	if hasLine {
+		column = max(min(column, len(line)+1), 1)
+		length = min(length, utf8.RuneCountInString(line[column-1:]))
+	}
+
+	if len(d.File) > 0 {
+		sb.WriteString(fmt.Sprintf("%s%s %s:%d:%d\n", gutter, paint("34;1", "-->"), d.File, d.Line, column))
+	}
+
+	if hasLine {
+		bar := paint("34;1", "|")
+
+		sb.WriteString(fmt.Sprintf("%s %s\n", gutter, bar))
+		sb.WriteString(fmt.Sprintf("%s %s %s\n", paint("34;1", fmt.Sprint(d.Line)), bar, line))
+		sb.WriteString(fmt.Sprintf("%s %s %s%s\n", gutter, bar, underlinePadding(line, column), paint(severityColour, strings.Repeat("^", max(length, 1)))))
+	}
+
+	if len(d.Expected) > 0 {
+		found := d.Found
+		if len(found) == 0 {
+			found = "nothing"
+		}
+		sb.WriteString(fmt.Sprintf("%s %s expected %s, found '%s'\n", gutter, paint("34;1", "="), d.Expected, found))
+	}
+
+	for _, note := range d.Notes {
+		sb.WriteString(fmt.Sprintf("%s %s %s: %s\n", gutter, paint("34;1", "="), paint("1", "note"), note))
+	}
+
+	for _, hint := range d.Hints {
+		sb.WriteString(fmt.Sprintf("%s %s %s: %s\n", gutter, paint("34;1", "="), paint("32;1", "hint"), hint))
+	}
+
+	return sb.String()
+}
+
+// --- Private ---
+func sourceLine(path string, line int) (string, bool) {
+	if len(path) == 0 || line < 1 {
+		return "", false
+	}
+
+	sourcesLock.Lock()
+	source, ok := sources[path]
+	sourcesLock.Unlock()
+
+	if !ok {
+		if source, ok = ReadFileErr(path); !ok {
+			return "", false
+		}
+	}
+
+	lines := strings.Split(source, "\n")
+	if line > len(lines) {
+		return "", false
+	}
+
+	return strings.TrimRight(lines[line-1], "\r"), true
+}
+
+// Keep tabs so the underline lines up with the source when printed. Columns
+// count bytes, so characters made of several bytes are padded only once.
+func underlinePadding(line string, column int) string {
+	var sb strings.Builder
+
+	for _, char := range line[:min(max(column-1, 0), len(line))] {
+		if char == '\t' {
+			sb.WriteByte('\t')
+		} else {
+			sb.WriteByte(' ')
+		}
+	}
+
+	return sb.String()
+}
+
+func useColour(file *os.File) bool {
+	if len(os.Getenv("NO_COLOR")) > 0 {
+		return false
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
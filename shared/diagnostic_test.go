@@ -0,0 +1,123 @@
+package shared
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	RegisterSource("render.tiny", "let a = 1;\n\tprint(b);\n")
+
+	diagnostic := NewDiagnostic("Analysis", "Unknown identifier '%s'", "b").At("render.tiny", 2, 8, 1)
+	diagnostic.Note("checked in the current scope").Hint("declare 'b' first")
+
+	expected := "error[Analysis]: Unknown identifier 'b'\n" +
+		" --> render.tiny:2:8\n" +
+		"  |\n" +
+		"2 | \tprint(b);\n" +
+		"  | \t      ^\n" +
+		"  = note: checked in the current scope\n" +
+		"  = hint: declare 'b' first\n"
+
+	if rendered := diagnostic.Render(false); rendered != expected {
+		t.Fatalf("Expected:\n%s\nbut received:\n%s", expected, rendered)
+	}
+}
+
+func TestRenderExpected(t *testing.T) {
+	RegisterSource("expected.tiny", "let a = ;\n")
+
+	diagnostic := NewDiagnostic("Syntax", "Unexpected token").At("expected.tiny", 1, 9, 1)
+	diagnostic.Severity = SEVERITY_WARNING
+	diagnostic.Expected = "expression"
+
+	expected := "warning[Syntax]: Unexpected token\n" +
+		" --> expected.tiny:1:9\n" +
+		"  |\n" +
+		"1 | let a = ;\n" +
+		"  |         ^\n" +
+		"  = expected expression, found 'nothing'\n"
+
+	if rendered := diagnostic.Render(false); rendered != expected {
+		t.Fatalf("Expected:\n%s\nbut received:\n%s", expected, rendered)
+	}
+}
+
+// Columns count bytes, but the underline must line up with what is shown
+func TestRenderMultiByte(t *testing.T) {
+	RegisterSource("multibyte.tiny", "let é = ü;\n")
+
+	// 'ü' starts at byte 10, as 'é' takes two
+	diagnostic := NewDiagnostic("Analysis", "Unknown identifier 'ü'").At("multibyte.tiny", 1, 10, 1)
+
+	expected := "error[Analysis]: Unknown identifier 'ü'\n" +
+		" --> multibyte.tiny:1:10\n" +
+		"  |\n" +
+		"1 | let é = ü;\n" +
+		"  |         ^\n"
+
+	if rendered := diagnostic.Render(false); rendered != expected {
+		t.Fatalf("Expected:\n%s\nbut received:\n%s", expected, rendered)
+	}
+}
+
+// A string left open runs past its line, so is cut at the end of it
+func TestRenderUnterminatedString(t *testing.T) {
+	RegisterSource("unterminated.tiny", "let s = \"abc\n")
+
+	diagnostic := NewDiagnostic("Syntax", "Unexpected token").At("unterminated.tiny", 1, 25, 6)
+
+	expected := "error[Syntax]: Unexpected token\n" +
+		" --> unterminated.tiny:1:13\n" +
+		"  |\n" +
+		"1 | let s = \"abc\n" +
+		"  |             ^\n"
+
+	if rendered := diagnostic.Render(false); rendered != expected {
+		t.Fatalf("Expected:\n%s\nbut received:\n%s", expected, rendered)
+	}
+
+	diagnostic = NewDiagnostic("Syntax", "Unterminated string").At("unterminated.tiny", 1, 9, 20)
+
+	expected = "error[Syntax]: Unterminated string\n" +
+		" --> unterminated.tiny:1:9\n" +
+		"  |\n" +
+		"1 | let s = \"abc\n" +
+		"  |         ^^^^\n"
+
+	if rendered := diagnostic.Render(false); rendered != expected {
+		t.Fatalf("Expected:\n%s\nbut received:\n%s", expected, rendered)
+	}
+}
+
+func TestRenderWithoutSource(t *testing.T) {
+	diagnostic := NewDiagnostic("Runtime", "Stack overflow")
+
+	if rendered := diagnostic.Render(false); rendered != "error[Runtime]: Stack overflow\n" {
+		t.Fatalf("Expected only the header, but received:\n%s", rendered)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	diagnostic := NewDiagnostic("Syntax", "Unexpected token").At("json.tiny", 3, 5, 2).Hint("add a ';'")
+	diagnostic.Expected = ";"
+
+	expected := `{"severity":"error","kind":"Syntax","message":"Unexpected token","file":"json.tiny","line":3,"column":5,"length":2,"expected":";","hints":["add a ';'"]}`
+
+	if encoded := diagnostic.JSON(); encoded != expected {
+		t.Fatalf("Expected '%s' but received '%s'", expected, encoded)
+	}
+
+	var decoded Diagnostic
+	if err := json.Unmarshal([]byte(diagnostic.JSON()), &decoded); err != nil || decoded.Line != 3 || decoded.Hints[0] != "add a ';'" {
+		t.Fatalf("Expected JSON to decode back to the diagnostic, but received %v (%v)", decoded, err)
+	}
+}
+
+func TestJSONOmitsEmpty(t *testing.T) {
+	expected := `{"severity":"error","kind":"Runtime","message":"Stack overflow"}`
+
+	if encoded := NewDiagnostic("Runtime", "Stack overflow").JSON(); encoded != expected {
+		t.Fatalf("Expected '%s' but received '%s'", expected, encoded)
+	}
+}
@@ -1,14 +1,25 @@
 package shared
 
 import (
-	"io/fs"
 	"io/ioutil"
 	"log"
 	"os"
+	"strings"
+)
+
+// Statuses the process exits with, so scripts and CI can tell what went wrong
+const (
+	EXIT_OK = iota
+	EXIT_FAILURE
+	EXIT_SYNTAX
+	EXIT_ANALYSIS
+	EXIT_RUNTIME
+	EXIT_THROW
+	EXIT_TEST
 )
 
 func WriteFile(path string, contents string) bool {
-	return ioutil.WriteFile(path, []byte(contents), fs.ModeAppend) == nil
+	return ioutil.WriteFile(path, []byte(contents), 0644) == nil
 }
 
 func DeleteFile(path string) bool {
@@ -41,7 +52,7 @@ func ReportErr(msg string) {
 
 func ReportErrFatal(msg string) {
 	log.Printf("\u001b[31;1mError:\u001b[0m %s", msg)
-	os.Exit(0)
+	os.Exit(EXIT_FAILURE)
 }
 
 func SameFile(path1 string, path2 string) bool {
@@ -64,3 +75,31 @@ func SameFile(path1 string, path2 string) bool {
 
 	return os.SameFile(s1, s2)
 }
+
+// Native parameters are plain names, with a trailing '?' when they can be left
+// out and a leading '...' when they collect the remaining arguments
+func ParseParam(spec string) (name string, optional bool, variadic bool) {
+	if strings.HasPrefix(spec, "...") {
+		return spec[3:], true, true
+	}
+
+	if strings.HasSuffix(spec, "?") {
+		return spec[:len(spec)-1], true, false
+	}
+
+	return spec, false, false
+}
+
+// Methods a class or struct can define to change how operators and builtins
+// treat it, with the number of parameters each must take
+var SpecialMethods = map[string]int{
+	"__add__":   1,
+	"__sub__":   1,
+	"__mul__":   1,
+	"__div__":   1,
+	"__eq__":    1,
+	"__lt__":    1,
+	"__index__": 1,
+	"__str__":   0,
+	"__len__":   0,
+}
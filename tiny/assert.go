@@ -0,0 +1,157 @@
+package tiny
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"tiny/runtime"
+)
+
+// Assertion failures are thrown, so they fail the enclosing test block and
+// can be caught like any other thrown value
+func assertFailed(msg string, args ...any) runtime.Value {
+	return runtime.NewThrow(&runtime.StringVal{Value: fmt.Sprintf(msg, args...)})
+}
+
+// Only containers get a line by line diff, as scalars are already shown whole
+func isStructured(value runtime.Value) bool {
+	switch value.(type) {
+	case *runtime.ListVal, *runtime.StructInstanceValue, *runtime.ClassInstanceValue:
+		return true
+	}
+
+	return false
+}
+
+func toFloat(value runtime.Value) (float64, bool) {
+	switch number := value.(type) {
+	case *runtime.IntVal:
+		return float64(number.Value), true
+	case *runtime.FloatVal:
+		return float64(number.Value), true
+	}
+
+	return 0, false
+}
+
+func (tiny *Tiny) createAssert() {
+	tiny.AddNamespace("assert")
+
+	tiny.AddFunction("assert", "eq", []string{"actual", "expected"}, func(interpreter *runtime.Interpreter, values []runtime.Value) runtime.Value {
+		lines := runtime.Diff(values[1], values[0])
+
+		if len(lines) == 0 {
+			return &runtime.UnitVal{}
+		}
+
+		var sb strings.Builder
+
+		sb.WriteString("assert.eq failed\n")
+		sb.WriteString(fmt.Sprintf("  expected: %s\n", runtime.Describe(values[1])))
+		sb.WriteString(fmt.Sprintf("  actual:   %s", runtime.Describe(values[0])))
+
+		if isStructured(values[0]) && isStructured(values[1]) {
+			sb.WriteString("\n  diff:")
+
+			for _, line := range lines {
+				sb.WriteString("\n    ")
+				sb.WriteString(line)
+			}
+		}
+
+		return assertFailed("%s", sb.String())
+	})
+
+	tiny.AddFunction("assert", "ne", []string{"actual", "unexpected"}, func(interpreter *runtime.Interpreter, values []runtime.Value) runtime.Value {
+		if runtime.DeepEquality(values[1], values[0]) {
+			return assertFailed("assert.ne failed\n  both values are: %s", runtime.Describe(values[0]))
+		}
+
+		return &runtime.UnitVal{}
+	})
+
+	tiny.AddFunction("assert", "approx", []string{"actual", "expected", "tolerance"}, func(interpreter *runtime.Interpreter, values []runtime.Value) runtime.Value {
+		actual, ok := toFloat(values[0])
+		if !ok {
+			interpreter.Report("assert.approx expected a number as the actual value, but received '%s'", values[0].Inspect())
+			return nil
+		}
+
+		expected, ok := toFloat(values[1])
+		if !ok {
+			interpreter.Report("assert.approx expected a number as the expected value, but received '%s'", values[1].Inspect())
+			return nil
+		}
+
+		tolerance, ok := toFloat(values[2])
+		if !ok {
+			interpreter.Report("assert.approx expected a number as the tolerance, but received '%s'", values[2].Inspect())
+			return nil
+		}
+
+		if difference := math.Abs(actual - expected); difference > tolerance {
+			return assertFailed("assert.approx failed\n  expected: %s ± %s\n  actual:   %s (off by %g)", values[1].Inspect(), values[2].Inspect(), values[0].Inspect(), difference)
+		}
+
+		return &runtime.UnitVal{}
+	})
+
+	tiny.AddFunction("assert", "throws", []string{"fn"}, func(interpreter *runtime.Interpreter, values []runtime.Value) runtime.Value {
+		callable, ok := values[0].(runtime.TinyCallable)
+		if !ok || callable.Arity() != 0 {
+			interpreter.Report("assert.throws expected a function without parameters, but received '%s'", values[0].Inspect())
+			return nil
+		}
+
+		result := callable.Call(interpreter, []runtime.Value{})
+
+		// Hand back what was thrown, so tests can check it further
+		if thrown, ok := result.(*runtime.ThrowValue); ok {
+			return thrown.GetInner()
+		}
+
+		return assertFailed("assert.throws failed\n  expected a throw, but returned: %s", runtime.Describe(result))
+	})
+
+	tiny.AddFunction("assert", "contains", []string{"collection", "item"}, func(interpreter *runtime.Interpreter, values []runtime.Value) runtime.Value {
+		switch collection := values[0].(type) {
+		case *runtime.ListVal:
+			for _, value := range collection.Values {
+				if runtime.DeepEquality(values[1], value) {
+					return &runtime.UnitVal{}
+				}
+			}
+
+		case *runtime.StringVal:
+			item, ok := values[1].(*runtime.StringVal)
+			if !ok {
+				interpreter.Report("assert.contains expected a string to search for in a string, but received '%s'", values[1].Inspect())
+				return nil
+			}
+
+			if strings.Contains(collection.Value, item.Value) {
+				return &runtime.UnitVal{}
+			}
+
+		default:
+			interpreter.Report("assert.contains expected a list or string, but received '%s'", values[0].Inspect())
+			return nil
+		}
+
+		return assertFailed("assert.contains failed\n  collection: %s\n  missing:    %s", runtime.Describe(values[0]), runtime.Describe(values[1]))
+	})
+
+	tiny.AddFunction("assert", "is_type", []string{"value", "type"}, func(interpreter *runtime.Interpreter, values []runtime.Value) runtime.Value {
+		expected, ok := values[1].(*runtime.StringVal)
+		if !ok {
+			interpreter.Report("assert.is_type expected a type name, but received '%s'", values[1].Inspect())
+			return nil
+		}
+
+		if actual := typeName(values[0]); actual != expected.Value {
+			return assertFailed("assert.is_type failed\n  expected type: %s\n  actual type:   %s (%s)", expected.Value, actual, runtime.Describe(values[0]))
+		}
+
+		return &runtime.UnitVal{}
+	})
+}
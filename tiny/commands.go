@@ -0,0 +1,496 @@
+package tiny
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"tiny/analysis"
+	"tiny/ast"
+	"tiny/compiler"
+	"tiny/module"
+	"tiny/parser"
+	"tiny/runtime"
+	"tiny/shared"
+	"tiny/vm"
+)
+
+// Name used for diagnostics when the script is read from stdin
+const STDIN_PATH = "<stdin>"
+
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(tiny *Tiny, args []string) int
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{"run", "<file> [-- args...]", "Run a script or compiled bytecode, forwarding arguments after '--' to it", (*Tiny).runCmd},
+		{"check", "<file>", "Check a script for syntax and analysis errors without running it", (*Tiny).checkCmd},
+		{"test", "[path...]", "Run test blocks in files, or in files ending in '_test.tiny' under directories", (*Tiny).testCmd},
+		{"dump", "<file>", "Print the syntax tree of a script", (*Tiny).dumpCmd},
+		{"build", "<file>", "Compile a script to bytecode for the VM", (*Tiny).buildCmd},
+		{"disasm", "<file>", "Print the bytecode of a script or compiled file", (*Tiny).disasmCmd},
+		{"fmt", "<file>...", "Re-indent scripts, printing the result or writing it back with -w", (*Tiny).fmtCmd},
+		{"repl", "", "Start an interactive session", (*Tiny).replCmd},
+	}
+}
+
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+
+	return nil
+}
+
+func usage() {
+	var sb strings.Builder
+
+	sb.WriteString("usage: tiny <command> [flags] [arguments]\n\ncommands:\n")
+	for _, cmd := range commands {
+		sb.WriteString(fmt.Sprintf("  %-8s %s\n", cmd.name, cmd.summary))
+	}
+	sb.WriteString("\nUse 'tiny help <command>' for more about a command.\n")
+
+	fmt.Fprint(os.Stderr, sb.String())
+}
+
+func (tiny *Tiny) helpCmd(args []string) int {
+	if len(args) == 0 {
+		usage()
+		return shared.EXIT_OK
+	}
+
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		shared.ReportErr(fmt.Sprintf("Unknown command '%s'", args[0]))
+		return shared.EXIT_FAILURE
+	}
+
+	return cmd.run(tiny, []string{"-h"})
+}
+
+// Directories given with --path, which may be repeated
+type searchPath []string
+
+func (path *searchPath) String() string {
+	return strings.Join(*path, string(filepath.ListSeparator))
+}
+
+func (path *searchPath) Set(value string) error {
+	*path = append(*path, filepath.SplitList(value)...)
+	return nil
+}
+
+// Create the flags for a command, including the ones every command shares
+func (tiny *Tiny) newFlags(name string) (*flag.FlagSet, *string) {
+	cmd := findCommand(name)
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: tiny %s [flags] %s\n\n%s.\n\nflags:\n", cmd.name, cmd.args, cmd.summary)
+		flags.PrintDefaults()
+	}
+
+	errorFormat := flags.String("error-format", shared.ERROR_FORMAT_TEXT, "Format of reported errors: text or json")
+	flags.Var((*searchPath)(&tiny.searchPath), "path", "Directories to search for imports, after the importing file's own directory (also read from "+module.SEARCH_PATH_ENV+")")
+
+	return flags, errorFormat
+}
+
+// Parse the flags of a command, returning its remaining arguments. A status
+// is returned instead when the command should stop, such as after '-h'.
+func parseFlags(flags *flag.FlagSet, errorFormat *string, args []string) ([]string, int, bool) {
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return nil, shared.EXIT_OK, false
+		}
+		return nil, shared.EXIT_FAILURE, false
+	}
+
+	if !shared.SetErrorFormat(*errorFormat) {
+		shared.ReportErr(fmt.Sprintf("Unknown error format '%s', expected 'text' or 'json'", *errorFormat))
+		return nil, shared.EXIT_FAILURE, false
+	}
+
+	return flags.Args(), shared.EXIT_OK, true
+}
+
+// Expect a single file argument, with anything after '--' left for the script
+func scriptArgs(flags *flag.FlagSet, args []string) (string, []string, bool) {
+	if len(args) == 0 || args[0] == "--" {
+		shared.ReportErr("Expected a file to read, or '-' for stdin")
+		flags.Usage()
+		return "", nil, false
+	}
+
+	rest := args[1:]
+	if len(rest) > 0 && rest[0] == "--" {
+		rest = rest[1:]
+	}
+
+	return args[0], rest, true
+}
+
+// Read a script from a path, or from stdin when the path is '-'
+func readSource(path string) (string, string, bool) {
+	if path == "-" {
+		source, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			shared.ReportErr(fmt.Sprintf("Could not read from stdin: %s", err))
+			return "", STDIN_PATH, false
+		}
+
+		return string(source), STDIN_PATH, true
+	}
+
+	source, ok := shared.ReadFileErr(path)
+	if !ok {
+		shared.ReportErr(fmt.Sprintf("File '%s' does not exist.", path))
+	}
+
+	return source, path, ok
+}
+
+// Read, parse and analyse a script, reporting any problems found
+func (tiny *Tiny) load(path string, test bool) (*ast.Program, int) {
+	source, path, ok := readSource(path)
+	if !ok {
+		return nil, shared.EXIT_FAILURE
+	}
+
+	program, diagnostics := parser.New(source, path, test).Parse()
+
+	if len(diagnostics) > 0 {
+		for _, diagnostic := range diagnostics {
+			shared.Emit(diagnostic)
+		}
+		return nil, shared.EXIT_SYNTAX
+	}
+
+	if code := tiny.modules().Resolve(program, path); code != shared.EXIT_OK {
+		return nil, code
+	}
+
+	if !tiny.newAnalyser().Run(program.Body) {
+		return nil, shared.EXIT_ANALYSIS
+	}
+
+	return program, shared.EXIT_OK
+}
+
+func (tiny *Tiny) newAnalyser() *analysis.Analyser {
+	analyser := analysis.NewAnalyser(false)
+
+	// Import functions into analyser
+	analyser.DeclareNativeNs(tiny.builtins.Identifier, nativeParams(tiny.builtins))
+
+	for _, ns := range tiny.imported {
+		analyser.DeclareNativeNs(ns.Identifier, nativeParams(ns))
+	}
+
+	tiny.modules().Declare(analyser)
+
+	return analyser
+}
+
+// The parameters of each native function in a namespace, for the analyser
+func nativeParams(ns *runtime.NameSpaceValue) map[string][]string {
+	functions := make(map[string][]string)
+
+	for name, member := range ns.Members {
+		if fn, ok := member.(*runtime.NativeFunctionValue); ok {
+			functions[name] = fn.Params
+		}
+	}
+
+	return functions
+}
+
+func (tiny *Tiny) newInterpreter() *runtime.Interpreter {
+	interpreter := runtime.New()
+
+	// Import native namespace into interpreter
+	interpreter.Import(tiny.builtins.Identifier, tiny.builtins)
+
+	for _, ns := range tiny.imported {
+		interpreter.Import(ns.Identifier, ns)
+	}
+
+	interpreter.SetImporter(tiny.modules())
+
+	return interpreter
+}
+
+// The loader is created on first use, once flags have set the search path
+func (tiny *Tiny) modules() *module.Loader {
+	if tiny.loader == nil {
+		tiny.loader = module.NewLoader(tiny.searchPath, tiny.newAnalyser, tiny.newInterpreter)
+	}
+
+	return tiny.loader
+}
+
+// Compile a script, or decode it when it is already compiled bytecode
+func (tiny *Tiny) compile(path string) (*compiler.Chunk, int) {
+	if filepath.Ext(path) == ".tbc" {
+		file, err := os.Open(path)
+		if err != nil {
+			shared.ReportErr(fmt.Sprintf("File '%s' does not exist.", path))
+			return nil, shared.EXIT_FAILURE
+		}
+		defer file.Close()
+
+		chunk, err := compiler.Decode(file)
+		if err != nil {
+			shared.ReportErr(fmt.Sprintf("Could not load '%s': %s", path, err))
+			return nil, shared.EXIT_FAILURE
+		}
+
+		return chunk, shared.EXIT_OK
+	}
+
+	program, code := tiny.load(path, false)
+	if code != shared.EXIT_OK {
+		return nil, code
+	}
+
+	return compileProgram(program)
+}
+
+// Compile an analysed program, reporting anything the VM cannot run
+func compileProgram(program *ast.Program) (*compiler.Chunk, int) {
+	c := compiler.NewCompiler()
+	chunk := c.Compile(program)
+
+	if len(c.Diagnostics()) > 0 {
+		for _, diagnostic := range c.Diagnostics() {
+			shared.Emit(diagnostic)
+		}
+		return nil, shared.EXIT_ANALYSIS
+	}
+
+	return chunk, shared.EXIT_OK
+}
+
+func (tiny *Tiny) runCmd(args []string) int {
+	flags, errorFormat := tiny.newFlags("run")
+	usevm := flags.Bool("vm", false, "Use the new VM to run code (always used for .tbc files)")
+	debug := flags.Bool("d", false, "Allow debugging features")
+	step := flags.Bool("s", false, "Step through each operation and view variables, stack etc. (VM Only)")
+
+	args, code, ok := parseFlags(flags, errorFormat, args)
+	if !ok {
+		return code
+	}
+
+	path, rest, ok := scriptArgs(flags, args)
+	if !ok {
+		return shared.EXIT_FAILURE
+	}
+
+	tiny.args = rest
+
+	if *usevm || filepath.Ext(path) == ".tbc" {
+		fmt.Println("Warning: The VM is experimental and is not fully featured.")
+
+		chunk, code := tiny.compile(path)
+		if code != shared.EXIT_OK {
+			return code
+		}
+
+		return vm.NewVM(*debug, *step, chunk).Run()
+	}
+
+	program, code := tiny.load(path, false)
+	if code != shared.EXIT_OK {
+		return code
+	}
+
+	return tiny.newInterpreter().Run(program)
+}
+
+func (tiny *Tiny) checkCmd(args []string) int {
+	flags, errorFormat := tiny.newFlags("check")
+
+	args, code, ok := parseFlags(flags, errorFormat, args)
+	if !ok {
+		return code
+	}
+
+	path, _, ok := scriptArgs(flags, args)
+	if !ok {
+		return shared.EXIT_FAILURE
+	}
+
+	if _, code := tiny.load(path, false); code != shared.EXIT_OK {
+		return code
+	}
+
+	fmt.Println("Good!")
+	return shared.EXIT_OK
+}
+
+func (tiny *Tiny) dumpCmd(args []string) int {
+	flags, errorFormat := tiny.newFlags("dump")
+	format := flags.String("format", "sexp", "Output format: sexp or json")
+
+	args, code, ok := parseFlags(flags, errorFormat, args)
+	if !ok {
+		return code
+	}
+
+	if *format != "sexp" && *format != "json" {
+		shared.ReportErr(fmt.Sprintf("Unknown dump format '%s', expected 'sexp' or 'json'", *format))
+		return shared.EXIT_FAILURE
+	}
+
+	path, _, ok := scriptArgs(flags, args)
+	if !ok {
+		return shared.EXIT_FAILURE
+	}
+
+	program, code := tiny.load(path, false)
+	if code != shared.EXIT_OK {
+		return code
+	}
+
+	if *format == "sexp" {
+		fmt.Println(program.Body.AsSExp())
+		return shared.EXIT_OK
+	}
+
+	out, err := json.MarshalIndent(ast.AsJSON(program.Body), "", "  ")
+	if err != nil {
+		shared.ReportErr(fmt.Sprintf("Could not encode syntax tree: %s", err))
+		return shared.EXIT_FAILURE
+	}
+
+	fmt.Println(string(out))
+	return shared.EXIT_OK
+}
+
+func (tiny *Tiny) buildCmd(args []string) int {
+	flags, errorFormat := tiny.newFlags("build")
+	output := flags.String("o", "", "File to write to, defaults to the script's name with a .tbc extension")
+
+	args, code, ok := parseFlags(flags, errorFormat, args)
+	if !ok {
+		return code
+	}
+
+	path, _, ok := scriptArgs(flags, args)
+	if !ok {
+		return shared.EXIT_FAILURE
+	}
+
+	if len(*output) == 0 {
+		if path == "-" {
+			shared.ReportErr("Expected an output file with -o when reading from stdin")
+			return shared.EXIT_FAILURE
+		}
+
+		*output = strings.TrimSuffix(path, filepath.Ext(path)) + ".tbc"
+	}
+
+	program, code := tiny.load(path, false)
+	if code != shared.EXIT_OK {
+		return code
+	}
+
+	chunk, code := compileProgram(program)
+	if code != shared.EXIT_OK {
+		return code
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		shared.ReportErr(fmt.Sprintf("Could not create '%s': %s", *output, err))
+		return shared.EXIT_FAILURE
+	}
+	defer file.Close()
+
+	if err := chunk.Encode(file); err != nil {
+		shared.ReportErr(fmt.Sprintf("Could not write '%s': %s", *output, err))
+		return shared.EXIT_FAILURE
+	}
+
+	return shared.EXIT_OK
+}
+
+func (tiny *Tiny) disasmCmd(args []string) int {
+	flags, errorFormat := tiny.newFlags("disasm")
+
+	args, code, ok := parseFlags(flags, errorFormat, args)
+	if !ok {
+		return code
+	}
+
+	path, _, ok := scriptArgs(flags, args)
+	if !ok {
+		return shared.EXIT_FAILURE
+	}
+
+	chunk, code := tiny.compile(path)
+	if code != shared.EXIT_OK {
+		return code
+	}
+
+	chunk.Debug()
+	return shared.EXIT_OK
+}
+
+func (tiny *Tiny) fmtCmd(args []string) int {
+	flags, errorFormat := tiny.newFlags("fmt")
+	write := flags.Bool("w", false, "Write the result back to each file instead of printing it")
+
+	args, code, ok := parseFlags(flags, errorFormat, args)
+	if !ok {
+		return code
+	}
+
+	if len(args) == 0 {
+		shared.ReportErr("Expected files to format, or '-' for stdin")
+		flags.Usage()
+		return shared.EXIT_FAILURE
+	}
+
+	for _, path := range args {
+		source, name, ok := readSource(path)
+		if !ok {
+			return shared.EXIT_FAILURE
+		}
+
+		// Refuse to touch code which does not parse, as nesting may be wrong
+		if _, diagnostics := parser.New(source, name, false).Parse(); len(diagnostics) > 0 {
+			for _, diagnostic := range diagnostics {
+				shared.Emit(diagnostic)
+			}
+			return shared.EXIT_SYNTAX
+		}
+
+		formatted := Format(source)
+
+		if *write && path != "-" {
+			if err := os.WriteFile(path, []byte(formatted), 0644); err != nil {
+				shared.ReportErr(fmt.Sprintf("Could not write '%s': %s", path, err))
+				return shared.EXIT_FAILURE
+			}
+			continue
+		}
+
+		fmt.Print(formatted)
+	}
+
+	return shared.EXIT_OK
+}
@@ -0,0 +1,136 @@
+package tiny
+
+import "strings"
+
+// Tracks nesting while walking source line by line, skipping over strings
+// and comments so brackets inside them do not count
+type nesting struct {
+	// Line each unclosed bracket was opened on
+	open     []int
+	line     int
+	comments int
+	inString bool
+}
+
+// Brackets opened on the same line only indent the lines after it once
+func levels(open []int) int {
+	count := 0
+
+	for idx := range open {
+		if idx == 0 || open[idx] != open[idx-1] {
+			count++
+		}
+	}
+
+	return count
+}
+
+// Whether the next line starts inside a string or block comment
+func (n *nesting) inTrivia() bool {
+	return n.inString || n.comments > 0
+}
+
+func (n *nesting) scan(line string) {
+	defer func() { n.line++ }()
+
+	for idx := 0; idx < len(line); idx++ {
+		ch := line[idx]
+
+		switch {
+		case n.inString:
+			if ch == '"' {
+				n.inString = false
+			}
+
+		case n.comments > 0:
+			if ch == '/' && idx+1 < len(line) && line[idx+1] == '*' {
+				n.comments++
+				idx++
+			} else if ch == '*' && idx+1 < len(line) && line[idx+1] == '/' {
+				n.comments--
+				idx++
+			}
+
+		case ch == '#':
+			return
+
+		case ch == '/' && idx+1 < len(line) && line[idx+1] == '*':
+			n.comments++
+			idx++
+
+		case ch == '"':
+			n.inString = true
+
+		case ch == '{' || ch == '(' || ch == '[':
+			n.open = append(n.open, n.line)
+
+		case ch == '}' || ch == ')' || ch == ']':
+			if len(n.open) > 0 {
+				n.open = n.open[:len(n.open)-1]
+			}
+		}
+	}
+}
+
+// Format re-indents source with one tab for each line that opens brackets,
+// trims trailing whitespace and collapses runs of blank lines. Strings and
+// block comments spanning several lines are left untouched.
+func Format(source string) string {
+	var sb strings.Builder
+	state := &nesting{}
+	blank := false
+
+	for _, line := range strings.Split(source, "\n") {
+		if state.inTrivia() {
+			sb.WriteString(strings.TrimRight(line, " \t\r"))
+			sb.WriteByte('\n')
+
+			state.scan(line)
+			continue
+		}
+
+		trimmed := strings.TrimSpace(line)
+
+		if len(trimmed) == 0 {
+			blank = sb.Len() > 0
+			state.line++
+			continue
+		}
+
+		if blank {
+			sb.WriteByte('\n')
+			blank = false
+		}
+
+		// Closing brackets at the start of a line belong to the outer level
+		closed := 0
+		for closed < len(trimmed) && closed < len(state.open) && strings.IndexByte("})]", trimmed[closed]) >= 0 {
+			closed++
+		}
+
+		indent := levels(state.open[:len(state.open)-closed])
+
+		if indent > 0 {
+			sb.WriteString(strings.Repeat("\t", indent))
+		}
+
+		sb.WriteString(trimmed)
+		sb.WriteByte('\n')
+
+		state.scan(trimmed)
+	}
+
+	return sb.String()
+}
+
+// Whether the source has unclosed brackets, strings or block comments, which
+// the REPL uses to keep reading lines before running anything
+func incomplete(source string) bool {
+	state := &nesting{}
+
+	for _, line := range strings.Split(source, "\n") {
+		state.scan(line)
+	}
+
+	return len(state.open) > 0 || state.inTrivia()
+}
@@ -0,0 +1,254 @@
+package tiny
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"tiny/runtime"
+)
+
+// Failures are thrown with the message from the OS, so scripts can catch
+// them instead of the process stopping
+func fsFailed(err error) runtime.Value {
+	return runtime.NewThrow(&runtime.StringVal{Value: err.Error()})
+}
+
+// Gives back the argument as a string, reporting it as the named kind when
+// it is not one
+func pathArg(interpreter *runtime.Interpreter, value runtime.Value, kind string) string {
+	str, ok := value.(*runtime.StringVal)
+	if !ok {
+		interpreter.Report("Expected string as %s", kind)
+	}
+
+	return str.Value
+}
+
+func fileArg(interpreter *runtime.Interpreter, value runtime.Value) *runtime.FileValue {
+	file, ok := value.(*runtime.FileValue)
+	if !ok {
+		interpreter.Report("Expected file from fs.open, but received '%s'", typeName(value))
+	}
+
+	return file
+}
+
+func copyFile(from string, to string) error {
+	source, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	info, err := source.Stat()
+	if err != nil {
+		return err
+	}
+
+	dest, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(dest, source); err != nil {
+		dest.Close()
+		return err
+	}
+
+	return dest.Close()
+}
+
+// Functions for scripts to work with files and directories
+func (tiny *Tiny) createFs() {
+	tiny.AddNamespace("fs")
+	tiny.AddClass("fs", "Stat", []string{"name", "size", "is_dir", "mode", "modified"}, nil)
+
+	tiny.AddFunction("fs", "read", []string{"path"}, func(interpreter *runtime.Interpreter, values []runtime.Value) runtime.Value {
+		contents, err := os.ReadFile(pathArg(interpreter, values[0], "path"))
+		if err != nil {
+			return fsFailed(err)
+		}
+
+		return &runtime.StringVal{Value: string(contents)}
+	})
+
+	// Writes the whole file at a path, or the next piece of a file from fs.open
+	tiny.AddFunction("fs", "write", []string{"target", "contents"}, func(interpreter *runtime.Interpreter, values []runtime.Value) runtime.Value {
+		contents := pathArg(interpreter, values[1], "file contents")
+
+		if file, ok := values[0].(*runtime.FileValue); ok {
+			if err := file.Write(contents); err != nil {
+				return fsFailed(err)
+			}
+
+			return &runtime.UnitVal{}
+		}
+
+		if err := os.WriteFile(pathArg(interpreter, values[0], "path"), []byte(contents), 0644); err != nil {
+			return fsFailed(err)
+		}
+
+		return &runtime.UnitVal{}
+	})
+
+	tiny.AddFunction("fs", "append", []string{"path", "contents"}, func(interpreter *runtime.Interpreter, values []runtime.Value) runtime.Value {
+		file, err := runtime.OpenFile(pathArg(interpreter, values[0], "path"), "a")
+		if err != nil {
+			return fsFailed(err)
+		}
+
+		err = file.Write(pathArg(interpreter, values[1], "file contents"))
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+
+		if err != nil {
+			return fsFailed(err)
+		}
+
+		return &runtime.UnitVal{}
+	})
+
+	tiny.AddFunction("fs", "exists", []string{"path"}, func(interpreter *runtime.Interpreter, values []runtime.Value) runtime.Value {
+		_, err := os.Stat(pathArg(interpreter, values[0], "path"))
+		if err != nil && !os.IsNotExist(err) {
+			return fsFailed(err)
+		}
+
+		return &runtime.BoolVal{Value: err == nil}
+	})
+
+	tiny.AddFunction("fs", "stat", []string{"path"}, func(interpreter *runtime.Interpreter, values []runtime.Value) runtime.Value {
+		info, err := os.Stat(pathArg(interpreter, values[0], "path"))
+		if err != nil {
+			return fsFailed(err)
+		}
+
+		def := tiny.imported["fs"].Members["Stat"].(*runtime.NativeClassDefValue)
+
+		return def.Call(interpreter, []runtime.Value{
+			&runtime.StringVal{Value: info.Name()},
+			&runtime.IntVal{Value: int(info.Size())},
+			&runtime.BoolVal{Value: info.IsDir()},
+			&runtime.StringVal{Value: info.Mode().String()},
+			&runtime.IntVal{Value: int(info.ModTime().Unix())},
+		})
+	})
+
+	// Names are sorted, and do not include the directory
+	tiny.AddFunction("fs", "list_dir", []string{"path"}, func(interpreter *runtime.Interpreter, values []runtime.Value) runtime.Value {
+		entries, err := os.ReadDir(pathArg(interpreter, values[0], "path"))
+		if err != nil {
+			return fsFailed(err)
+		}
+
+		names := make([]runtime.Value, 0, len(entries))
+
+		for _, entry := range entries {
+			names = append(names, &runtime.StringVal{Value: entry.Name()})
+		}
+
+		return &runtime.ListVal{Values: names}
+	})
+
+	tiny.AddFunction("fs", "mkdir_all", []string{"path"}, func(interpreter *runtime.Interpreter, values []runtime.Value) runtime.Value {
+		if err := os.MkdirAll(pathArg(interpreter, values[0], "path"), 0755); err != nil {
+			return fsFailed(err)
+		}
+
+		return &runtime.UnitVal{}
+	})
+
+	// Directories must be empty, unless everything inside is removed as well
+	tiny.AddFunction("fs", "remove", []string{"path", "recursive?"}, func(interpreter *runtime.Interpreter, values []runtime.Value) runtime.Value {
+		path := pathArg(interpreter, values[0], "path")
+		remove := os.Remove
+
+		if values[1] != nil {
+			if recursive, ok := values[1].(*runtime.BoolVal); !ok {
+				interpreter.Report("Expected bool as recursive flag")
+			} else if recursive.Value {
+				// RemoveAll is quiet about missing paths, unlike Remove
+				if _, err := os.Lstat(path); err != nil {
+					return fsFailed(err)
+				}
+
+				remove = os.RemoveAll
+			}
+		}
+
+		if err := remove(path); err != nil {
+			return fsFailed(err)
+		}
+
+		return &runtime.UnitVal{}
+	})
+
+	tiny.AddFunction("fs", "rename", []string{"from", "to"}, func(interpreter *runtime.Interpreter, values []runtime.Value) runtime.Value {
+		if err := os.Rename(pathArg(interpreter, values[0], "path"), pathArg(interpreter, values[1], "path")); err != nil {
+			return fsFailed(err)
+		}
+
+		return &runtime.UnitVal{}
+	})
+
+	tiny.AddFunction("fs", "copy", []string{"from", "to"}, func(interpreter *runtime.Interpreter, values []runtime.Value) runtime.Value {
+		if err := copyFile(pathArg(interpreter, values[0], "path"), pathArg(interpreter, values[1], "path")); err != nil {
+			return fsFailed(err)
+		}
+
+		return &runtime.UnitVal{}
+	})
+
+	tiny.AddFunction("fs", "glob", []string{"pattern"}, func(interpreter *runtime.Interpreter, values []runtime.Value) runtime.Value {
+		matches, err := filepath.Glob(pathArg(interpreter, values[0], "pattern"))
+		if err != nil {
+			return fsFailed(err)
+		}
+
+		paths := make([]runtime.Value, 0, len(matches))
+
+		for _, match := range matches {
+			paths = append(paths, &runtime.StringVal{Value: match})
+		}
+
+		return &runtime.ListVal{Values: paths}
+	})
+
+	// --- Handles
+	tiny.AddFunction("fs", "open", []string{"path", "mode?"}, func(interpreter *runtime.Interpreter, values []runtime.Value) runtime.Value {
+		mode := "r"
+		if values[1] != nil {
+			mode = pathArg(interpreter, values[1], "file mode")
+		}
+
+		file, err := runtime.OpenFile(pathArg(interpreter, values[0], "path"), mode)
+		if err != nil {
+			return fsFailed(err)
+		}
+
+		return file
+	})
+
+	// Gives back unit once the file has no lines left
+	tiny.AddFunction("fs", "read_line", []string{"file"}, func(interpreter *runtime.Interpreter, values []runtime.Value) runtime.Value {
+		line, ok, err := fileArg(interpreter, values[0]).ReadLine()
+		if err != nil {
+			return fsFailed(err)
+		}
+
+		if !ok {
+			return &runtime.UnitVal{}
+		}
+
+		return &runtime.StringVal{Value: line}
+	})
+
+	tiny.AddFunction("fs", "close", []string{"file"}, func(interpreter *runtime.Interpreter, values []runtime.Value) runtime.Value {
+		if err := fileArg(interpreter, values[0]).Close(); err != nil {
+			return fsFailed(err)
+		}
+
+		return &runtime.UnitVal{}
+	})
+}
@@ -0,0 +1,81 @@
+package tiny
+
+import (
+	"os"
+	"tiny/runtime"
+)
+
+// Functions for scripts to inspect and interact with their process
+func (tiny *Tiny) createOs() {
+	tiny.AddNamespace("os")
+
+	tiny.AddFunction("os", "args", []string{}, func(interpreter *runtime.Interpreter, values []runtime.Value) runtime.Value {
+		args := make([]runtime.Value, 0, len(tiny.args))
+
+		for _, arg := range tiny.args {
+			args = append(args, &runtime.StringVal{Value: arg})
+		}
+
+		return &runtime.ListVal{Values: args}
+	})
+
+	// Variables which are not set give back the fallback, or unit without one
+	tiny.AddFunction("os", "env", []string{"name", "fallback?"}, func(interpreter *runtime.Interpreter, values []runtime.Value) runtime.Value {
+		if _, ok := values[0].(*runtime.StringVal); !ok {
+			interpreter.Report("Expected string as variable name")
+			return nil
+		}
+
+		if value, ok := os.LookupEnv(values[0].(*runtime.StringVal).Value); ok {
+			return &runtime.StringVal{Value: value}
+		}
+
+		if values[1] != nil {
+			return values[1]
+		}
+
+		return &runtime.UnitVal{}
+	})
+
+	tiny.AddFunction("os", "set_env", []string{"name", "value"}, func(interpreter *runtime.Interpreter, values []runtime.Value) runtime.Value {
+		if _, ok := values[0].(*runtime.StringVal); !ok {
+			interpreter.Report("Expected string as variable name")
+			return nil
+		}
+
+		if _, ok := values[1].(*runtime.StringVal); !ok {
+			interpreter.Report("Expected string as variable value")
+			return nil
+		}
+
+		if err := os.Setenv(values[0].(*runtime.StringVal).Value, values[1].(*runtime.StringVal).Value); err != nil {
+			return runtime.NewThrow(&runtime.StringVal{Value: err.Error()})
+		}
+
+		return &runtime.UnitVal{}
+	})
+
+	tiny.AddFunction("os", "cwd", []string{}, func(interpreter *runtime.Interpreter, values []runtime.Value) runtime.Value {
+		dir, err := os.Getwd()
+		if err != nil {
+			return runtime.NewThrow(&runtime.StringVal{Value: err.Error()})
+		}
+
+		return &runtime.StringVal{Value: dir}
+	})
+
+	tiny.AddFunction("os", "exit", []string{"code?"}, exitFn)
+
+	tiny.AddFunction("os", "hostname", []string{}, func(interpreter *runtime.Interpreter, values []runtime.Value) runtime.Value {
+		name, err := os.Hostname()
+		if err != nil {
+			return runtime.NewThrow(&runtime.StringVal{Value: err.Error()})
+		}
+
+		return &runtime.StringVal{Value: name}
+	})
+
+	tiny.AddFunction("os", "pid", []string{}, func(interpreter *runtime.Interpreter, values []runtime.Value) runtime.Value {
+		return &runtime.IntVal{Value: os.Getpid()}
+	})
+}
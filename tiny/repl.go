@@ -0,0 +1,120 @@
+package tiny
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"tiny/ast"
+	"tiny/parser"
+	"tiny/runtime"
+	"tiny/shared"
+)
+
+const REPL_PATH = "<repl>"
+
+func (tiny *Tiny) replCmd(args []string) (code int) {
+	flags, errorFormat := tiny.newFlags("repl")
+
+	if _, code, ok := parseFlags(flags, errorFormat, args); !ok {
+		return code
+	}
+
+	analyser := tiny.newAnalyser()
+	interpreter := tiny.newInterpreter()
+
+	// Scripts calling exit stop the session with their code
+	defer func() {
+		if r := recover(); r != nil {
+			code = runtime.Recover(r)
+		}
+	}()
+
+	fmt.Println("tiny repl, enter code to run it or 'exit' to leave.")
+	reader := bufio.NewScanner(os.Stdin)
+
+	var input strings.Builder
+
+	for {
+		if input.Len() == 0 {
+			fmt.Print(">> ")
+		} else {
+			fmt.Print(".. ")
+		}
+
+		if !reader.Scan() {
+			fmt.Println()
+			return shared.EXIT_OK
+		}
+
+		line := reader.Text()
+
+		if input.Len() == 0 && strings.TrimSpace(line) == "exit" {
+			return shared.EXIT_OK
+		}
+
+		input.WriteString(line)
+		input.WriteByte('\n')
+
+		// Keep reading until every bracket, string and comment is closed
+		if incomplete(input.String()) {
+			continue
+		}
+
+		source := strings.TrimSpace(input.String())
+		input.Reset()
+
+		if len(source) == 0 {
+			continue
+		}
+
+		// Allow a trailing semicolon to be left off single statements
+		if !strings.HasSuffix(source, ";") && !strings.HasSuffix(source, "}") {
+			source += ";"
+		}
+
+		program, diagnostics := parser.New(source, REPL_PATH, false).Parse()
+
+		if len(diagnostics) > 0 {
+			for _, diagnostic := range diagnostics {
+				shared.Emit(diagnostic)
+			}
+			continue
+		}
+
+		if tiny.modules().Resolve(program, REPL_PATH) != shared.EXIT_OK {
+			continue
+		}
+
+		tiny.modules().Declare(analyser)
+
+		if !analyser.Check(program.Body) {
+			continue
+		}
+
+		result, code := interpreter.Eval(program)
+		if code != shared.EXIT_OK || !showResult(program, result) {
+			continue
+		}
+
+		fmt.Println(result.Inspect())
+	}
+}
+
+// Only echo values from expressions, not the ones declarations produce
+func showResult(program *ast.Program, result runtime.Value) bool {
+	if result == nil || len(program.Body.Statements) == 0 {
+		return false
+	}
+
+	if _, ok := result.(*runtime.UnitVal); ok {
+		return false
+	}
+
+	switch program.Body.Statements[len(program.Body.Statements)-1].(type) {
+	case *ast.VariableDecl, *ast.FunctionDef, *ast.ClassDef, *ast.StructDef, *ast.EnumDef, *ast.TraitDef, *ast.NameSpace, *ast.Print, *ast.Assign:
+		return false
+	}
+
+	return true
+}
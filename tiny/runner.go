@@ -0,0 +1,337 @@
+package tiny
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"tiny/ast"
+	"tiny/shared"
+)
+
+// Files picked up when a directory is given to the test runner
+const TEST_SUFFIX = "_test.tiny"
+
+type testResult struct {
+	File     string
+	Name     string
+	Line     int
+	Failure  string
+	Duration time.Duration
+}
+
+func (result *testResult) passed() bool {
+	return len(result.Failure) == 0
+}
+
+func (tiny *Tiny) testCmd(args []string) int {
+	flags, errorFormat := tiny.newFlags("test")
+	filter := flags.String("run", "", "Only run tests with names matching this regular expression")
+	format := flags.String("format", "text", "Report format: text, tap, junit or json")
+
+	args, code, ok := parseFlags(flags, errorFormat, args)
+	if !ok {
+		return code
+	}
+
+	var report func([]*testResult)
+
+	switch *format {
+	case "text":
+		report = reportText
+	case "tap":
+		report = reportTap
+	case "junit":
+		report = reportJunit
+	case "json":
+		report = reportJson
+	default:
+		shared.ReportErr(fmt.Sprintf("Unknown test format '%s', expected 'text', 'tap', 'junit' or 'json'", *format))
+		return shared.EXIT_FAILURE
+	}
+
+	pattern, err := regexp.Compile(*filter)
+	if err != nil {
+		shared.ReportErr(fmt.Sprintf("Invalid pattern for --run: %s", err))
+		return shared.EXIT_FAILURE
+	}
+
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+
+	files, ok := discoverTests(args)
+	if !ok {
+		return shared.EXIT_FAILURE
+	}
+
+	results := make([]*testResult, 0, 16)
+	status := shared.EXIT_OK
+
+	for _, file := range files {
+		fileResults, code := tiny.runTests(file, pattern)
+
+		// Keep going so one broken file does not hide the others, but report
+		// the first file which could not be loaded over failing tests
+		if code != shared.EXIT_OK && status == shared.EXIT_OK {
+			status = code
+		}
+
+		results = append(results, fileResults...)
+	}
+
+	report(results)
+
+	if status != shared.EXIT_OK {
+		return status
+	}
+
+	for _, result := range results {
+		if !result.passed() {
+			return shared.EXIT_TEST
+		}
+	}
+
+	return shared.EXIT_OK
+}
+
+// Expand directories into the test files inside them, keeping files as given
+func discoverTests(paths []string) ([]string, bool) {
+	files := make([]string, 0, len(paths))
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+
+		if path == "-" || (err == nil && !info.IsDir()) {
+			files = append(files, path)
+			continue
+		}
+
+		if err != nil {
+			shared.ReportErr(fmt.Sprintf("File '%s' does not exist.", path))
+			return nil, false
+		}
+
+		err = filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if !entry.IsDir() && strings.HasSuffix(file, TEST_SUFFIX) {
+				files = append(files, file)
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			shared.ReportErr(fmt.Sprintf("Could not search '%s': %s", path, err))
+			return nil, false
+		}
+	}
+
+	return files, true
+}
+
+// Run each test in a file on a fresh interpreter, so state from one test
+// cannot leak into the next. Declarations outside of tests are run first.
+func (tiny *Tiny) runTests(path string, pattern *regexp.Regexp) ([]*testResult, int) {
+	program, code := tiny.load(path, true)
+	if code != shared.EXIT_OK {
+		return nil, code
+	}
+
+	if path == "-" {
+		path = STDIN_PATH
+	}
+
+	setup := &ast.Program{Body: &ast.Block{Statements: make([]ast.Node, 0, len(program.Body.Statements))}}
+	tests := make([]*ast.Test, 0, 8)
+
+	for _, stmt := range program.Body.Statements {
+		if test, ok := stmt.(*ast.Test); ok {
+			if pattern.MatchString(test.Token.Lexeme) {
+				tests = append(tests, test)
+			}
+			continue
+		}
+
+		setup.Body.Statements = append(setup.Body.Statements, stmt)
+	}
+
+	results := make([]*testResult, 0, len(tests))
+
+	for _, test := range tests {
+		result := &testResult{File: path, Name: test.Token.Lexeme, Line: test.Token.Line}
+		start := time.Now()
+
+		// Modules run again for each test, so their state is not shared
+		tiny.modules().Reset()
+		interpreter := tiny.newInterpreter()
+
+		if _, code := interpreter.Eval(setup); code != shared.EXIT_OK {
+			result.Failure = fmt.Sprintf("'%s' failed: could not run declarations in '%s'", test.Token.Lexeme, path)
+		} else {
+			result.Failure = interpreter.RunTest(test)
+		}
+
+		result.Duration = time.Since(start)
+		results = append(results, result)
+	}
+
+	return results, shared.EXIT_OK
+}
+
+func countPassed(results []*testResult) int {
+	passed := 0
+
+	for _, result := range results {
+		if result.passed() {
+			passed++
+		}
+	}
+
+	return passed
+}
+
+func reportText(results []*testResult) {
+	for _, result := range results {
+		if result.passed() {
+			fmt.Printf("--- PASS: %s (%s) [%.3fs]\n", result.Name, result.File, result.Duration.Seconds())
+		} else {
+			fmt.Printf("--- FAIL: %s (%s:%d) [%.3fs]\n\t%s\n", result.Name, result.File, result.Line, result.Duration.Seconds(), result.Failure)
+		}
+	}
+
+	fmt.Printf("Tests passed [%d/%d]\n", countPassed(results), len(results))
+}
+
+func reportTap(results []*testResult) {
+	var sb strings.Builder
+
+	sb.WriteString("TAP version 13\n")
+	sb.WriteString(fmt.Sprintf("1..%d\n", len(results)))
+
+	for idx, result := range results {
+		if result.passed() {
+			sb.WriteString(fmt.Sprintf("ok %d - %s\n", idx+1, result.Name))
+		} else {
+			sb.WriteString(fmt.Sprintf("not ok %d - %s\n", idx+1, result.Name))
+		}
+
+		sb.WriteString("  ---\n")
+		if !result.passed() {
+			sb.WriteString(fmt.Sprintf("  message: %s\n", jsonString(result.Failure)))
+		}
+		sb.WriteString(fmt.Sprintf("  file: %s\n", jsonString(result.File)))
+		sb.WriteString(fmt.Sprintf("  line: %d\n", result.Line))
+		sb.WriteString(fmt.Sprintf("  duration_ms: %.3f\n", float64(result.Duration.Microseconds())/1000))
+		sb.WriteString("  ...\n")
+	}
+
+	fmt.Print(sb.String())
+}
+
+// JSON strings are valid YAML, so they are used to quote TAP diagnostics
+func jsonString(value string) string {
+	out, _ := json.Marshal(value)
+	return string(out)
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitSuite struct {
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Time     string       `xml:"time,attr"`
+	Cases    []*junitCase `xml:"testcase"`
+}
+
+type junitSuites struct {
+	XMLName  xml.Name      `xml:"testsuites"`
+	Tests    int           `xml:"tests,attr"`
+	Failures int           `xml:"failures,attr"`
+	Suites   []*junitSuite `xml:"testsuite"`
+}
+
+func reportJunit(results []*testResult) {
+	suites := &junitSuites{Tests: len(results), Failures: len(results) - countPassed(results)}
+	byFile := make(map[string]*junitSuite)
+	durations := make(map[*junitSuite]time.Duration)
+
+	for _, result := range results {
+		suite, ok := byFile[result.File]
+		if !ok {
+			suite = &junitSuite{Name: result.File}
+			byFile[result.File] = suite
+			suites.Suites = append(suites.Suites, suite)
+		}
+
+		test := &junitCase{Name: result.Name, ClassName: result.File, Time: fmt.Sprintf("%.3f", result.Duration.Seconds())}
+
+		if !result.passed() {
+			test.Failure = &junitFailure{Message: result.Failure, Text: fmt.Sprintf("%s:%d: %s", result.File, result.Line, result.Failure)}
+			suite.Failures++
+		}
+
+		suite.Tests++
+		suite.Cases = append(suite.Cases, test)
+		durations[suite] += result.Duration
+	}
+
+	for _, suite := range suites.Suites {
+		suite.Time = fmt.Sprintf("%.3f", durations[suite].Seconds())
+	}
+
+	out, _ := xml.MarshalIndent(suites, "", "  ")
+	fmt.Println(xml.Header + string(out))
+}
+
+type jsonResult struct {
+	File       string  `json:"file"`
+	Name       string  `json:"name"`
+	Line       int     `json:"line"`
+	Passed     bool    `json:"passed"`
+	Failure    string  `json:"failure,omitempty"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+func reportJson(results []*testResult) {
+	tests := make([]*jsonResult, 0, len(results))
+
+	for _, result := range results {
+		tests = append(tests, &jsonResult{
+			File:       result.File,
+			Name:       result.Name,
+			Line:       result.Line,
+			Passed:     result.passed(),
+			Failure:    result.Failure,
+			DurationMs: float64(result.Duration.Microseconds()) / 1000,
+		})
+	}
+
+	passed := countPassed(results)
+
+	out, _ := json.MarshalIndent(map[string]any{
+		"passed": passed,
+		"failed": len(results) - passed,
+		"tests":  tests,
+	}, "", "  ")
+	fmt.Println(string(out))
+}
@@ -2,24 +2,25 @@ package tiny
 
 import (
 	"bufio"
-	"flag"
 	"fmt"
 	"math/rand"
 	"os"
 	"strconv"
 	"strings"
 	"time"
-	"tiny/analysis"
-	"tiny/compiler"
-	"tiny/parser"
+	"tiny/module"
 	"tiny/runtime"
 	"tiny/shared"
-	"tiny/vm"
+	"unicode/utf8"
 )
 
 type Tiny struct {
 	builtins *runtime.NameSpaceValue
 	imported map[string]*runtime.NameSpaceValue
+	// Arguments given to the script after '--'
+	args       []string
+	searchPath []string
+	loader     *module.Loader
 }
 
 func New() *Tiny {
@@ -44,82 +45,31 @@ func (tiny *Tiny) AddFunction(namespace string, identifier string, params []stri
 	tiny.imported[namespace].Members[identifier] = runtime.NewFnValue(identifier, params, fn)
 }
 
-func (tiny *Tiny) Run() {
-	var (
-		checkOnly bool
-		usevm     bool
-		debug     bool
-		step      bool
-		test      bool
-		dump      bool
-		script    string
-	)
-
-	flag.BoolVar(&checkOnly, "check", false, "Checks if code is valid and does not run")
-	flag.BoolVar(&test, "test", false, "Run tests")
-	flag.BoolVar(&usevm, "vm", false, "Use the new VM to run code")
-	flag.BoolVar(&debug, "d", false, "Allow debugging features")
-	flag.BoolVar(&step, "s", false, "Step through each operation and view variables, stack etc. (VM Only)")
-	flag.BoolVar(&dump, "dump", false, "Dumps the AST in a lisp-like representation")
-	flag.StringVar(&script, "script", "", "Script to run")
-	flag.Parse()
-
-	if len(script) == 0 {
-		fmt.Println("usage: tiny [-script][-check]")
-		return
+// Run the command line with the given arguments, returning the status the
+// process should exit with
+func (tiny *Tiny) Run(args []string) int {
+	if len(args) == 0 {
+		usage()
+		return shared.EXIT_FAILURE
 	}
 
-	if source, ok := shared.ReadFileErr(script); ok {
-		parser := parser.New(source, script, test)
-		program := parser.Parse()
-		analyser := analysis.NewAnalyser(false)
+	tiny.createBuiltins()
+	tiny.createOs()
+	tiny.createFs()
+	tiny.createAssert()
 
-		tiny.createBuiltins()
-
-		// Import functions into analyser
-		analyser.DeclareNativeNs(tiny.builtins.Identifier)
-
-		for _, ns := range tiny.imported {
-			analyser.DeclareNativeNs(ns.Identifier)
-		}
-
-		if !analyser.Run(program.Body) {
-			return
-		}
-
-		if dump {
-			fmt.Println(program.Body.AsSExp())
-			return
-		}
-
-		if !checkOnly {
-			interpreter := runtime.New()
-
-			// Import native namespace into interpreter
-			interpreter.Import(tiny.builtins.Identifier, tiny.builtins)
-
-			for _, ns := range tiny.imported {
-				interpreter.Import(ns.Identifier, ns)
-			}
-
-			if usevm {
-				fmt.Println("Warning: The VM is experimental and is not fully featured.")
-
-				compiler := compiler.NewCompiler()
-				chunk := compiler.Compile(program)
-
-				vm := vm.NewVM(debug, step, chunk)
-				vm.Run()
-			} else {
-				interpreter.Run(program)
-			}
+	if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		return tiny.helpCmd(args[1:])
+	}
 
-		} else {
-			fmt.Println("Good!")
-		}
-	} else {
-		shared.ReportErrFatal(fmt.Sprintf("File '%s' does not exist.", os.Args[1]))
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		shared.ReportErr(fmt.Sprintf("Unknown command '%s'", args[0]))
+		usage()
+		return shared.EXIT_FAILURE
 	}
+
+	return cmd.run(tiny, args[1:])
 }
 
 // --- Private ---
@@ -144,6 +94,73 @@ func (tiny *Tiny) addBuiltinFn(identifier string, params []string, fn runtime.Na
 	tiny.builtins.Members[identifier] = runtime.NewFnValue(identifier, params, fn)
 }
 
+// Name of a value's type, as seen by scripts
+func typeName(value runtime.Value) string {
+	switch obj := value.(type) {
+	case *runtime.UnitVal:
+		return "unit"
+	case *runtime.IntVal:
+		return "int"
+	case *runtime.FloatVal:
+		return "float"
+	case *runtime.BoolVal:
+		return "bool"
+	case *runtime.StringVal:
+		return "string"
+	case *runtime.FunctionValue:
+		return "function"
+	case *runtime.AnonFunctionValue:
+		return "anon fn"
+	case *runtime.NativeFunctionValue:
+		return "native fn"
+	case *runtime.NativeClassDefValue:
+		return "native class"
+	case *runtime.FileValue:
+		return "file"
+	case *runtime.ClassDefValue:
+		return "class"
+	case *runtime.ClassInstanceValue:
+		return obj.Definition()
+	case *runtime.StructDefValue:
+		return "struct"
+	case *runtime.StructInstanceValue:
+		return obj.Definition()
+	case *runtime.EnumDefValue:
+		return "enum"
+	case *runtime.EnumVariantValue:
+		return "variant"
+	case *runtime.EnumVal:
+		return obj.Definition()
+	case *runtime.TraitValue:
+		return "trait"
+	case *runtime.NameSpaceValue:
+		return obj.Identifier
+	case *runtime.ListVal:
+		return "list"
+	case *runtime.RangeVal:
+		return "range"
+	case *runtime.IteratorValue:
+		return "iterator"
+	}
+
+	return "unknown"
+}
+
+// Exit with the code given, or successfully when there is none
+func exitFn(interpreter *runtime.Interpreter, values []runtime.Value) runtime.Value {
+	if values[0] == nil {
+		interpreter.Exit(shared.EXIT_OK)
+	}
+
+	if _, ok := values[0].(*runtime.IntVal); !ok {
+		interpreter.Report("Expected int as exit code")
+		return nil
+	}
+
+	interpreter.Exit(values[0].(*runtime.IntVal).Value)
+	return &runtime.UnitVal{}
+}
+
 func (tiny *Tiny) createBuiltins() {
 	// --- Error Handling
 	tiny.addBuiltinFn("assert", []string{"expr"}, func(interpreter *runtime.Interpreter, values []runtime.Value) runtime.Value {
@@ -184,40 +201,7 @@ func (tiny *Tiny) createBuiltins() {
 	})
 
 	tiny.addBuiltinFn("type_name", []string{"object"}, func(interpreter *runtime.Interpreter, values []runtime.Value) runtime.Value {
-		switch obj := values[0].(type) {
-		case *runtime.UnitVal:
-			return &runtime.StringVal{Value: "unit"}
-		case *runtime.IntVal:
-			return &runtime.StringVal{Value: "int"}
-		case *runtime.FloatVal:
-			return &runtime.StringVal{Value: "float"}
-		case *runtime.BoolVal:
-			return &runtime.StringVal{Value: "bool"}
-		case *runtime.StringVal:
-			return &runtime.StringVal{Value: "string"}
-		case *runtime.FunctionValue:
-			return &runtime.StringVal{Value: "function"}
-		case *runtime.AnonFunctionValue:
-			return &runtime.StringVal{Value: "anon fn"}
-		case *runtime.NativeFunctionValue:
-			return &runtime.StringVal{Value: "native fn"}
-		case *runtime.NativeClassDefValue:
-			return &runtime.StringVal{Value: "native class"}
-		case *runtime.ClassDefValue:
-			return &runtime.StringVal{Value: "class"}
-		case *runtime.ClassInstanceValue:
-			return &runtime.StringVal{Value: obj.Definition()}
-		case *runtime.StructDefValue:
-			return &runtime.StringVal{Value: "struct"}
-		case *runtime.StructInstanceValue:
-			return &runtime.StringVal{Value: obj.Definition()}
-		case *runtime.NameSpaceValue:
-			return &runtime.StringVal{Value: obj.Identifier}
-		case *runtime.ListVal:
-			return &runtime.StringVal{Value: "list"}
-		}
-
-		return &runtime.StringVal{Value: "unknown"}
+		return &runtime.StringVal{Value: typeName(values[0])}
 	})
 
 	tiny.addBuiltinFn("is_callable", []string{"object"}, func(interpreter *runtime.Interpreter, values []runtime.Value) runtime.Value {
@@ -255,6 +239,16 @@ func (tiny *Tiny) createBuiltins() {
 		return &runtime.BoolVal{Value: false}
 	})
 
+	tiny.addBuiltinFn("implements", []string{"object", "trait"}, func(interpreter *runtime.Interpreter, values []runtime.Value) runtime.Value {
+		trait, ok := values[1].(*runtime.TraitValue)
+		if !ok {
+			interpreter.Report("builtin.implements expected a trait, but received '%s'", values[1].Inspect())
+			return nil
+		}
+
+		return &runtime.BoolVal{Value: runtime.Implements(values[0], trait)}
+	})
+
 	// --- IO
 	tiny.addBuiltinFn("read_line", []string{}, func(interpreter *runtime.Interpreter, values []runtime.Value) runtime.Value {
 		txt, _ := bufio.NewReader(os.Stdin).ReadString('\n')
@@ -271,8 +265,10 @@ func (tiny *Tiny) createBuiltins() {
 		if fileName, ok := values[0].(*runtime.StringVal); !ok {
 			interpreter.Report("Expected string as filename")
 			return nil
+		} else if contents, err := os.ReadFile(fileName.Value); err != nil {
+			return runtime.NewThrow(&runtime.StringVal{Value: err.Error()})
 		} else {
-			return &runtime.StringVal{Value: shared.ReadFile(fileName.Value)}
+			return &runtime.StringVal{Value: string(contents)}
 		}
 	})
 
@@ -372,6 +368,10 @@ func (tiny *Tiny) createBuiltins() {
 	})
 
 	tiny.addBuiltinFn("to_string", []string{"value"}, func(interpreter *runtime.Interpreter, values []runtime.Value) runtime.Value {
+		if str, ok := runtime.Overload(values[0], "__str__"); ok {
+			return str
+		}
+
 		switch value := values[0].(type) {
 		case *runtime.IntVal:
 			return &runtime.StringVal{Value: value.Inspect()}
@@ -379,6 +379,10 @@ func (tiny *Tiny) createBuiltins() {
 			return &runtime.StringVal{Value: value.Inspect()}
 		case *runtime.BoolVal:
 			return &runtime.StringVal{Value: value.Inspect()}
+		case *runtime.EnumVal:
+			return &runtime.StringVal{Value: value.Inspect()}
+		case *runtime.RangeVal:
+			return &runtime.StringVal{Value: value.Inspect()}
 		case *runtime.StringVal:
 			return value
 		}
@@ -417,8 +421,23 @@ func (tiny *Tiny) createBuiltins() {
 		return &runtime.UnitVal{}
 	})
 
-	tiny.addBuiltinFn("out", []string{"value"}, func(interpreter *runtime.Interpreter, values []runtime.Value) runtime.Value {
-		fmt.Print(values[0].Inspect())
+	tiny.addBuiltinFn("exit", []string{"code?"}, exitFn)
+
+	// Runs separately from the caller, giving back a namespace of what the source declares
+	tiny.addBuiltinFn("eval", []string{"source"}, func(interpreter *runtime.Interpreter, values []runtime.Value) runtime.Value {
+		if _, ok := values[0].(*runtime.StringVal); !ok {
+			interpreter.Report("Expected string as source to evaluate")
+			return nil
+		}
+
+		return tiny.modules().Eval(values[0].(*runtime.StringVal).Value)
+	})
+
+	// Like print, but without the newline
+	tiny.addBuiltinFn("out", []string{"...values"}, func(interpreter *runtime.Interpreter, values []runtime.Value) runtime.Value {
+		for _, value := range values[0].(*runtime.ListVal).Values {
+			fmt.Print(value.Inspect())
+		}
 
 		return &runtime.UnitVal{}
 	})
@@ -452,6 +471,10 @@ func (tiny *Tiny) createBuiltins() {
 		}
 
 		list := values[0].(*runtime.ListVal)
+		if list.Frozen() {
+			return runtime.FrozenError(list)
+		}
+
 		list.Values = append(list.Values, values[1].Copy())
 
 		return &runtime.UnitVal{}
@@ -471,6 +494,10 @@ func (tiny *Tiny) createBuiltins() {
 		indexer_int := values[1].(*runtime.IntVal).Value
 		list := values[0].(*runtime.ListVal)
 
+		if list.Frozen() {
+			return runtime.FrozenError(list)
+		}
+
 		if indexer_int < 0 || indexer_int >= len(list.Values) {
 			return &runtime.UnitVal{}
 		}
@@ -487,6 +514,10 @@ func (tiny *Tiny) createBuiltins() {
 
 		list := values[0].(*runtime.ListVal)
 
+		if list.Frozen() {
+			return runtime.FrozenError(list)
+		}
+
 		if len(list.Values) == 0 {
 			return &runtime.UnitVal{}
 		}
@@ -497,6 +528,14 @@ func (tiny *Tiny) createBuiltins() {
 		return value
 	})
 
+	tiny.addBuiltinFn("freeze", []string{"value"}, func(interpreter *runtime.Interpreter, values []runtime.Value) runtime.Value {
+		return runtime.Freeze(values[0])
+	})
+
+	tiny.addBuiltinFn("is_frozen", []string{"value"}, func(interpreter *runtime.Interpreter, values []runtime.Value) runtime.Value {
+		return &runtime.BoolVal{Value: runtime.IsFrozen(values[0])}
+	})
+
 	tiny.addBuiltinFn("is_err", []string{"value"}, func(interpreter *runtime.Interpreter, values []runtime.Value) runtime.Value {
 		_, ok := values[0].(*runtime.ThrowValue)
 		return &runtime.BoolVal{Value: ok}
@@ -510,9 +549,13 @@ func (tiny *Tiny) createBuiltins() {
 	})
 
 	tiny.addBuiltinFn("len", []string{"value"}, func(interpreter *runtime.Interpreter, values []runtime.Value) runtime.Value {
+		if length, ok := runtime.Overload(values[0], "__len__"); ok {
+			return length
+		}
+
 		switch value := values[0].(type) {
 		case *runtime.StringVal:
-			return &runtime.IntVal{Value: len(value.Value)}
+			return &runtime.IntVal{Value: utf8.RuneCountInString(value.Value)}
 		case *runtime.ListVal:
 			return &runtime.IntVal{Value: len(value.Values)}
 		}
@@ -0,0 +1,344 @@
+package tiny
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"tiny/shared"
+)
+
+func run(t *testing.T, expected int, args ...string) {
+	if code := New().Run(args); code != expected {
+		t.Fatalf("%v: Expected exit code '%d' but received '%d'", args, expected, code)
+	}
+}
+
+// Run a command which should fail, checking the error it reports as well as
+// the exit code
+func runReports(t *testing.T, expected int, message string, args ...string) {
+	read, write, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := make(chan string)
+	go func() {
+		reported, _ := io.ReadAll(read)
+		output <- string(reported)
+	}()
+
+	stderr := os.Stderr
+	os.Stderr = write
+	code := New().Run(args)
+	os.Stderr = stderr
+	write.Close()
+
+	reported := <-output
+
+	if code != expected {
+		t.Fatalf("%v: Expected exit code '%d' but received '%d'", args, expected, code)
+	}
+
+	if !strings.Contains(reported, message) {
+		t.Fatalf("%v: Expected error '%s' but received:\n%s", args, message, reported)
+	}
+}
+
+func TestExitOk(t *testing.T) {
+	run(t, shared.EXIT_OK, "run", "../tests/exit/ok.tiny")
+	run(t, shared.EXIT_OK, "check", "../tests/exit/ok.tiny")
+}
+
+func TestExitMissingFile(t *testing.T) {
+	run(t, shared.EXIT_FAILURE, "run", "../tests/exit/does_not_exist.tiny")
+}
+
+func TestExitSyntax(t *testing.T) {
+	run(t, shared.EXIT_SYNTAX, "run", "../tests/exit/syntax.tiny")
+}
+
+func TestExitAnalysis(t *testing.T) {
+	run(t, shared.EXIT_ANALYSIS, "run", "../tests/exit/analysis.tiny")
+}
+
+func TestExitRuntime(t *testing.T) {
+	run(t, shared.EXIT_RUNTIME, "run", "../tests/exit/runtime.tiny")
+}
+
+func TestExitUncaughtThrow(t *testing.T) {
+	run(t, shared.EXIT_THROW, "run", "../tests/exit/throw.tiny")
+}
+
+func TestExitFailedTests(t *testing.T) {
+	run(t, shared.EXIT_TEST, "test", "../tests/exit/failing_test.tiny")
+}
+
+func TestExitBuiltin(t *testing.T) {
+	run(t, 7, "run", "../tests/exit/exit.tiny")
+}
+
+func TestCommands(t *testing.T) {
+	run(t, shared.EXIT_FAILURE)
+	run(t, shared.EXIT_FAILURE, "unknown")
+	run(t, shared.EXIT_OK, "help")
+	run(t, shared.EXIT_OK, "help", "run")
+	run(t, shared.EXIT_OK, "dump", "-h")
+	run(t, shared.EXIT_OK, "dump", "--format=json", "../tests/exit/ok.tiny")
+	run(t, shared.EXIT_FAILURE, "dump", "--format=xml", "../tests/exit/ok.tiny")
+	run(t, shared.EXIT_FAILURE, "run")
+}
+
+func TestBuild(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "ok.tbc")
+
+	run(t, shared.EXIT_OK, "build", "-o", output, "../tests/exit/ok.tiny")
+	run(t, shared.EXIT_OK, "disasm", output)
+	run(t, shared.EXIT_OK, "run", output)
+}
+
+func TestFormat(t *testing.T) {
+	source := shared.ReadFile("../tests/valid/fmt/input.tiny")
+	expected := shared.ReadFile("../tests/valid/fmt/expected.tiny")
+
+	if formatted := Format(source); formatted != expected {
+		t.Fatalf("Expected formatted source:\n%s\nbut received:\n%s", expected, formatted)
+	}
+
+	if formatted := Format(expected); formatted != expected {
+		t.Fatalf("Formatting is not stable, received:\n%s", formatted)
+	}
+}
+
+func TestScriptArgs(t *testing.T) {
+	tiny := New()
+
+	if code := tiny.Run([]string{"run", "../tests/exit/ok.tiny", "--", "a", "-b"}); code != shared.EXIT_OK {
+		t.Fatalf("Expected exit code '%d' but received '%d'", shared.EXIT_OK, code)
+	}
+
+	if len(tiny.args) != 2 || tiny.args[0] != "a" || tiny.args[1] != "-b" {
+		t.Fatalf("Expected script arguments [a -b] but received %v", tiny.args)
+	}
+}
+
+func TestStdin(t *testing.T) {
+	file, err := os.Open("../tests/exit/throw.tiny")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	stdin := os.Stdin
+	os.Stdin = file
+	defer func() { os.Stdin = stdin }()
+
+	run(t, shared.EXIT_THROW, "run", "-")
+}
+
+func TestOsNamespace(t *testing.T) {
+	run(t, 9, "run", "../tests/valid/os/os.tiny", "--", "first", "--second")
+}
+
+func TestRunner(t *testing.T) {
+	run(t, shared.EXIT_OK, "test", "../tests/valid/runner")
+	run(t, shared.EXIT_TEST, "test", "../tests/exit")
+	run(t, shared.EXIT_OK, "test", "--run", "^passes$", "../tests/exit/failing_test.tiny")
+	run(t, shared.EXIT_FAILURE, "test", "--run", "(", "../tests/exit/failing_test.tiny")
+	run(t, shared.EXIT_FAILURE, "test", "--format=xml", "../tests/exit/failing_test.tiny")
+
+	for _, format := range []string{"text", "tap", "junit", "json"} {
+		run(t, shared.EXIT_TEST, "test", "--format="+format, "../tests/exit/failing_test.tiny")
+	}
+}
+
+func TestModules(t *testing.T) {
+	run(t, shared.EXIT_OK, "test", "../tests/valid/modules")
+	run(t, shared.EXIT_OK, "run", "--path", "../tests/valid/modules/lib", "../tests/valid/modules/search.tiny")
+	run(t, shared.EXIT_ANALYSIS, "run", "../tests/valid/modules/search.tiny")
+	run(t, shared.EXIT_ANALYSIS, "run", "../tests/invalid/modules/private.tiny")
+	run(t, shared.EXIT_ANALYSIS, "run", "../tests/invalid/modules/missing.tiny")
+	run(t, shared.EXIT_ANALYSIS, "check", "../tests/invalid/modules/cycle/a.tiny")
+}
+
+func TestDynamicImport(t *testing.T) {
+	run(t, shared.EXIT_OK, "test", "../tests/valid/import")
+}
+
+// What an invalid fixture must report when it is checked or run
+type reported struct {
+	code     int
+	messages []string
+}
+
+// Each feature keeps its fixtures in tests/valid/<name> and tests/invalid/<name>
+type feature struct {
+	name string
+	// What each invalid fixture reports, by file name
+	invalid map[string]reported
+	// Fixtures which must also behave the same on the VM, from tests/
+	vm []string
+}
+
+var features = []feature{
+	{name: "destructuring", invalid: map[string]reported{
+		"analysis.tiny": {shared.EXIT_ANALYSIS, []string{"Cannot destructure 3 value(s) into 2 name(s)."}},
+		"runtime.tiny":  {shared.EXIT_RUNTIME, []string{"Cannot destructure 3 value(s) into 2 name(s)"}},
+	}, vm: []string{"valid/destructuring/swap.tiny", "invalid/destructuring/runtime.tiny"}},
+	{name: "params", invalid: map[string]reported{
+		"analysis.tiny": {shared.EXIT_ANALYSIS, []string{"Function 'greet' is missing an argument for 'name'."}},
+		"runtime.tiny":  {shared.EXIT_RUNTIME, []string{"Function 'fn' is missing an argument for 'name'"}},
+		"vm.tiny": {shared.EXIT_ANALYSIS, []string{
+			"Named argument 'name' is not supported when compiling.",
+			"Default value for 'greeting' is not supported when compiling.",
+		}},
+	}},
+	{name: "enums", invalid: map[string]reported{
+		"analysis.tiny": {shared.EXIT_ANALYSIS, []string{"Enum 'Shape' has no variant 'Square'"}},
+		"runtime.tiny":  {shared.EXIT_RUNTIME, []string{"Variant 'Shape.Rect' has 2 field(s) but 1 name(s) were given"}},
+	}},
+	{name: "traits", invalid: map[string]reported{
+		"analysis.tiny": {shared.EXIT_ANALYSIS, []string{"Class 'Square' does not implement 'scale' required by trait 'Shape'."}},
+		"runtime.tiny":  {shared.EXIT_RUNTIME, []string{"Class 'Square' does not implement 'area' required by trait 'Shape'"}},
+	}},
+	{name: "operators", invalid: map[string]reported{
+		"analysis.tiny": {shared.EXIT_ANALYSIS, []string{"Special method '__add__' must take 1 parameter(s)."}},
+	}},
+	{name: "loops", invalid: map[string]reported{
+		"analysis.tiny": {shared.EXIT_ANALYSIS, []string{"Cannot assign to immutable value 'x'."}},
+		"runtime.tiny":  {shared.EXIT_RUNTIME, []string{"Cannot iterate over '12'"}},
+	}},
+	{name: "ranges", invalid: map[string]reported{
+		"analysis.tiny": {shared.EXIT_ANALYSIS, []string{"Range step cannot be 0."}},
+		"runtime.tiny":  {shared.EXIT_RUNTIME, []string{"Range step cannot be 0"}},
+	}},
+	{name: "generators", invalid: map[string]reported{
+		"analysis.tiny": {shared.EXIT_ANALYSIS, []string{"Cannot use 'yield' outside of a function."}},
+		"runtime.tiny":  {shared.EXIT_RUNTIME, []string{"Invalid binary operation 'value / 2'"}},
+	}},
+	{name: "defer", invalid: map[string]reported{
+		"analysis.tiny": {shared.EXIT_ANALYSIS, []string{"Cannot use 'defer' outside of a function."}},
+		"runtime.tiny":  {shared.EXIT_RUNTIME, []string{"Cannot defer outside of a function"}},
+		"vm.tiny":       {shared.EXIT_ANALYSIS, []string{"Cannot defer inside a nested block when compiling."}},
+	}},
+	{name: "pipeline"},
+	{name: "optional", invalid: map[string]reported{
+		"analysis.tiny": {shared.EXIT_ANALYSIS, []string{"Cannot assign through '?.', as there may be nothing to assign to."}},
+		"runtime.tiny":  {shared.EXIT_RUNTIME, []string{"Cannot get 'value' from unit"}},
+	}},
+	{name: "const", invalid: map[string]reported{
+		"analysis.tiny": {shared.EXIT_ANALYSIS, []string{"Constant 'WIDTH' must be known before running, but 'width' is not."}},
+		"runtime.tiny":  {shared.EXIT_THROW, []string{"Uncaught value thrown 'Cannot modify frozen list'"}},
+	}},
+	{name: "static", invalid: map[string]reported{
+		"analysis.tiny": {shared.EXIT_ANALYSIS, []string{
+			"Getter 'value' must take 0 parameter(s), but takes 1.",
+			"Static member 'total' must be accessed through the class 'Counter'",
+		}},
+		"runtime.tiny":  {shared.EXIT_RUNTIME, []string{"Property 'area' of 'Circle' has a getter but no setter"}},
+		"instance.tiny": {shared.EXIT_RUNTIME, []string{"Static member 'created' must be accessed through the class 'Clock'"}},
+	}},
+	{name: "visibility", invalid: map[string]reported{
+		"analysis.tiny": {shared.EXIT_ANALYSIS, []string{"'opened' is private to class 'Account'."}},
+		"runtime.tiny":  {shared.EXIT_RUNTIME, []string{"'balance' is private to class 'Account'"}},
+		"callback.tiny": {shared.EXIT_RUNTIME, []string{"'secret' is private to class 'Vault'"}},
+	}},
+	{name: "fs", invalid: map[string]reported{
+		"runtime.tiny": {shared.EXIT_THROW, []string{"no such file or directory"}},
+	}},
+}
+
+// Fixtures are used as their name says: analysis.tiny is only checked,
+// vm.tiny runs on the VM and the rest run as they are
+func fixtureArgs(path string) []string {
+	switch filepath.Base(path) {
+	case "analysis.tiny":
+		return []string{"check", path}
+	case "vm.tiny":
+		return []string{"run", "--vm", path}
+	}
+
+	return []string{"run", path}
+}
+
+func fixtures(t *testing.T, dir string) []string {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.tiny"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return paths
+}
+
+// Every feature's tests pass and its other valid scripts run, while each
+// invalid fixture fails with what it is expected to report
+func TestFixtures(t *testing.T) {
+	for _, feature := range features {
+		t.Run(feature.name, func(t *testing.T) {
+			valid := filepath.Join("../tests/valid", feature.name)
+			run(t, shared.EXIT_OK, "test", valid)
+
+			for _, path := range fixtures(t, valid) {
+				if !strings.HasSuffix(path, "_test.tiny") {
+					run(t, shared.EXIT_OK, fixtureArgs(path)...)
+				}
+			}
+
+			invalid := fixtures(t, filepath.Join("../tests/invalid", feature.name))
+			if len(invalid) != len(feature.invalid) {
+				t.Fatalf("Expected %d invalid fixture(s) but found %v", len(feature.invalid), invalid)
+			}
+
+			for _, path := range invalid {
+				expected, ok := feature.invalid[filepath.Base(path)]
+				if !ok {
+					t.Fatalf("Nothing is expected of invalid fixture '%s'", path)
+				}
+
+				for _, message := range expected.messages {
+					runReports(t, expected.code, message, fixtureArgs(path)...)
+				}
+			}
+
+			for _, name := range feature.vm {
+				path := filepath.Join("../tests", name)
+
+				if !strings.HasPrefix(name, "invalid/") {
+					run(t, shared.EXIT_OK, "run", "--vm", path)
+					continue
+				}
+
+				expected := feature.invalid[filepath.Base(path)]
+				for _, message := range expected.messages {
+					runReports(t, expected.code, message, "run", "--vm", path)
+				}
+			}
+		})
+	}
+}
+
+// Examples shown in the README
+func TestExamples(t *testing.T) {
+	run(t, shared.EXIT_OK, "run", "../examples/defer.tiny")
+}
+
+func TestAssert(t *testing.T) {
+	run(t, shared.EXIT_OK, "test", "../tests/valid/assert")
+
+	tiny := New()
+	tiny.createBuiltins()
+	tiny.createAssert()
+
+	results, code := tiny.runTests("../tests/invalid/assert/assert_test.tiny", regexp.MustCompile(""))
+	if code != shared.EXIT_OK || len(results) == 0 {
+		t.Fatalf("Expected assertion tests to run, but received exit code '%d'", code)
+	}
+
+	for _, result := range results {
+		if result.passed() || !strings.Contains(result.Failure, "assert.") {
+			t.Fatalf("Expected '%s' to fail with an assertion message, but received '%s'", result.Name, result.Failure)
+		}
+	}
+}
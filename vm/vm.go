@@ -19,6 +19,11 @@ type Frame struct {
 	ret_to      int
 	stack_start int
 	arity       int
+	// Start of each deferred body reached, run in reverse by Return
+	defers []int
+	// Where Return was, to go back to once a deferred body has run
+	resume    int
+	resume_sp int
 }
 
 type VM struct {
@@ -37,11 +42,17 @@ func NewVM(debug bool, step bool, chunk *compiler.Chunk) *VM {
 }
 
 func (vm *VM) Report(msg string, args ...any) {
-	res := fmt.Sprintf(msg, args...)
-	shared.ReportErrFatal("Runtime: " + res)
+	panic(&runtime.RuntimeError{Diagnostic: shared.NewDiagnostic("Runtime", msg, args...)})
 }
 
-func (vm *VM) Run() {
+// Run the chunk, returning the status the process should exit with
+func (vm *VM) Run() (code int) {
+	defer func() {
+		if r := recover(); r != nil {
+			code = runtime.Recover(r)
+		}
+	}()
+
 	if vm.debug {
 		vm.chunk.Debug()
 	}
@@ -49,6 +60,13 @@ func (vm *VM) Run() {
 	vm.newFrame(0, 0)
 	defer vm.dropFrame()
 
+	vm.execute()
+	return shared.EXIT_OK
+}
+
+// Runs until the end of the chunk, the outermost frame returning, or a value
+// being yielded. Gives back the yielded value, or false once it has finished.
+func (vm *VM) execute() (runtime.Value, bool) {
 	for vm.ip < len(vm.chunk.Instructions) {
 		last := vm.ip
 
@@ -131,14 +149,22 @@ func (vm *VM) Run() {
 			start := vm.chunk.Instructions[vm.ip+2]
 			identifier := vm.chunk.Constants[vm.chunk.Instructions[vm.ip+3]].Inspect()
 
-			vm.globals[identifier] = &runtime.CompiledFunctionValue{int(start), arity, nil}
+			vm.globals[identifier] = &runtime.CompiledFunctionValue{Start_ip: int(start), Arity: arity, Bound: nil}
+			vm.ip += 4
+
+		case compiler.NewGen:
+			arity := vm.chunk.Instructions[vm.ip+1]
+			start := vm.chunk.Instructions[vm.ip+2]
+			identifier := vm.chunk.Constants[vm.chunk.Instructions[vm.ip+3]].Inspect()
+
+			vm.globals[identifier] = &runtime.CompiledFunctionValue{Start_ip: int(start), Arity: arity, Bound: nil, Generator: true}
 			vm.ip += 4
 
 		case compiler.NewAnonFn:
 			arity := vm.chunk.Instructions[vm.ip+1]
 			start := vm.chunk.Instructions[vm.ip+2]
 
-			vm.push(&runtime.CompiledFunctionValue{int(start), arity, nil})
+			vm.push(&runtime.CompiledFunctionValue{Start_ip: int(start), Arity: arity, Bound: nil})
 			vm.ip += 3
 
 		case compiler.Call:
@@ -150,10 +176,26 @@ func (vm *VM) Run() {
 				vm.Report("Function '%s' expected %d argument(s) but receieved %d", identifier, fn.Arity, vm.sp-vm.frames[len(vm.frames)-1].stack_start)
 			}
 
+			if fn.Generator {
+				vm.push(vm.generate(identifier, fn))
+				vm.ip += 2
+				break
+			}
+
 			vm.newFrame(vm.ip+2, int(fn.Arity))
 			vm.ip = fn.Start_ip
 
 		case compiler.Return:
+			// Deferred bodies run first, each coming back to this Return
+			if current := &vm.frames[len(vm.frames)-1]; len(current.defers) > 0 {
+				start := current.defers[len(current.defers)-1]
+				current.defers = current.defers[:len(current.defers)-1]
+
+				current.resume, current.resume_sp = vm.ip, vm.sp
+				vm.ip = start
+				break
+			}
+
 			frame := vm.dropFrame()
 
 			var retValue runtime.Value = nil
@@ -170,6 +212,25 @@ func (vm *VM) Run() {
 			}
 			vm.ip = frame.ret_to
 
+			// Only a generator's coroutine returns from its outermost frame
+			if len(vm.frames) == 0 {
+				return nil, false
+			}
+
+		case compiler.Yield:
+			vm.ip++
+			return vm.pop(), true
+
+		case compiler.Defer:
+			frame := &vm.frames[len(vm.frames)-1]
+			frame.defers = append(frame.defers, vm.ip+2)
+			vm.ip = int(vm.chunk.Instructions[vm.ip+1])
+
+		case compiler.EndDefer:
+			frame := vm.frames[len(vm.frames)-1]
+			vm.sp = frame.resume_sp
+			vm.ip = frame.resume
+
 		case compiler.Print:
 			vm.print()
 			vm.ip += 2
@@ -188,6 +249,94 @@ func (vm *VM) Run() {
 				vm.ip += 2
 			}
 
+		case compiler.List:
+			count := int(vm.chunk.Instructions[vm.ip+1])
+			values := make([]runtime.Value, count)
+
+			for idx := count - 1; idx >= 0; idx-- {
+				values[idx] = vm.pop()
+			}
+
+			vm.push(&runtime.ListVal{Values: values})
+			vm.ip += 2
+
+		case compiler.Unpack:
+			values, err := runtime.Unpack(vm.pop(), int(vm.chunk.Instructions[vm.ip+1]), vm.chunk.Instructions[vm.ip+2] == 1)
+			if err != nil {
+				vm.Report("%s", err.Error())
+			}
+
+			for _, value := range values {
+				vm.push(value)
+			}
+			vm.ip += 3
+
+		case compiler.Fields:
+			count := int(vm.chunk.Instructions[vm.ip+1])
+			names := make([]string, 0, count)
+
+			for _, name := range vm.chunk.Instructions[vm.ip+2 : vm.ip+2+count] {
+				names = append(names, vm.chunk.Constants[name].Inspect())
+			}
+
+			values, err := runtime.Fields(vm.pop(), names)
+			if err != nil {
+				vm.Report("%s", err.Error())
+			}
+
+			for _, value := range values {
+				vm.push(value)
+			}
+			vm.ip += 2 + count
+
+		case compiler.Iter:
+			iterator, err := runtime.Iterate(vm.pop())
+			if err != nil {
+				vm.Report("%s", err.Error())
+			}
+
+			vm.push(iterator)
+			vm.ip++
+
+		case compiler.IterNext:
+			iterator := vm.stack[vm.sp-1].(*runtime.IteratorValue)
+
+			index, value, ok, err := iterator.Next()
+			if err != nil {
+				vm.Report("%s", err.Error())
+			}
+
+			if !ok {
+				vm.ip = int(vm.chunk.Instructions[vm.ip+1])
+				break
+			}
+
+			if vm.chunk.Instructions[vm.ip+2] == 1 {
+				vm.push(&runtime.IntVal{Value: index})
+			}
+
+			vm.push(value)
+			vm.ip += 3
+
+		case compiler.Range:
+			flags := vm.chunk.Instructions[vm.ip+1]
+			parts := make([]runtime.Value, 3)
+
+			// Parts were pushed in order, so come off in reverse
+			for idx := 2; idx >= 0; idx-- {
+				if flags&(compiler.RANGE_START<<idx) != 0 {
+					parts[idx] = vm.pop()
+				}
+			}
+
+			value, err := runtime.NewRange(parts[0], parts[1], parts[2], flags&compiler.RANGE_INCLUSIVE != 0)
+			if err != nil {
+				vm.Report("%s", err.Error())
+			}
+
+			vm.push(value)
+			vm.ip += 2
+
 		case compiler.Halt:
 			vm.ip += 1
 
@@ -210,10 +359,46 @@ func (vm *VM) Run() {
 				vm.newFrame(0, 0)
 				vm.globals = make(map[string]runtime.Value, 32)
 			case "exit":
-				return
+				return nil, false
 			}
 		}
 	}
+
+	return nil, false
+}
+
+// Calls a generator function, moving its arguments onto the stack of a
+// coroutine which shares the chunk and globals. The coroutine runs up to each
+// yield as the iterator it gives back is stepped through.
+func (vm *VM) generate(identifier string, fn *runtime.CompiledFunctionValue) *runtime.IteratorValue {
+	arity := int(fn.Arity)
+
+	coroutine := &VM{
+		chunk:   vm.chunk,
+		ip:      fn.Start_ip,
+		globals: vm.globals,
+		stack:   make([]runtime.Value, STACK_MAX),
+		frames:  make([]Frame, 0, STACK_MAX),
+	}
+
+	for _, value := range vm.stack[vm.sp-arity : vm.sp] {
+		coroutine.push(value)
+	}
+	vm.sp -= arity
+
+	coroutine.newFrame(-1, arity)
+	finished := false
+
+	return runtime.NewIterator(identifier, func() (runtime.Value, bool, error) {
+		if finished {
+			return nil, false, nil
+		}
+
+		value, ok := coroutine.execute()
+		finished = !ok
+
+		return value, ok, nil
+	})
 }
 
 func (vm *VM) printStepInfo(last int) {
@@ -291,7 +476,7 @@ func (vm *VM) newFrame(return_to int, arity int) {
 	if len(vm.frames) >= STACK_MAX {
 		vm.Report("Stack overflow")
 	}
-	vm.frames = append(vm.frames, Frame{return_to, vm.sp - arity, arity})
+	vm.frames = append(vm.frames, Frame{ret_to: return_to, stack_start: vm.sp - arity, arity: arity})
 }
 
 func (vm *VM) dropFrame() Frame {